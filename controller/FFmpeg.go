@@ -23,7 +23,12 @@ func FFmpegHandler(c *gin.Context) {
 	if !ok {
 		log.Fatalf("无法从上下文获取用户ID")
 	}
-	outPath := util.FFmpeg(_UserID.(uint64), taskID)
+	outPath, err := util.FFmpeg(c.Request.Context(), _UserID.(uint64), taskID)
+	if err != nil {
+		log.Printf("FFmpeg failed for task %s: %v", taskID, err)
+		c.JSON(500, gin.H{"error": "failed to concat videos"})
+		return
+	}
 
 	// 构造前端可访问的 URL（包含 scheme）
 	scheme := "http"
@@ -35,7 +40,7 @@ func FFmpegHandler(c *gin.Context) {
 	//做一下崩溃恢复
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println("FFmpegHandler panic recovered: %v", r)
+			log.Printf("FFmpegHandler panic recovered: %v", r)
 		}
 	}()
 	c.JSON(200, gin.H{"message": "video ready", "video_url": videoURL, "path": outPath})
@@ -3,10 +3,14 @@ package controller
 import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
+	"V2V/logic"
 	"V2V/models"
+	"V2V/pkg/prompt"
+	"V2V/pkg/provider"
 	"V2V/pkg/queue"
 	"V2V/pkg/snowflake"
 	"V2V/pkg/sse"
+	"V2V/pkg/storyboard"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -14,19 +18,19 @@ import (
 	"sync"
 
 	"github.com/gin-gonic/gin"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
 )
 
 // SubmitI2VTask 提交图片生成视频任务
 // @Summary 提交图片生成视频任务
-// @Description 接收参考图片和文本提示词，创建一个新的 I2V 任务并返回任务 ID （输入从T2I获得的任务I2V的ID）
+// @Description 接收参考图片和文本提示词，创建一个新的 I2V 任务并返回任务 ID （输入从T2I获得的任务I2V的ID）。T2I 任务来自带分镜的 V2T 任务时，每个子任务使用对应分镜的视频生成提示词、运镜方式与时长；shot_numbers 指定第 i 张参考图对应的镜号（对应关系无效时返回 400），不填时使用 per_shot 模式 T2I 任务记录的对应关系，否则在参考图数与分镜数一致时按顺序一一对应；无法对应时与分镜不可用时一样使用整段分镜脚本；options 可指定模型、分辨率、宽高比、种子、水印、时长与是否固定镜头，允许范围取决于用户 VIP 等级
 // @Tags I2V
 // @Accept json
 // @Produce json
 // @Param request body models.I2VRequest true "I2V 任务请求"
-// @Success 202 {object} map[string]interface{} "{"task_id": 123456, "status": "task submitted"}"
-// @Failure 400 {object} map[string]string "invalid request"
+// @Success 202 {object} map[string]interface{} "{"task_id": 123456, "status": "task submitted", "shot_numbers": [1, 2, 3]}"
+// @Failure 400 {object} map[string]string "invalid request / invalid image to shot mapping"
 // @Failure 500 {object} map[string]string "server error"
+// @Failure 503 {object} map[string]interface{} "task queue temporarily unavailable"
 // @Router /api/v1/I2V [post]
 func SubmitI2VTask(c *gin.Context) {
 	// 请确保您已将 API Key 存储在环境变量 ARK_API_KEY 中
@@ -52,6 +56,17 @@ func SubmitI2VTask(c *gin.Context) {
 		c.JSON(403, gin.H{"error": "user tokens insufficient"})
 		return
 	}
+	options, err := logic.ResolveVideoOptions(userToken.VIPLevel, t.Options)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	promptRef, err := prompt.Resolve(models.PromptI2V, _UserID.(uint64), t.Project)
+	if err != nil {
+		fmt.Printf("failed to resolve prompt template: %v\n", err)
+		c.JSON(500, gin.H{"error": "failed to resolve prompt template"})
+		return
+	}
 	key := "user:" + strconv.FormatUint(_UserID.(uint64), 10) + ":t2itask:" + t.TaskID
 	// 从redis里找key获得参考图和文本提示词
 	hash, err := store.GetRedis().HGetAll(key).Result()
@@ -63,14 +78,54 @@ func SubmitI2VTask(c *gin.Context) {
 	referenceImages := strings.Split(hash["result"], "|z|k|x|")
 	//去掉refereceImages尾部的无用字符串
 	referenceImages = referenceImages[:len(referenceImages)-1]
+	// 参考图对应的分镜：T2I 任务记录了来源的 V2T 任务且该任务有结构化分镜时，按 shot_numbers（或顺序）对应
+	var shots []models.Shot
+	if v2tID, err := strconv.ParseUint(hash["v2t_task_id"], 10, 64); err == nil {
+		shots, err = mysql.GetV2TShots(v2tID, _UserID.(uint64))
+		if err != nil {
+			fmt.Printf("failed to get storyboard shots: %v\n", err)
+			c.JSON(500, gin.H{"error": "failed to get storyboard shots"})
+			return
+		}
+	}
+	// 没有指定时，per_shot 模式的 T2I 任务按其记录的图片与镜号对应（失败的分镜没有图片）
+	shotNos := t.ShotNumbers
+	if len(shotNos) == 0 && hash["shot_numbers"] != "" {
+		if err := json.Unmarshal([]byte(hash["shot_numbers"]), &shotNos); err != nil {
+			fmt.Printf("invalid shot_numbers of T2I task %s: %v\n", t.TaskID, err)
+			shotNos = nil
+		}
+	}
+	if len(shots) == 0 && len(t.ShotNumbers) > 0 {
+		c.JSON(400, gin.H{"error": "storyboard shots not available for this T2I task, shot_numbers cannot be used"})
+		return
+	}
+	var imageShots []models.Shot
+	var shotNumbers []int
+	if len(shots) > 0 {
+		imageShots, err = storyboard.MapImages(len(referenceImages), shots, shotNos)
+		if err != nil && len(t.ShotNumbers) > 0 {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			// 没有显式指定对应关系且无法对应（顺序生成时图片数由模型决定）：与分镜不可用时一样使用整段分镜脚本
+			fmt.Printf("I2V for T2I task %s falls back to the whole storyboard: %v\n", t.TaskID, err)
+			imageShots = nil
+		}
+		for _, s := range imageShots {
+			shotNumbers = append(shotNumbers, s.ShotNo)
+		}
+	}
 	taskID, err := snowflake.GetID()
 	if err != nil {
 		c.JSON(500, gin.H{"error": "failed to generate task ID"})
 		return
 	}
 	type TaskError struct {
-		Index int
-		Err   error
+		Index int    `json:"index"`
+		Err   error  `json:"-"`
+		Error string `json:"error"`
 	}
 	var wg sync.WaitGroup
 	errors := make(chan TaskError, len(referenceImages))
@@ -81,6 +136,15 @@ func SubmitI2VTask(c *gin.Context) {
 	redisclient.HSet(statusKey, "total", len(referenceImages))
 	redisclient.HSet(statusKey, "succeeded", 0)
 	redisclient.HSet(statusKey, "failed", 0)
+	if b, err := json.Marshal(options); err == nil {
+		redisclient.HSet(statusKey, "options", string(b))
+	}
+	if b, err := json.Marshal(promptRef); err == nil {
+		redisclient.HSet(statusKey, "prompt_template", string(b))
+	}
+	if b, err := json.Marshal(shotNumbers); err == nil && shotNumbers != nil {
+		redisclient.HSet(statusKey, "shot_numbers", string(b))
+	}
 
 	rabbitMQ, err := queue.GetI2VRabbitMQ()
 	if err != nil {
@@ -100,14 +164,24 @@ func SubmitI2VTask(c *gin.Context) {
 			I2Vtask.ImageURL = img
 			I2Vtask.Prompt = prompts
 			I2Vtask.Priority = 1
+			I2Vtask.Options = options
+			I2Vtask.PromptTemplate = promptRef
+			if imageShots != nil {
+				shot := imageShots[idx]
+				I2Vtask.ShotNo = shot.ShotNo
+				I2Vtask.CameraMove = shot.CameraMove
+				I2Vtask.Prompt = shotVideoPrompt(shot)
+				I2Vtask.Options = logic.ShotVideoOptions(userToken.VIPLevel, t.Options, options, shot)
+			}
 			b, err := json.Marshal(I2Vtask)
 			if err != nil {
 				errors <- TaskError{Index: idx + 1, Err: err}
 				return
 			}
+			// 发布在 broker 确认后才返回，保证返回 202 时每个分镜的任务都已落到队列
 			err = rabbitMQ.PublishI2VTask(b, I2Vtask.Priority)
 			if err != nil {
-				errors <- TaskError{Index: idx + 1, Err: err}
+				errors <- TaskError{Index: idx + 1, Err: err, Error: err.Error()}
 				return
 			}
 			errors <- TaskError{Index: idx + 1, Err: err}
@@ -116,11 +190,20 @@ func SubmitI2VTask(c *gin.Context) {
 	wg.Wait()
 	close(errors)
 	var failed []TaskError
+	temporary := true
 	for taskErr := range errors {
 		if taskErr.Err != nil {
 			failed = append(failed, taskErr)
+			temporary = temporary && queue.IsTemporary(taskErr.Err)
 		}
 	}
+	if len(failed) > 0 && temporary {
+		c.JSON(503, gin.H{
+			"error":        "task queue temporarily unavailable, please retry later",
+			"failed_tasks": failed,
+		})
+		return
+	}
 	if len(failed) > 0 {
 		c.JSON(500, gin.H{
 			"error":        "failed to create I2V task",
@@ -128,12 +211,22 @@ func SubmitI2VTask(c *gin.Context) {
 		})
 		return
 	}
-	c.JSON(202, gin.H{"code": 202, "task_id": strconv.FormatUint(taskID, 10), "status": "submitted"})
+	c.JSON(202, gin.H{"code": 202, "task_id": strconv.FormatUint(taskID, 10), "status": "submitted", "shot_numbers": shotNumbers})
+}
+
+// shotVideoPrompt 分镜的视频生成提示词，分镜没有时退回画面内容与图片提示词
+func shotVideoPrompt(shot models.Shot) string {
+	for _, p := range []string{shot.VideoPrompt, shot.Content, shot.ImagePrompt} {
+		if p != "" {
+			return p
+		}
+	}
+	return ""
 }
 
 // GetI2VTaskResult 获取 I2V 任务结果
 // @Summary 获取 I2V 任务结果
-// @Description 通过任务 ID 获取 I2V 任务（输入任务I2V的ID可以查询到任务完成情况）
+// @Description 通过任务 ID 获取 I2V 任务（输入任务I2V的ID可以查询到任务完成情况；shot_numbers 为各参考图对应的镜号，分镜不可用时为空）
 // @Tags I2V
 // @Accept json
 // @Produce json
@@ -161,11 +254,17 @@ func GetI2VTaskResult(c *gin.Context) {
 	succeeded := hash["succeeded"]
 	failed := hash["failed"]
 	total := hash["total"]
+	var shotNumbers []int
+	if v := hash["shot_numbers"]; v != "" {
+		_ = json.Unmarshal([]byte(v), &shotNumbers)
+	}
 
 	c.JSON(200, gin.H{
-		"succeeded": succeeded,
-		"failed":    failed,
-		"total":     total,
+		"shot_numbers":    shotNumbers,
+		"succeeded":       succeeded,
+		"failed":          failed,
+		"total":           total,
+		"prompt_template": store.ParsePromptRef(hash["prompt_template"]),
 	})
 }
 
@@ -182,8 +281,14 @@ func GetI2VTaskResult(c *gin.Context) {
 // @Router /api/v1/I2VCallback/{task_id} [post]
 func I2VCallback(c *gin.Context) {
 	taskID := c.Param("task_id")
-	var callbackData model.GetContentGenerationTaskResponse
-	if err := c.ShouldBindJSON(&callbackData); err != nil {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	// 回调格式由配置的图生视频服务解析，状态已归一化为 queued / running / succeeded / failed / cancelled
+	callbackData, err := provider.Videos().ParseCallback(body)
+	if err != nil {
 		c.JSON(400, gin.H{"error": "invalid request"})
 		return
 	}
@@ -207,8 +312,8 @@ local video_url = ARGV[3]
 local total = tonumber(redis.call('HGET', key, 'total') or '0')
 local old = redis.call('HGET', key, field)
 
--- 如果已有终态（succeeded 或 failed），视为不可变，直接返回当前计数（不改变任何东西）
-if old == 'succeeded' or old == 'failed' then
+-- 如果已有终态（succeeded / failed / cancelled / timed_out），视为不可变，直接返回当前计数（不改变任何东西）
+if old == 'succeeded' or old == 'failed' or old == 'cancelled' or old == 'timed_out' then
 	return {redis.call('HGET', key, 'succeeded'), redis.call('HGET', key, 'failed'), tostring(total), 0}
 end
 
@@ -221,7 +326,7 @@ if not old or old == '' then
 		if video_url and video_url ~= '' then
 			redis.call('SET', 'i2v:task:'..field..':video_url', video_url, 'EX', 86400)
 		end
-	elseif new == 'failed' then
+	elseif new == 'failed' or new == 'cancelled' then
 		redis.call('HINCRBY', key, 'failed', 1)
 	end
 	return {redis.call('HGET', key, 'succeeded'), redis.call('HGET', key, 'failed'), tostring(total), 1}
@@ -232,27 +337,22 @@ if old == new then
 	return {redis.call('HGET', key, 'succeeded'), redis.call('HGET', key, 'failed'), tostring(total), 0}
 end
 
--- old 存在且不是终态（例如 running），允许更新到新状态（succeeded/failed）
+-- old 存在且不是终态（例如 running），允许更新到新状态（succeeded / failed / cancelled）
 redis.call('HSET', key, field, new)
 if new == 'succeeded' then
 	redis.call('HINCRBY', key, 'succeeded', 1)
 	if video_url and video_url ~= '' then
 		redis.call('SET', 'i2v:task:'..field..':video_url', video_url, 'EX', 86400)
 	end
-elseif new == 'failed' then
+elseif new == 'failed' or new == 'cancelled' then
 	redis.call('HINCRBY', key, 'failed', 1)
 end
 return {redis.call('HGET', key, 'succeeded'), redis.call('HGET', key, 'failed'), tostring(total), 1}
 `
 
-	newStatus := strings.ToLower(callbackData.Status)
-	// SDK 的 Content 字段包含 VideoURL（当 status 为 succeeded 时必定有值），直接取出即可
-	var contentURL string
-	if newStatus == "succeeded" {
-		contentURL = callbackData.Content.VideoURL
-	} else {
-		contentURL = ""
-	}
+	newStatus := callbackData.Status
+	// succeeded 时 VideoURL 必定有值，其余状态为空
+	contentURL := callbackData.VideoURL
 
 	// 执行 Lua 脚本，确保比较/更新/计数为原子操作
 	res, err := redisclient.Eval(lua, []string{key}, callbackData.ID, newStatus, contentURL).Result()
@@ -3,10 +3,13 @@ package controller
 import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
+	"V2V/logic"
 	"V2V/models"
+	"V2V/pkg/prompt"
 	"V2V/pkg/queue"
 	"V2V/pkg/snowflake"
 	"encoding/json"
+	"log"
 	"strconv"
 	"time"
 
@@ -15,14 +18,16 @@ import (
 
 // SubmitT2ITask 提交文本生成图片任务
 // @Summary 提交文本生成图片任务
-// @Description 接收任务ID，创建一个新的 T2I 任务并返回任务 ID（输入从V2T得到的任务ID）
+// @Description 接收任务ID，创建一个新的 T2I 任务并返回任务 ID（输入从V2T得到的任务ID）；options 可指定模型、尺寸、宽高比、种子、水印与图片数，允许范围取决于用户 VIP 等级。mode 为 per_shot 时每个分镜按其图片生成提示词单独生成一张图片（需要 V2T 任务有结构化分镜，分镜数不能超过图片数上限），结果中会标明每张图片对应的镜号与失败的分镜
 // @Tags T2I
 // @Accept json
 // @Produce json
 // @Param request body models.T2IRequest true "T2I 任务请求"
 // @Success 202 {object} map[string]interface{} "{"task_id": 123456, "status": "task submitted"}"
-// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 400 {object} map[string]string "invalid request / storyboard shots not available"
+// @Failure 404 {object} map[string]string "storyboard not found"
 // @Failure 500 {object} map[string]string "server error"
+// @Failure 503 {object} map[string]string "task queue temporarily unavailable"
 // @Router /api/v1/T2I [post]
 func SubmitT2ITask(c *gin.Context) {
 	var T2IRequest models.T2IRequest
@@ -44,23 +49,80 @@ func SubmitT2ITask(c *gin.Context) {
 		c.JSON(403, gin.H{"error": "user tokens insufficient"})
 		return
 	}
+	options, err := logic.ResolveImageOptions(userToken.VIPLevel, T2IRequest.Options)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	mode := T2IRequest.Mode
+	if mode == "" {
+		mode = models.T2IModeSequential
+	}
+	if mode != models.T2IModeSequential && mode != models.T2IModePerShot {
+		c.JSON(400, gin.H{"error": "mode must be sequential or per_shot"})
+		return
+	}
+	// per_shot 模式下每个分镜使用 t2i_shot 模板渲染
+	promptName := models.PromptT2I
+	if mode == models.T2IModePerShot {
+		promptName = models.PromptT2IShot
+	}
+	promptRef, err := prompt.Resolve(promptName, _UserID.(uint64), T2IRequest.Project)
+	if err != nil {
+		log.Printf("Failed to resolve prompt template: %v", err)
+		c.JSON(500, gin.H{"error": "failed to resolve prompt template"})
+		return
+	}
 	taskID, err := snowflake.GetID()
 	if err != nil {
 		c.JSON(500, gin.H{"error": "failed to generate task ID"})
 		return
 	}
-	key := "user:" + strconv.FormatUint(_UserID.(uint64), 10) + ":t2itask:" + T2IRequest.TaskID
+	// 分镜脚本来自请求中的 V2T 任务
+	v2tTaskID, err := strconv.ParseUint(T2IRequest.TaskID, 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	key := "user:" + strconv.FormatUint(_UserID.(uint64), 10) + ":v2ttask:" + T2IRequest.TaskID
 	hash, err := store.GetRedis().HGetAll(key).Result()
 	if err != nil {
 		c.JSON(500, gin.H{"error": "failed to generate task ID"})
 		return
 	}
+	if hash["result"] == "" {
+		c.JSON(404, gin.H{"error": "storyboard not found, the V2T task may not be completed"})
+		return
+	}
+	var shots []models.Shot
+	if mode == models.T2IModePerShot {
+		shots, err = mysql.GetV2TShots(v2tTaskID, _UserID.(uint64))
+		if err != nil {
+			log.Printf("Failed to get storyboard shots: %v", err)
+			c.JSON(500, gin.H{"error": "failed to get storyboard shots"})
+			return
+		}
+		if len(shots) == 0 {
+			c.JSON(400, gin.H{"error": "storyboard shots not available for this V2T task, per_shot mode cannot be used"})
+			return
+		}
+		// 每个分镜生成一张图片，分镜数受图片数上限约束
+		if len(shots) > options.Count {
+			c.JSON(400, gin.H{"error": "storyboard has " + strconv.Itoa(len(shots)) + " shots, more than the image count limit " + strconv.Itoa(options.Count)})
+			return
+		}
+	}
 	var T2ITask models.T2ITask
 	T2ITask.TaskID = taskID
 	T2ITask.UserID = _UserID.(uint64)
+	T2ITask.V2TTaskID = v2tTaskID
 	T2ITask.Prompt = hash["result"]
 	T2ITask.Status = models.StatusPending
 	T2ITask.CreatedAt = time.Now().Unix()
+	T2ITask.Options = options
+	T2ITask.PromptTemplate = promptRef
+	T2ITask.Mode = mode
+	T2ITask.Shots = shots
 
 	rabbitMQ, err := queue.GetT2IRabbitMQ()
 	if err != nil {
@@ -73,6 +135,10 @@ func SubmitT2ITask(c *gin.Context) {
 		return
 	}
 	err = rabbitMQ.PublishT2ITask(b, T2ITask.Priority)
+	if queue.IsTemporary(err) {
+		c.JSON(503, gin.H{"error": "task queue temporarily unavailable, please retry later"})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": "failed to publish T2I task"})
 		return
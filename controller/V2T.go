@@ -4,33 +4,71 @@ import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
 	"V2V/models"
+	"V2V/pkg/prompt"
+	"V2V/pkg/provider"
 	"V2V/pkg/queue"
 	"V2V/pkg/snowflake"
+	"V2V/pkg/storyboard"
+	"V2V/pkg/upload"
 	"encoding/json"
+	"errors"
 	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
 )
 
 // SubmitV2TTask 提交视频转文字任务
 // @Summary 提交视频转文字任务
-// @Description 接收视频URL，创建一个新的 V2T 任务并返回任务 ID （目前没有登陆注册，所以就只要求输入视频链接）
+// @Description 接收视频URL（JSON）或直接上传的视频文件（multipart/form-data，字段 video，可选字段 provider、project），创建一个新的 V2T 任务并返回任务 ID
 // @Tags V2T
-// @Accept json
+// @Accept json,mpfd
 // @Produce json
-// @Param request body models.V2TRequest true "V2T 任务请求"
+// @Param request body models.V2TRequest false "V2T 任务请求（JSON 提交时）"
+// @Param video formData file false "视频文件（multipart 提交时，大小与类型受 upload 配置限制）"
+// @Param provider formData string false "视频分析服务（gemini / doubao）"
+// @Param project formData string false "项目标识，用于匹配项目级的提示词模板"
 // @Success 202 {object} map[string]interface{} "{"task_id": "123456", "status": "submitted"}"
 // @Failure 400 {object} map[string]string "invalid request"
+// @Failure 413 {object} map[string]string "video file too large"
+// @Failure 415 {object} map[string]string "unsupported video type"
 // @Failure 500 {object} map[string]string "server error"
+// @Failure 503 {object} map[string]string "task queue temporarily unavailable"
 // @Router /api/v1/V2T [post]
 func SubmitV2TTask(c *gin.Context) {
-	//解析前端请求并提交任务
-	var taskReq *models.V2TRequest
-	if err := c.ShouldBindJSON(&taskReq); err != nil {
+	//解析前端请求并提交任务：JSON 提交视频链接，multipart 直接上传视频文件
+	var taskReq models.V2TRequest
+	var videoFile *multipart.FileHeader
+	if c.ContentType() == gin.MIMEMultipartPOSTForm {
+		// 预留 1MB 给其他表单字段与 multipart 边界
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, upload.MaxBytes()+1<<20)
+		fh, err := c.FormFile("video")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(413, gin.H{"error": "video file too large"})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid request"})
+			return
+		}
+		videoFile = fh
+		taskReq.Provider = c.PostForm("provider")
+		taskReq.Project = c.PostForm("project")
+	} else if err := c.ShouldBindJSON(&taskReq); err != nil || taskReq.VideoURL == "" {
 		c.JSON(400, gin.H{"error": "invalid request"})
 		return
 	}
+	// video_file 只能由服务端填写
+	taskReq.VideoFile = nil
+	if _, ok := provider.Analyzer(taskReq.Provider); taskReq.Provider != "" && !ok {
+		c.JSON(400, gin.H{"error": "unknown provider"})
+		return
+	}
 	//创建新任务
 	//获得任务ID
 	_userId, ok := c.Get("user_id")
@@ -47,18 +85,43 @@ func SubmitV2TTask(c *gin.Context) {
 		c.JSON(403, gin.H{"error": "user tokens insufficient"})
 		return
 	}
+	promptRef, err := prompt.Resolve(models.PromptV2T, _userId.(uint64), taskReq.Project)
+	if err != nil {
+		log.Printf("Failed to resolve prompt template: %v", err)
+		c.JSON(500, gin.H{"error": "failed to resolve prompt template"})
+		return
+	}
 	taskID, err := snowflake.GetID()
 	if err != nil {
 		c.JSON(500, gin.H{"error": "failed to generate task ID"})
 		return
 	}
+	if videoFile != nil {
+		saved, err := upload.SaveVideo(videoFile, strconv.FormatUint(taskID, 10))
+		switch {
+		case errors.Is(err, upload.ErrTooLarge):
+			c.JSON(413, gin.H{"error": "video file too large"})
+			return
+		case errors.Is(err, upload.ErrUnsupportedType):
+			c.JSON(415, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to save uploaded video for task %d: %v", taskID, err)
+			c.JSON(500, gin.H{"error": "failed to store video file"})
+			return
+		}
+		saved.URL = "/api/v1/V2T/" + strconv.FormatUint(taskID, 10) + "/video"
+		taskReq.VideoFile = saved
+	}
 
 	V2TTask := models.V2TTask{
 		UserID:     _userId.(uint64),
 		TaskID:     taskID,
 		Status:     models.StatusPending,
 		Result:     "",
-		V2TRequest: *taskReq,
+		V2TRequest: taskReq,
+		// 重试与回放都按提交时的模板版本渲染
+		PromptTemplate: promptRef,
 	}
 	err = store.V2TTask(V2TTask)
 	if err != nil {
@@ -77,6 +140,10 @@ func SubmitV2TTask(c *gin.Context) {
 		return
 	}
 	err = rabbitMQ.Publish([]byte(b), V2TTask.Priority)
+	if queue.IsTemporary(err) {
+		c.JSON(503, gin.H{"error": "task queue temporarily unavailable, please retry later"})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": "failed to publish task"})
 		return
@@ -93,7 +160,7 @@ func SubmitV2TTask(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param task_id path string true "Task ID"
-// @Success 200 {object} map[string]interface{} "{"task_id": 123456, "status": "completed", "result": "..."}"
+// @Success 200 {object} models.V2TResponse "status 为 retrying 时 attempts 为已失败的执行记录；shots 为结构化的分镜（模型输出无法解析时为空）"
 // @Failure 404 {object} map[string]string "task not found"
 // @Failure 500 {object} map[string]string "server error"
 // @Router /api/v1/V2T/{task_id} [get]
@@ -119,18 +186,56 @@ func GetV2TTaskResult(c *gin.Context) {
 	// parse task_id (stored as a string in Redis) into uint64
 	result.TaskID = taskID
 	result.Result = hash["result"]
+	result.Provider = hash["provider"]
+	result.VideoFile = hash["video_file"]
+	result.PromptTemplate = store.ParsePromptRef(hash["prompt_template"])
+	result.Shots = store.ParseShots(hash["shots"])
+	result.Attempts = store.ParseAttempts(hash["attempts"])
 	// result.UpdatedAt = hash["updated_at"]
 	log.Printf("Fetched task %s: status=%s", taskID, result.Status)
-	c.JSON(200, gin.H{
-		"task_id": result.TaskID,
-		"status":  result.Status,
-		"result":  result.Result,
-	})
+	c.JSON(200, result)
+}
+
+// GetV2TVideo 读取 V2T 任务直接上传的视频
+// @Summary 读取 V2T 任务上传的视频
+// @Description 返回当前用户在该任务中直接上传的视频文件；上传目录不对外公开，其他用户的任务与通过 video_url 提交的任务返回 404
+// @Tags V2T
+// @Produce octet-stream
+// @Param task_id path string true "Task ID"
+// @Success 200 {file} file "视频文件"
+// @Failure 404 {object} map[string]string "video not found"
+// @Failure 500 {object} map[string]string "server error"
+// @Router /api/v1/V2T/{task_id}/video [get]
+func GetV2TVideo(c *gin.Context) {
+	taskID := c.Param("task_id")
+	_UserID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(500, gin.H{"error": "failed to get user ID"})
+		return
+	}
+	// 只查当前用户自己的任务，别人的任务 ID 查不到
+	key := "user:" + strconv.FormatUint(_UserID.(uint64), 10) + ":v2ttask:" + taskID
+	path, err := store.GetRedis().HGet(key, "video_path").Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to get video of task %s: %v", taskID, err)
+		c.JSON(500, gin.H{"error": "failed to get video"})
+		return
+	}
+	if path == "" {
+		c.JSON(404, gin.H{"error": "video not found"})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Uploaded video of task %s unavailable: %v", taskID, err)
+		c.JSON(404, gin.H{"error": "video not found"})
+		return
+	}
+	c.File(path)
 }
 
 // LoraText 更新任务 Lora 文本
 // @Summary 更新任务 Lora 文本
-// @Description 为指定任务更新 Lora 相关的文本提示词 （同时输入任务ID与更新后的提示词即可）
+// @Description 为指定任务更新 Lora 相关的文本提示词 （同时输入任务ID与更新后的提示词即可）；提示词为分镜表格时同时更新结构化的分镜
 // @Tags V2T
 // @Accept json
 // @Produce json
@@ -159,5 +264,21 @@ func LoraText(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "failed to update task"})
 		return
 	}
+	// 分镜随修改后的脚本重新解析；解析不出分镜时删除旧的分镜，后续阶段按整段文本使用
+	shots, _, err := storyboard.Parse(LoraTextReq.Prompt)
+	if err != nil {
+		shots = nil
+		err = store.GetRedis().HDel(key, "shots").Err()
+	} else if b, merr := json.Marshal(shots); merr == nil {
+		err = store.GetRedis().HSet(key, "shots", string(b)).Err()
+	}
+	if err == nil {
+		err = mysql.ReplaceV2TShots(LoraTextReq.TaskID, _UserID.(uint64), shots)
+	}
+	if err != nil {
+		log.Printf("Failed to update shots of task %d: %v", LoraTextReq.TaskID, err)
+		c.JSON(500, gin.H{"error": "failed to update task shots"})
+		return
+	}
 	c.JSON(200, gin.H{"task_id": strconv.FormatUint(_UserID.(uint64), 10), "status": "task updated"})
 }
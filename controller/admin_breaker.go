@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"V2V/pkg/breaker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListBreakers 外部服务熔断器状态
+// @Summary 外部服务熔断器状态
+// @Description 列出本进程各 provider（gemini / ark）熔断器的状态、连续失败次数与下一次探测时间；熔断期间依赖该 provider 的队列暂停消费
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Success 200 {object} ResponseData
+// @Router /admin/breakers [get]
+func ListBreakers(c *gin.Context) {
+	ResponseSuccess(c, breaker.Statuses())
+}
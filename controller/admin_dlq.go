@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"V2V/pkg/queue"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeadLetterSelection 回放 / 清空死信的请求体；ids 为空表示全部
+type DeadLetterSelection struct {
+	IDs   []string `json:"ids"`
+	Limit int      `json:"limit"`
+}
+
+// ListDeadLetterQueues 死信队列概览
+// @Summary 死信队列概览
+// @Description 列出各任务的死信队列（v2t / t2i / i2v / i2v-check）及积压消息数
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Success 200 {object} ResponseData
+// @Router /admin/dlq [get]
+func ListDeadLetterQueues(c *gin.Context) {
+	ResponseSuccess(c, queue.DeadLetterQueues())
+}
+
+// ListDeadLetters 查看死信
+// @Summary 查看死信
+// @Description 查看死信队列头部的消息：解码后的任务载荷、死信原因、重试次数（消息保持在队列中）
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Param queue path string true "任务名：v2t / t2i / i2v / i2v-check"
+// @Param limit query int false "最多返回条数，默认 50，最大 1000"
+// @Success 200 {object} ResponseData
+// @Failure 404 {object} map[string]string "unknown queue"
+// @Router /admin/dlq/{queue} [get]
+func ListDeadLetters(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	page, err := queue.ListDeadLetters(c.Param("queue"), limit)
+	if err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	ResponseSuccess(c, page)
+}
+
+// ReplayDeadLetters 回放死信
+// @Summary 回放死信
+// @Description 把选中的死信（ids 为空时为队列头部 limit 条）重新发布到原队列，重试计数清零
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Param queue path string true "任务名：v2t / t2i / i2v / i2v-check"
+// @Param body body DeadLetterSelection false "选择的消息"
+// @Success 200 {object} ResponseData
+// @Router /admin/dlq/{queue}/replay [post]
+func ReplayDeadLetters(c *gin.Context) {
+	var sel DeadLetterSelection
+	if !bindDeadLetterSelection(c, &sel) {
+		return
+	}
+	n, err := queue.ReplayDeadLetters(c.Param("queue"), sel.IDs, sel.Limit)
+	if err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	ResponseSuccess(c, gin.H{"replayed": n})
+}
+
+// PurgeDeadLetters 删除死信
+// @Summary 删除死信
+// @Description 删除选中的死信；ids 为空时清空整个死信队列
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Param queue path string true "任务名：v2t / t2i / i2v / i2v-check"
+// @Param body body DeadLetterSelection false "选择的消息"
+// @Success 200 {object} ResponseData
+// @Router /admin/dlq/{queue}/purge [post]
+func PurgeDeadLetters(c *gin.Context) {
+	var sel DeadLetterSelection
+	if !bindDeadLetterSelection(c, &sel) {
+		return
+	}
+	n, err := queue.PurgeDeadLetters(c.Param("queue"), sel.IDs)
+	if err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	ResponseSuccess(c, gin.H{"purged": n})
+}
+
+// bindDeadLetterSelection 请求体可以为空（表示全部）
+func bindDeadLetterSelection(c *gin.Context, sel *DeadLetterSelection) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	if err := c.ShouldBindJSON(sel); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body"})
+		return false
+	}
+	return true
+}
+
+func writeDeadLetterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, queue.ErrUnknownDeadLetterQueue):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, queue.ErrReconnecting):
+		c.JSON(503, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
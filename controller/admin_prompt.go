@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"V2V/dao/mysql"
+	"V2V/models"
+	"V2V/pkg/prompt"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminListPromptTemplates 查看全部提示词模板
+// @Summary 查看全部提示词模板
+// @Description 列出模板版本，可按类型与范围过滤；scope 非空时同时按 scope_id 过滤（global 的 scope_id 为空）
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Param name query string false "模板类型：v2t / t2i / t2i_shot / i2v"
+// @Param scope query string false "作用范围：global / project / user"
+// @Param scope_id query string false "项目标识或用户 ID"
+// @Success 200 {object} ResponseData
+// @Failure 400 {object} map[string]string "unknown prompt template name or scope"
+// @Router /admin/prompts [get]
+func AdminListPromptTemplates(c *gin.Context) {
+	name, scope := c.Query("name"), c.Query("scope")
+	if !validPromptName(c, name) {
+		return
+	}
+	if scope != "" && !prompt.ValidScope(scope) {
+		c.JSON(400, gin.H{"error": "unknown prompt template scope"})
+		return
+	}
+	templates, err := mysql.ListPromptTemplates(name, scope, c.Query("scope_id"))
+	if err != nil {
+		log.Printf("Failed to list prompt templates: %v", err)
+		c.JSON(500, gin.H{"error": "failed to list prompt templates"})
+		return
+	}
+	ResponseSuccess(c, gin.H{"templates": templates, "builtin": prompt.Builtins()})
+}
+
+// AdminCreatePromptTemplate 创建提示词模板版本
+// @Summary 创建提示词模板版本
+// @Description 在指定范围（global / project / user）下创建一个模板版本，版本号自动递增；project 与 user 范围需要 scope_id；activate 为 true 时立即生效
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Param request body models.PromptTemplateRequest true "模板内容与范围"
+// @Success 200 {object} ResponseData
+// @Failure 400 {object} map[string]string "invalid prompt template"
+// @Router /admin/prompts [post]
+func AdminCreatePromptTemplate(c *gin.Context) {
+	var req models.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	switch {
+	case !prompt.ValidScope(req.Scope):
+		c.JSON(400, gin.H{"error": "scope must be one of global / project / user"})
+		return
+	case req.Scope == models.PromptScopeGlobal && req.ScopeID != "":
+		c.JSON(400, gin.H{"error": "scope_id must be empty for global templates"})
+		return
+	case req.Scope != models.PromptScopeGlobal && req.ScopeID == "":
+		c.JSON(400, gin.H{"error": "scope_id is required for " + req.Scope + " templates"})
+		return
+	}
+	if req.Scope == models.PromptScopeUser {
+		if _, err := strconv.ParseUint(req.ScopeID, 10, 64); err != nil {
+			c.JSON(400, gin.H{"error": "scope_id must be a user ID for user templates"})
+			return
+		}
+	}
+	createPromptTemplate(c, req, 0)
+}
+
+// AdminActivatePromptTemplate 激活提示词模板版本
+// @Summary 激活提示词模板版本
+// @Description 把指定版本设为其类型与范围下当前生效的版本（同范围的其他版本取消激活），之后提交的任务使用该版本
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Param id path int true "模板版本 ID"
+// @Success 200 {object} ResponseData
+// @Failure 404 {object} map[string]string "prompt template not found"
+// @Router /admin/prompts/{id}/activate [post]
+func AdminActivatePromptTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "prompt template not found"})
+		return
+	}
+	activatePromptTemplate(c, id)
+}
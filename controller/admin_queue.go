@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"V2V/pkg/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListQueueStats 任务队列消费者状态
+// @Summary 任务队列消费者状态
+// @Description 列出本进程各任务队列的并发数、prefetch、在途任务数与处理计数（api 角色只发布不消费，consuming 为 false）
+// @Tags Admin
+// @Produce json
+// @Param X-Admin-Token header string true "管理令牌"
+// @Success 200 {object} ResponseData
+// @Router /admin/queues [get]
+func ListQueueStats(c *gin.Context) {
+	ResponseSuccess(c, queue.Stats())
+}
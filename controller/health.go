@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"V2V/pkg/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthzHandler 存活探针
+// @Summary 存活探针
+// @Description 检查进程内部循环（如 SSE hub）是否仍在运行；失败时应重启进程
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /healthz [get]
+func HealthzHandler(c *gin.Context) {
+	writeHealthReport(c, health.Liveness(c.Request.Context()))
+}
+
+// ReadyzHandler 就绪探针
+// @Summary 就绪探针
+// @Description 检查 MySQL、Redis、RabbitMQ 各队列、SSE hub 与 ffmpeg 是否可用；启动中或优雅关闭期间返回 503
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func ReadyzHandler(c *gin.Context) {
+	writeHealthReport(c, health.Readiness(c.Request.Context()))
+}
+
+func writeHealthReport(c *gin.Context, report health.Report) {
+	code := 200
+	if report.Status != health.StatusUp {
+		code = 503
+	}
+	c.JSON(code, report)
+}
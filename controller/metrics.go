@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"V2V/pkg/metrics"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler Prometheus 指标
+// @Summary Prometheus 指标
+// @Description 以 Prometheus 文本格式输出本进程的指标（队列在途任务数、并发配置、处理计数等）
+// @Tags Health
+// @Produce plain
+// @Success 200 {string} string "Prometheus text format"
+// @Router /metrics [get]
+func MetricsHandler(c *gin.Context) {
+	c.Status(200)
+	c.Header("Content-Type", metrics.ContentType)
+	if err := metrics.Write(c.Writer); err != nil {
+		log.Printf("failed to write metrics: %v", err)
+	}
+}
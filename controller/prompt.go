@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"V2V/dao/mysql"
+	"V2V/models"
+	"V2V/pkg/prompt"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPromptTemplates 查看提示词模板
+// @Summary 查看提示词模板
+// @Description 列出对当前用户可见的模板版本：全局模板、指定项目的模板与自己的模板，以及内置模板（版本 0，含各类型可用的变量）。提交任务时按 用户 > 项目 > 全局 > 内置 的顺序使用激活的版本
+// @Tags Prompt
+// @Produce json
+// @Param name query string false "模板类型：v2t / t2i / t2i_shot / i2v"
+// @Param project query string false "项目标识"
+// @Success 200 {object} ResponseData
+// @Failure 400 {object} map[string]string "unknown prompt template name"
+// @Failure 500 {object} map[string]string "server error"
+// @Router /api/v1/prompts [get]
+func ListPromptTemplates(c *gin.Context) {
+	name := c.Query("name")
+	if !validPromptName(c, name) {
+		return
+	}
+	_UserID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(500, gin.H{"error": "failed to get user ID"})
+		return
+	}
+	scopes := [][2]string{
+		{models.PromptScopeUser, strconv.FormatUint(_UserID.(uint64), 10)},
+		{models.PromptScopeGlobal, ""},
+	}
+	if project := c.Query("project"); project != "" {
+		scopes = append(scopes, [2]string{models.PromptScopeProject, project})
+	}
+	templates := []models.PromptTemplate{}
+	for _, s := range scopes {
+		list, err := mysql.ListPromptTemplates(name, s[0], s[1])
+		if err != nil {
+			log.Printf("Failed to list prompt templates: %v", err)
+			c.JSON(500, gin.H{"error": "failed to list prompt templates"})
+			return
+		}
+		templates = append(templates, list...)
+	}
+	ResponseSuccess(c, gin.H{"templates": templates, "builtin": prompt.Builtins()})
+}
+
+// CreatePromptTemplate 创建个人提示词模板版本
+// @Summary 创建个人提示词模板版本
+// @Description 为当前用户创建一个模板版本（覆盖项目与全局模板）。内容使用 text/template 语法，只能引用该类型提供的变量：v2t 无变量，t2i 为 {{.storyboard}}，t2i_shot 为 {{.shot_no}}、{{.image_prompt}}、{{.framing}} 与 {{.content}}，i2v 为 {{.index}}、{{.shot_no}}、{{.prompt}}、{{.camera_move}} 与 {{.duration}}；activate 为 true 时立即生效
+// @Tags Prompt
+// @Accept json
+// @Produce json
+// @Param request body models.PromptTemplateRequest true "模板内容（scope / scope_id 不需要填写）"
+// @Success 200 {object} ResponseData
+// @Failure 400 {object} map[string]string "invalid prompt template"
+// @Failure 403 {object} map[string]string "only admins can manage global or project templates"
+// @Failure 500 {object} map[string]string "server error"
+// @Router /api/v1/prompts [post]
+func CreatePromptTemplate(c *gin.Context) {
+	var req models.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Scope != "" && req.Scope != models.PromptScopeUser {
+		c.JSON(403, gin.H{"error": "only admins can manage global or project templates"})
+		return
+	}
+	_UserID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(500, gin.H{"error": "failed to get user ID"})
+		return
+	}
+	userID := _UserID.(uint64)
+	req.Scope = models.PromptScopeUser
+	req.ScopeID = strconv.FormatUint(userID, 10)
+	createPromptTemplate(c, req, userID)
+}
+
+// ActivatePromptTemplate 激活个人提示词模板版本
+// @Summary 激活个人提示词模板版本
+// @Description 把自己的某个模板版本设为该类型当前生效的版本（同类型的其他个人版本取消激活）
+// @Tags Prompt
+// @Produce json
+// @Param id path int true "模板版本 ID"
+// @Success 200 {object} ResponseData
+// @Failure 404 {object} map[string]string "prompt template not found"
+// @Failure 500 {object} map[string]string "server error"
+// @Router /api/v1/prompts/{id}/activate [post]
+func ActivatePromptTemplate(c *gin.Context) {
+	_UserID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(500, gin.H{"error": "failed to get user ID"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "prompt template not found"})
+		return
+	}
+	t, err := mysql.GetPromptTemplate(id)
+	if err != nil {
+		writePromptTemplateError(c, err)
+		return
+	}
+	// 其他用户或全局 / 项目的模板对普通用户不可见
+	if t.Scope != models.PromptScopeUser || t.ScopeID != strconv.FormatUint(_UserID.(uint64), 10) {
+		c.JSON(404, gin.H{"error": "prompt template not found"})
+		return
+	}
+	activatePromptTemplate(c, id)
+}
+
+// createPromptTemplate 校验模板内容并在 req 指定的范围下创建新版本
+func createPromptTemplate(c *gin.Context, req models.PromptTemplateRequest, createdBy uint64) {
+	variables, err := prompt.Parse(req.Name, req.Content)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	t := models.PromptTemplate{
+		Name:      req.Name,
+		Scope:     req.Scope,
+		ScopeID:   req.ScopeID,
+		Content:   req.Content,
+		Variables: variables,
+		CreatedBy: createdBy,
+	}
+	if err := mysql.CreatePromptTemplate(&t, req.Activate); err != nil {
+		log.Printf("Failed to create prompt template %s (%s:%s): %v", t.Name, t.Scope, t.ScopeID, err)
+		c.JSON(500, gin.H{"error": "failed to create prompt template"})
+		return
+	}
+	ResponseSuccess(c, t)
+}
+
+func activatePromptTemplate(c *gin.Context, id uint64) {
+	t, err := mysql.ActivatePromptTemplate(id)
+	if err != nil {
+		writePromptTemplateError(c, err)
+		return
+	}
+	ResponseSuccess(c, t)
+}
+
+// validPromptName name 为空表示不过滤；未知类型时返回 400
+func validPromptName(c *gin.Context, name string) bool {
+	for _, n := range prompt.Names() {
+		if n == name {
+			return true
+		}
+	}
+	if name == "" {
+		return true
+	}
+	c.JSON(400, gin.H{"error": "unknown prompt template name"})
+	return false
+}
+
+func writePromptTemplateError(c *gin.Context, err error) {
+	if errors.Is(err, mysql.ErrPromptTemplateNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Prompt template operation failed: %v", err)
+	c.JSON(500, gin.H{"error": "prompt template operation failed"})
+}
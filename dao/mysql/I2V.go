@@ -1,14 +1,39 @@
 package mysql
 
 import (
+	"encoding/json"
 	"time"
+
+	"V2V/models"
 )
 
-// InsertI2VTask 插入一条 I2V 任务记录
-func InsertI2VTask(taskID int, index int, video_id string, userID uint64, prompt string) error {
-	query := "INSERT INTO i2v_task_main (task_id, user_id, status, video_id, `index`, prompt, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+// InsertI2VTask 插入一条 I2V 任务记录（含对应的镜号、本次生成使用的参数与提示词模板版本）；shotNo 为 0 时写 NULL。
+// 同一子任务（video_id）重复插入时只更新 updated_at，任务重试时可以再次调用
+func InsertI2VTask(taskID int, index int, shotNo int, video_id string, userID uint64, prompt string, opts models.VideoOptions, ref *models.PromptRef) error {
+	query := "INSERT INTO i2v_task_main (task_id, user_id, status, video_id, `index`, shot_no, prompt, options, prompt_template_id, prompt_template_version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE updated_at = VALUES(updated_at)"
 	now := time.Now()
-	_, err := Db.Exec(query, taskID, userID, "pending", video_id, index, prompt, now, now)
+	var shot interface{}
+	if shotNo > 0 {
+		shot = shotNo
+	}
+	templateID, templateVersion := promptRefColumns(ref)
+	_, err := Db.Exec(query, taskID, userID, "pending", video_id, index, shot, prompt, optionsJSON(opts), templateID, templateVersion, now, now)
+	return err
+}
+
+// optionsJSON 把生成参数序列化为 JSON 列的值；序列化失败时写 NULL
+func optionsJSON(opts interface{}) interface{} {
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// UpdateI2VTaskStatus 记录子任务的失败终态（failed / cancelled / timed_out）与原因
+func UpdateI2VTaskStatus(video_id string, status string, errMsg string) error {
+	query := `UPDATE i2v_task_main SET status = ?, error_message = ?, updated_at = ? WHERE video_id = ?`
+	_, err := Db.Exec(query, status, errMsg, time.Now(), video_id)
 	return err
 }
 
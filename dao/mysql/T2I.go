@@ -8,9 +8,27 @@ import (
 
 // InsertT2ITask 将 T2I 任务写入数据库表 t2i_tasks
 func InsertT2ITask(task *models.T2ITask) error {
-	query := `INSERT INTO t2i_tasks (task_id, user_id, status, token, image_url, prompt, error_message, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO t2i_tasks (task_id, user_id, v2t_task_id, mode, status, token, image_url, shot_numbers, shot_errors, prompt, options, error_message, attempts, prompt_template_id, prompt_template_version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
+	templateID, templateVersion := promptRefColumns(task.PromptTemplate)
 	// image_url 对应 models.T2ITask.Result
-	_, err := Db.Exec(query, task.TaskID, task.UserID, task.Status, task.Token, task.Result, task.Prompt, "", now, now)
+	// 没有记录来源 V2T 任务时写 NULL
+	var v2tTaskID interface{}
+	if task.V2TTaskID != 0 {
+		v2tTaskID = task.V2TTaskID
+	}
+	mode := task.Mode
+	if mode == "" {
+		mode = models.T2IModeSequential
+	}
+	// shot_numbers / shot_errors 只在 per_shot 模式下有值，否则写 NULL
+	var shotNumbers, shotErrors interface{}
+	if len(task.ShotNumbers) > 0 {
+		shotNumbers = optionsJSON(task.ShotNumbers)
+	}
+	if len(task.ShotErrors) > 0 {
+		shotErrors = optionsJSON(task.ShotErrors)
+	}
+	_, err := Db.Exec(query, task.TaskID, task.UserID, v2tTaskID, mode, task.Status, task.Token, task.Result, shotNumbers, shotErrors, task.Prompt, optionsJSON(task.Options), "", attemptsJSON(task.Attempts), templateID, templateVersion, now, now)
 	return err
 }
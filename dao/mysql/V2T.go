@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"encoding/json"
 	"time"
 
 	"V2V/models"
@@ -8,12 +9,27 @@ import (
 
 // InsertV2TTask 插入一条 V2T 任务记录
 func InsertV2TTask(task *models.V2TTask) error {
-	query := `INSERT INTO t_v2t_tasks (task_id, user_id, status, result, video_url, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO t_v2t_tasks (task_id, user_id, status, result, video_url, video_file, attempts, prompt_template_id, prompt_template_version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
-	videoURL := ""
-	if (task.V2TRequest != models.V2TRequest{}) {
-		videoURL = task.V2TRequest.VideoURL
+	videoURL := task.V2TRequest.VideoURL
+	// 直接上传的视频记录本地存储路径，没有上传时写 NULL
+	var videoFile interface{}
+	if f := task.V2TRequest.VideoFile; f != nil {
+		videoFile = f.Path
 	}
-	_, err := Db.Exec(query, task.TaskID, task.UserID, task.Status, task.Result, videoURL, now, now)
+	templateID, templateVersion := promptRefColumns(task.PromptTemplate)
+	_, err := Db.Exec(query, task.TaskID, task.UserID, task.Status, task.Result, videoURL, videoFile, attemptsJSON(task.Attempts), templateID, templateVersion, now, now)
 	return err
 }
+
+// attemptsJSON 把重试历史序列化为 JSON 列的值；没有失败记录时写 NULL
+func attemptsJSON(attempts []models.TaskAttempt) interface{} {
+	if len(attempts) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(attempts)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
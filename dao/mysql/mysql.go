@@ -1,7 +1,8 @@
 package mysql
 
 import (
-	"fmt"
+	"V2V/settings"
+	"context"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
@@ -10,18 +11,22 @@ import (
 var Db *sqlx.DB
 
 // Init 初始化MySQL连接
-func Init() (err error) {
+func Init(cfg *settings.MySQLConfig) (err error) {
 	// "user:password@tcp(host:port)/dbname"
-	dsn := fmt.Sprintf("root:123456@tcp(192.168.1.50:3306)/V2V?parseTime=true&loc=Local")
-	Db, err = sqlx.Connect("mysql", dsn)
+	Db, err = sqlx.Connect("mysql", cfg.DSN())
 	if err != nil {
 		return
 	}
-	Db.SetMaxOpenConns(32)
-	Db.SetMaxIdleConns(16)
+	Db.SetMaxOpenConns(cfg.MaxOpenConns)
+	Db.SetMaxIdleConns(cfg.MaxIdleConns)
 	return
 }
 
+// Ping 检查MySQL连接是否可用
+func Ping(ctx context.Context) error {
+	return Db.PingContext(ctx)
+}
+
 // Close 关闭MySQL连接
 func Close() {
 	_ = Db.Close()
@@ -0,0 +1,175 @@
+package mysql
+
+import (
+	"V2V/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPromptTemplateNotFound 模板不存在
+var ErrPromptTemplateNotFound = errors.New("prompt template not found")
+
+const promptTemplateColumns = "id, name, scope, scope_id, version, content, variables, active, created_by, created_at"
+
+// promptTemplateRow variables 列为 JSON，扫描后再解析到 models.PromptTemplate.Variables
+type promptTemplateRow struct {
+	models.PromptTemplate
+	VariablesJSON sql.NullString `db:"variables"`
+}
+
+func (r promptTemplateRow) template() models.PromptTemplate {
+	t := r.PromptTemplate
+	t.Variables = []string{}
+	if r.VariablesJSON.Valid {
+		_ = json.Unmarshal([]byte(r.VariablesJSON.String), &t.Variables)
+	}
+	return t
+}
+
+func promptTemplates(rows []promptTemplateRow) []models.PromptTemplate {
+	out := make([]models.PromptTemplate, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.template())
+	}
+	return out
+}
+
+// GetPromptTemplate 按 ID 获取模板版本
+func GetPromptTemplate(id uint64) (*models.PromptTemplate, error) {
+	var row promptTemplateRow
+	err := Db.Get(&row, "SELECT "+promptTemplateColumns+" FROM t_prompt_templates WHERE id = ?", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+	t := row.template()
+	return &t, nil
+}
+
+// ListPromptTemplates 列出模板版本，name / scope 为空时不按该条件过滤；scope 非空时同时按 scopeID 过滤
+func ListPromptTemplates(name, scope, scopeID string) ([]models.PromptTemplate, error) {
+	query := "SELECT " + promptTemplateColumns + " FROM t_prompt_templates WHERE 1 = 1"
+	var args []interface{}
+	if name != "" {
+		query += " AND name = ?"
+		args = append(args, name)
+	}
+	if scope != "" {
+		query += " AND scope = ? AND scope_id = ?"
+		args = append(args, scope, scopeID)
+	}
+	query += " ORDER BY name, scope, scope_id, version DESC"
+	var rows []promptTemplateRow
+	if err := Db.Select(&rows, query, args...); err != nil {
+		return nil, err
+	}
+	return promptTemplates(rows), nil
+}
+
+// GetActivePromptTemplates 返回对该用户 / 项目可能生效的激活版本（global、该项目、该用户各最多一个）
+func GetActivePromptTemplates(name string, userID uint64, project string) ([]models.PromptTemplate, error) {
+	query := "SELECT " + promptTemplateColumns + ` FROM t_prompt_templates
+	WHERE name = ? AND active = 1 AND (
+		scope = ? OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?)
+	)`
+	var rows []promptTemplateRow
+	err := Db.Select(&rows, query, name,
+		models.PromptScopeGlobal,
+		models.PromptScopeUser, fmt.Sprint(userID),
+		models.PromptScopeProject, project)
+	if err != nil {
+		return nil, err
+	}
+	return promptTemplates(rows), nil
+}
+
+// CreatePromptTemplate 在 name + scope + scope_id 下新建一个版本（版本号为当前最大版本 + 1），
+// activate 为 true 时同时把它设为唯一的激活版本；成功后回填 ID、Version、Active 与 CreatedAt
+func CreatePromptTemplate(t *models.PromptTemplate, activate bool) error {
+	variables, err := json.Marshal(t.Variables)
+	if err != nil {
+		return err
+	}
+	tx, err := Db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 锁住同一范围的已有版本，避免并发创建拿到相同的版本号
+	var version int
+	err = tx.Get(&version, `SELECT COALESCE(MAX(version), 0) FROM t_prompt_templates
+	WHERE name = ? AND scope = ? AND scope_id = ? FOR UPDATE`, t.Name, t.Scope, t.ScopeID)
+	if err != nil {
+		return err
+	}
+	version++
+	now := time.Now()
+	if activate {
+		_, err = tx.Exec(`UPDATE t_prompt_templates SET active = 0 WHERE name = ? AND scope = ? AND scope_id = ?`,
+			t.Name, t.Scope, t.ScopeID)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(`INSERT INTO t_prompt_templates (name, scope, scope_id, version, content, variables, active, created_by, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Name, t.Scope, t.ScopeID, version, t.Content, string(variables), activate, t.CreatedBy, now)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	t.ID = uint64(id)
+	t.Version = version
+	t.Active = activate
+	t.CreatedAt = now
+	return nil
+}
+
+// ActivatePromptTemplate 把指定版本设为其 name + scope + scope_id 下唯一的激活版本
+func ActivatePromptTemplate(id uint64) (*models.PromptTemplate, error) {
+	tx, err := Db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var row promptTemplateRow
+	err = tx.Get(&row, "SELECT "+promptTemplateColumns+" FROM t_prompt_templates WHERE id = ? FOR UPDATE", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE t_prompt_templates SET active = (id = ?) WHERE name = ? AND scope = ? AND scope_id = ?`,
+		id, row.Name, row.Scope, row.ScopeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	t := row.template()
+	t.Active = true
+	return &t, nil
+}
+
+// promptRefColumns 任务表 prompt_template_id / prompt_template_version 列的值；没有记录时写 NULL
+func promptRefColumns(ref *models.PromptRef) (id, version interface{}) {
+	if ref == nil {
+		return nil, nil
+	}
+	return ref.ID, ref.Version
+}
@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"time"
+
+	"V2V/models"
+)
+
+// ReplaceV2TShots 用 shots 替换 V2T 任务的分镜（任务重新投递或修改分镜脚本时整体覆盖），shots 为空时只删除
+func ReplaceV2TShots(taskID, userID uint64, shots []models.Shot) error {
+	tx, err := Db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM t_v2t_shots WHERE task_id = ? AND user_id = ?`, taskID, userID); err != nil {
+		return err
+	}
+	query := `INSERT INTO t_v2t_shots (task_id, user_id, shot_no, framing, content, dialogue, camera_move, sound, duration, image_prompt, video_prompt, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	now := time.Now()
+	for _, s := range shots {
+		_, err := tx.Exec(query, taskID, userID, s.ShotNo, s.Framing, s.Content, s.Dialogue, s.CameraMove, s.Sound, s.Duration, s.ImagePrompt, s.VideoPrompt, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetV2TShots 按镜号顺序返回 V2T 任务的分镜
+func GetV2TShots(taskID, userID uint64) ([]models.Shot, error) {
+	var shots []models.Shot
+	err := Db.Select(&shots, `SELECT shot_no, framing, content, dialogue, camera_move, sound, duration, image_prompt, video_prompt
+	FROM t_v2t_shots WHERE task_id = ? AND user_id = ? ORDER BY shot_no`, taskID, userID)
+	return shots, err
+}
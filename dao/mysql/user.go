@@ -12,7 +12,12 @@ import (
 // 把每一步数据库操作封装成函数
 // 待logic层根据业务需求调用
 
-const secret = "huchao.vip"
+var secret string
+
+// SetPasswordSalt 设置密码加密使用的盐（来自配置 auth.password_salt）
+func SetPasswordSalt(salt string) {
+	secret = salt
+}
 
 // encryptPassword 对密码进行加密
 func encryptPassword(data []byte) (result string) {
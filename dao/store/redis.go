@@ -2,6 +2,9 @@ package store
 
 import (
 	"V2V/models"
+	"V2V/settings"
+	"context"
+	"encoding/json"
 	"log"
 	"strconv"
 
@@ -18,9 +21,12 @@ var (
 	Client *redis.Client
 )
 
-func Init(cfg string) (err error) {
+func Init(cfg *settings.RedisConfig) (err error) {
 	Client = redis.NewClient(&redis.Options{
-		Addr: cfg,
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+		PoolSize: cfg.PoolSize,
 	})
 
 	_, err = Client.Ping().Result()
@@ -30,6 +36,11 @@ func Init(cfg string) (err error) {
 	return nil
 }
 
+// Ping 检查Redis连接是否可用
+func Ping(ctx context.Context) error {
+	return Client.WithContext(ctx).Ping().Err()
+}
+
 func GetRedis() *redis.Client {
 	return Client
 }
@@ -42,6 +53,21 @@ func V2TTask(t models.V2TTask) error {
 		"status":    t.Status,
 		"result":    t.Result,
 	}
+	if t.Provider != "" {
+		fields["provider"] = t.Provider
+	}
+	if f := t.V2TRequest.VideoFile; f != nil {
+		fields["video_file"] = f.URL
+		// 本地路径只在服务端使用，下载接口按它读取文件
+		fields["video_path"] = f.Path
+	}
+	setPromptRef(fields, t.PromptTemplate)
+	if len(t.Shots) > 0 {
+		if b, err := json.Marshal(t.Shots); err == nil {
+			fields["shots"] = string(b)
+		}
+	}
+	setAttempts(fields, t.Attempts)
 	// 使用 pipeline（或 TxPipeline）把 HSet 和 Expire 放在同一个请求组里
 	pipe := Client.Pipeline()
 	pipe.HMSet(key, fields) // 或 pipe.HSet(key, fields) 视版本而定
@@ -49,12 +75,68 @@ func V2TTask(t models.V2TTask) error {
 	_, err := pipe.Exec()
 	if err != nil {
 		//日志报错
-		log.Printf("Failed to store task %s: %v", t.TaskID, err)
+		log.Printf("Failed to store task %d: %v", t.TaskID, err)
 		return err
 	}
 	return nil
 }
 
+// setAttempts 把重试历史以 JSON 写入任务 hash 的 attempts 字段（没有失败记录时不写）
+func setAttempts(fields map[string]interface{}, attempts []models.TaskAttempt) {
+	if len(attempts) == 0 {
+		return
+	}
+	if b, err := json.Marshal(attempts); err == nil {
+		fields["attempts"] = string(b)
+	}
+}
+
+// ParseAttempts 解析任务 hash 中的 attempts 字段
+func ParseAttempts(raw string) []models.TaskAttempt {
+	if raw == "" {
+		return nil
+	}
+	var attempts []models.TaskAttempt
+	if err := json.Unmarshal([]byte(raw), &attempts); err != nil {
+		return nil
+	}
+	return attempts
+}
+
+// ParseShots 解析 V2T 任务 hash 中的 shots 字段
+func ParseShots(raw string) []models.Shot {
+	if raw == "" {
+		return nil
+	}
+	var shots []models.Shot
+	if err := json.Unmarshal([]byte(raw), &shots); err != nil {
+		return nil
+	}
+	return shots
+}
+
+// setPromptRef 把任务使用的提示词模板版本以 JSON 写入任务 hash 的 prompt_template 字段
+func setPromptRef(fields map[string]interface{}, ref *models.PromptRef) {
+	if ref == nil {
+		return
+	}
+	if b, err := json.Marshal(ref); err == nil {
+		fields["prompt_template"] = string(b)
+	}
+}
+
+// ParsePromptRef 解析任务 hash 中的 prompt_template 字段
+func ParsePromptRef(raw string) *models.PromptRef {
+	if raw == "" {
+		return nil
+	}
+	var ref models.PromptRef
+	if err := json.Unmarshal([]byte(raw), &ref); err != nil {
+		return nil
+	}
+	return &ref
+}
+
 // func GetTask(taskID string, out interface{}) error {
 
 // 	return json.Unmarshal(b, out)
@@ -72,6 +154,28 @@ func T2ITask(t2iTask models.T2ITask) error {
 		"priority":   t2iTask.Priority,
 		"created_at": t2iTask.CreatedAt,
 	}
+	if t2iTask.V2TTaskID != 0 {
+		fields["v2t_task_id"] = t2iTask.V2TTaskID
+	}
+	if t2iTask.Mode != "" {
+		fields["mode"] = t2iTask.Mode
+	}
+	// per_shot 模式下结果图片对应的镜号与失败的分镜，I2V 默认按 shot_numbers 对应分镜
+	if len(t2iTask.ShotNumbers) > 0 {
+		if b, err := json.Marshal(t2iTask.ShotNumbers); err == nil {
+			fields["shot_numbers"] = string(b)
+		}
+	}
+	if len(t2iTask.ShotErrors) > 0 {
+		if b, err := json.Marshal(t2iTask.ShotErrors); err == nil {
+			fields["shot_errors"] = string(b)
+		}
+	}
+	if b, err := json.Marshal(t2iTask.Options); err == nil {
+		fields["options"] = string(b)
+	}
+	setPromptRef(fields, t2iTask.PromptTemplate)
+	setAttempts(fields, t2iTask.Attempts)
 	// 使用 pipeline（或 TxPipeline）把 HSet 和 Expire 放在同一个请求组里
 	pipe := Client.Pipeline()
 	pipe.HMSet(key, fields) // 或 pipe.HSet(key, fields) 视版本而定
@@ -79,7 +183,7 @@ func T2ITask(t2iTask models.T2ITask) error {
 	_, err := pipe.Exec()
 	if err != nil {
 		//日志报错
-		log.Printf("Failed to store t2i task %s: %v", t2iTask.TaskID, err)
+		log.Printf("Failed to store t2i task %d: %v", t2iTask.TaskID, err)
 		return err
 	}
 
@@ -109,6 +213,20 @@ func I2VTaskVideoURL(taskID string, videoURL string, userId uint64) error {
 	return nil
 }
 
+// GetI2VSubTaskID 返回已为第 index 张分镜创建并记录的视频生成子任务 ID，没有时返回空字符串
+func GetI2VSubTaskID(taskID, index int, userId uint64) (string, error) {
+	key := "user:" + strconv.FormatUint(userId, 10) + ":i2vtask:" + strconv.Itoa(taskID)
+	score := strconv.Itoa(index)
+	ids, err := Client.ZRangeByScore(key, redis.ZRangeBy{Min: score, Max: score}).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+	return ids[0], nil
+}
+
 func I2VTaskID(taskID, index int, callbacktaskID string, userId uint64) error {
 	//将任务存储到redis中
 	key := "user:" + strconv.FormatUint(userId, 10) + ":i2vtask:" + strconv.Itoa(taskID)
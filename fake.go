@@ -0,0 +1,65 @@
+package main
+
+import (
+	"V2V/pkg/fakeprovider"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const roleFakeProviders = "fake-providers"
+
+const fakeUsage = `Usage:
+  v2v fake-providers [flags]
+
+启动本地模拟的 Gemini / 方舟服务（不访问外网），用于 CI 与本地端到端测试。
+将客户端指向它：
+  V2V_GEMINI_BASE_URL=http://127.0.0.1:9900 GEMINI_API_KEY=fake
+  V2V_ARK_BASE_URL=http://127.0.0.1:9900/api/v3 ARK_API_KEY=fake
+
+Flags:
+`
+
+// runFakeProviders 运行模拟服务直到收到 SIGINT / SIGTERM
+func runFakeProviders(args []string) {
+	fs := flag.NewFlagSet(roleFakeProviders, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), fakeUsage)
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "127.0.0.1:9900", "listen address")
+	scriptPath := fs.String("script", "", "延迟 / 失败编排文件（YAML），为空时全部请求立即成功")
+	_ = fs.Parse(args)
+
+	var script fakeprovider.Script
+	if *scriptPath != "" {
+		var err error
+		if script, err = fakeprovider.LoadScript(*scriptPath); err != nil {
+			log.Fatalf("load fake provider script failed: %v", err)
+		}
+	}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           fakeprovider.New(script),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("Fake providers listening on %s", *addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("fake providers: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(shutdownCtx)
+}
@@ -20,6 +20,7 @@ require (
 	github.com/volcengine/volcengine-go-sdk v1.1.42
 	go.uber.org/zap v1.27.0
 	google.golang.org/genai v1.32.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -82,5 +83,4 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240903143218-8af14fe29dc1 // indirect
 	google.golang.org/grpc v1.66.2 // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
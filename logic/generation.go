@@ -0,0 +1,169 @@
+package logic
+
+import (
+	"V2V/models"
+	"V2V/settings"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// T2I / I2V 生成参数的补全与校验：请求中未填写的字段使用配置 generation 的默认值，
+// 填写的字段必须在用户 VIP 等级允许的范围内。补全后的参数随任务进入队列并保存。
+
+var generationConf settings.GenerationConfig
+
+// InitGeneration 注入生成参数配置
+func InitGeneration(cfg settings.GenerationConfig) {
+	generationConf = cfg
+}
+
+// 与具体 VIP 等级无关的取值范围
+var (
+	imageAspectRatios = []string{"1:1", "4:3", "3:4", "16:9", "9:16", "3:2", "2:3", "21:9"}
+	videoAspectRatios = []string{"adaptive", "1:1", "4:3", "3:4", "16:9", "9:16", "21:9"}
+)
+
+const (
+	minSeed          = -1
+	maxSeed          = 1<<32 - 1
+	minVideoDuration = 2
+)
+
+// generationLevel 返回 vip_level 不超过 vipLevel 的最高一档（配置校验保证至少有 vip_level 0）
+func generationLevel(vipLevel uint8) settings.GenerationLevel {
+	var best settings.GenerationLevel
+	found := false
+	for _, l := range generationConf.Levels {
+		if l.VIPLevel <= vipLevel && (!found || l.VIPLevel > best.VIPLevel) {
+			best, found = l, true
+		}
+	}
+	return best
+}
+
+// ResolveImageOptions 按用户 VIP 等级校验 T2I 参数并补全默认值，参数不允许时返回的错误可直接返回给前端
+func ResolveImageOptions(vipLevel uint8, opts models.ImageOptions) (models.ImageOptions, error) {
+	level := generationLevel(vipLevel)
+	def := generationConf.Image
+	if opts.Model == "" {
+		opts.Model = def.Model
+	} else if !contains(level.ImageModels, opts.Model) {
+		return opts, fmt.Errorf("model %q is not available for VIP level %d", opts.Model, vipLevel)
+	}
+	if opts.Size == "" {
+		opts.Size = def.Size
+	} else if !contains(level.ImageSizes, opts.Size) {
+		return opts, fmt.Errorf("size %q is not available for VIP level %d", opts.Size, vipLevel)
+	}
+	if opts.AspectRatio == "" {
+		opts.AspectRatio = def.AspectRatio
+	} else if !contains(imageAspectRatios, opts.AspectRatio) {
+		return opts, fmt.Errorf("unsupported aspect_ratio %q", opts.AspectRatio)
+	}
+	if opts.Count == 0 {
+		opts.Count = min(def.Count, level.MaxImages)
+	} else if opts.Count < 1 || opts.Count > level.MaxImages {
+		return opts, fmt.Errorf("count must be in 1-%d for VIP level %d", level.MaxImages, vipLevel)
+	}
+	seed, err := resolveSeed(opts.Seed, def.Seed)
+	if err != nil {
+		return opts, err
+	}
+	opts.Seed = &seed
+	watermark, err := resolveWatermark(opts.Watermark, def.Watermark, level, vipLevel)
+	if err != nil {
+		return opts, err
+	}
+	opts.Watermark = &watermark
+	return opts, nil
+}
+
+// ResolveVideoOptions 按用户 VIP 等级校验 I2V 参数并补全默认值，参数不允许时返回的错误可直接返回给前端
+func ResolveVideoOptions(vipLevel uint8, opts models.VideoOptions) (models.VideoOptions, error) {
+	level := generationLevel(vipLevel)
+	def := generationConf.Video
+	if opts.Model == "" {
+		opts.Model = def.Model
+	} else if !contains(level.VideoModels, opts.Model) {
+		return opts, fmt.Errorf("model %q is not available for VIP level %d", opts.Model, vipLevel)
+	}
+	if opts.Resolution == "" {
+		opts.Resolution = def.Resolution
+	} else if !contains(level.Resolutions, opts.Resolution) {
+		return opts, fmt.Errorf("resolution %q is not available for VIP level %d", opts.Resolution, vipLevel)
+	}
+	if opts.AspectRatio == "" {
+		opts.AspectRatio = def.AspectRatio
+	} else if !contains(videoAspectRatios, opts.AspectRatio) {
+		return opts, fmt.Errorf("unsupported aspect_ratio %q", opts.AspectRatio)
+	}
+	// 请求与配置都没有指定的参数保持为空，不发送给服务
+	if opts.Duration == 0 {
+		if def.Duration > 0 {
+			opts.Duration = min(def.Duration, level.MaxDuration)
+		}
+	} else if opts.Duration < minVideoDuration || opts.Duration > level.MaxDuration {
+		return opts, fmt.Errorf("duration must be in %d-%d seconds for VIP level %d", minVideoDuration, level.MaxDuration, vipLevel)
+	}
+	if opts.Seed == nil {
+		opts.Seed = def.Seed
+	} else if _, err := resolveSeed(opts.Seed, 0); err != nil {
+		return opts, err
+	}
+	// 未配置默认值时服务默认加水印，同样只有允许去水印的等级可以关闭
+	if opts.Watermark == nil {
+		opts.Watermark = def.Watermark
+	} else if _, err := resolveWatermark(opts.Watermark, def.Watermark == nil || *def.Watermark, level, vipLevel); err != nil {
+		return opts, err
+	}
+	if opts.CameraFixed == nil {
+		opts.CameraFixed = def.CameraFixed
+	}
+	return opts, nil
+}
+
+// ShotVideoOptions 按分镜调整单个子任务的生成参数：请求未指定时长时使用分镜的时长（取整并限制在等级允许的范围内），
+// 未指定是否固定镜头时按分镜的运镜方式判断。requested 为请求中的原始参数，resolved 为 ResolveVideoOptions 的结果
+func ShotVideoOptions(vipLevel uint8, requested, resolved models.VideoOptions, shot models.Shot) models.VideoOptions {
+	opts := resolved
+	if requested.Duration == 0 && shot.Duration > 0 {
+		level := generationLevel(vipLevel)
+		opts.Duration = min(max(int(math.Round(shot.Duration)), minVideoDuration), level.MaxDuration)
+	}
+	if requested.CameraFixed == nil && shot.CameraMove != "" {
+		fixed := strings.Contains(shot.CameraMove, "固定") || strings.Contains(shot.CameraMove, "静止")
+		opts.CameraFixed = &fixed
+	}
+	return opts
+}
+
+func resolveSeed(seed *int64, def int64) (int64, error) {
+	if seed == nil {
+		return def, nil
+	}
+	if *seed < minSeed || *seed > maxSeed {
+		return 0, fmt.Errorf("seed must be in %d-%d", minSeed, int64(maxSeed))
+	}
+	return *seed, nil
+}
+
+// resolveWatermark 关闭水印需要等级允许；打开水印总是允许
+func resolveWatermark(watermark *bool, def bool, level settings.GenerationLevel, vipLevel uint8) (bool, error) {
+	if watermark == nil {
+		return def, nil
+	}
+	if !*watermark && def && !level.RemoveWatermark {
+		return false, fmt.Errorf("removing the watermark is not available for VIP level %d", vipLevel)
+	}
+	return *watermark, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package logic
+
+import (
+	"V2V/models"
+	"V2V/settings"
+	"testing"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestResolveVideoOptionsWatermark(t *testing.T) {
+	levels := []settings.GenerationLevel{
+		{VIPLevel: 0, Resolutions: []string{"720p"}, MaxDuration: 5},
+		{VIPLevel: 2, Resolutions: []string{"720p"}, MaxDuration: 10, RemoveWatermark: true},
+	}
+	tests := []struct {
+		name         string
+		defWatermark *bool
+		vipLevel     uint8
+		watermark    *bool
+		wantErr      bool
+		want         *bool
+	}{
+		{name: "unset default, vip 0 cannot remove", vipLevel: 0, watermark: boolPtr(false), wantErr: true},
+		{name: "default on, vip 0 cannot remove", defWatermark: boolPtr(true), vipLevel: 0, watermark: boolPtr(false), wantErr: true},
+		{name: "unset default, vip 2 can remove", vipLevel: 2, watermark: boolPtr(false), want: boolPtr(false)},
+		{name: "default off, vip 0 may keep it off", defWatermark: boolPtr(false), vipLevel: 0, watermark: boolPtr(false), want: boolPtr(false)},
+		{name: "vip 0 can ask for a watermark", vipLevel: 0, watermark: boolPtr(true), want: boolPtr(true)},
+		{name: "unset default and request is not sent", vipLevel: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitGeneration(settings.GenerationConfig{
+				Video:  settings.VideoDefaults{Resolution: "720p", Watermark: tt.defWatermark},
+				Levels: levels,
+			})
+			opts, err := ResolveVideoOptions(tt.vipLevel, models.VideoOptions{Watermark: tt.watermark})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("watermark %v accepted for VIP level %d", *tt.watermark, tt.vipLevel)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveVideoOptions: %v", err)
+			}
+			if (opts.Watermark == nil) != (tt.want == nil) || (opts.Watermark != nil && *opts.Watermark != *tt.want) {
+				t.Fatalf("watermark = %v, want %v", opts.Watermark, tt.want)
+			}
+		})
+	}
+}
+
+func TestShotVideoOptionsDuration(t *testing.T) {
+	InitGeneration(settings.GenerationConfig{
+		Video:  settings.VideoDefaults{Resolution: "720p"},
+		Levels: []settings.GenerationLevel{{VIPLevel: 0, MaxDuration: 5}, {VIPLevel: 1, MaxDuration: 2}},
+	})
+	tests := []struct {
+		name      string
+		vipLevel  uint8
+		requested int
+		shot      float64
+		want      int
+	}{
+		{name: "shot duration rounded", shot: 3.4, want: 3},
+		{name: "short shot raised to minimum", shot: 0.5, want: 2},
+		{name: "long shot capped at level", shot: 8, want: 5},
+		{name: "level limit at minimum", vipLevel: 1, shot: 4, want: 2},
+		{name: "requested duration wins", requested: 4, shot: 2, want: 4},
+		{name: "shot without duration", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested := models.VideoOptions{Duration: tt.requested}
+			opts := ShotVideoOptions(tt.vipLevel, requested, requested, models.Shot{Duration: tt.shot})
+			if opts.Duration != tt.want {
+				t.Fatalf("duration = %d, want %d", opts.Duration, tt.want)
+			}
+		})
+	}
+}
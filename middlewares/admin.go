@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuthMiddleware 运维管理接口认证：请求头 X-Admin-Token 必须与配置的 admin.token 一致。
+// 未配置 token 时管理接口整体禁用，避免默认暴露。
+func AdminAuthMiddleware(token string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin API disabled (admin.token not configured)"})
+			return
+		}
+		got := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,4 @@
+-- Migration: record retry attempt history on V2T / T2I tasks
+-- attempts 为 JSON 数组：[{"attempt":1,"error":"...","failed_at":"...","retry_at":"..."}]，没有失败过时为 NULL
+ALTER TABLE `t_v2t_tasks` ADD COLUMN `attempts` JSON NULL COMMENT '失败重试历史' AFTER `video_url`;
+ALTER TABLE `t2i_tasks` ADD COLUMN `attempts` JSON NULL COMMENT '失败重试历史' AFTER `error_message`;
@@ -0,0 +1,3 @@
+-- Migration: link directly uploaded videos to V2T tasks
+-- video_file 为上传视频的本地存储路径（通过 video_url 提交的任务为 NULL）
+ALTER TABLE `t_v2t_tasks` ADD COLUMN `video_file` VARCHAR(1024) NULL COMMENT '上传视频的存储路径' AFTER `video_url`;
@@ -0,0 +1,4 @@
+-- Migration: record per-request generation parameters on T2I / I2V tasks
+-- options 为补全默认值后的生成参数 JSON，如 {"size":"1K","seed":42,"watermark":true,"count":15}
+ALTER TABLE `t2i_tasks` ADD COLUMN `options` JSON NULL COMMENT '生成参数' AFTER `prompt`;
+ALTER TABLE `i2v_task_main` ADD COLUMN `options` JSON NULL COMMENT '生成参数' AFTER `prompt`;
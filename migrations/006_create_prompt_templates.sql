@@ -0,0 +1,28 @@
+-- Migration: versioned prompt templates for storyboard analysis / T2I / I2V
+-- 每行是一个模板版本（创建后不再修改）；同一 name + scope + scope_id 下最多一个 active = 1
+CREATE TABLE IF NOT EXISTS `t_prompt_templates` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(32) NOT NULL COMMENT '模板类型：v2t / t2i / i2v',
+  `scope` VARCHAR(16) NOT NULL COMMENT '作用范围：global / project / user',
+  `scope_id` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '用户 ID 或项目标识，global 为空',
+  `version` INT NOT NULL COMMENT '版本号，同一 name + scope + scope_id 内递增',
+  `content` MEDIUMTEXT COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '模板内容（text/template 语法）',
+  `variables` JSON NULL COMMENT '模板引用的变量',
+  `active` TINYINT(1) NOT NULL DEFAULT 0 COMMENT '是否为当前生效版本',
+  `created_by` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '创建者用户 ID，管理接口创建为 0',
+  `created_at` DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_name_scope_version` (`name`, `scope`, `scope_id`, `version`),
+  KEY `idx_active` (`name`, `active`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 任务记录使用的模板版本（0 表示内置模板，NULL 为本迁移之前的任务）
+ALTER TABLE `t_v2t_tasks`
+  ADD COLUMN `prompt_template_id` BIGINT UNSIGNED NULL COMMENT '提示词模板 ID',
+  ADD COLUMN `prompt_template_version` INT NULL COMMENT '提示词模板版本';
+ALTER TABLE `t2i_tasks`
+  ADD COLUMN `prompt_template_id` BIGINT UNSIGNED NULL COMMENT '提示词模板 ID',
+  ADD COLUMN `prompt_template_version` INT NULL COMMENT '提示词模板版本';
+ALTER TABLE `i2v_task_main`
+  ADD COLUMN `prompt_template_id` BIGINT UNSIGNED NULL COMMENT '提示词模板 ID',
+  ADD COLUMN `prompt_template_version` INT NULL COMMENT '提示词模板版本';
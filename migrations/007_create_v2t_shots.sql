@@ -0,0 +1,21 @@
+-- Migration: structured storyboard shots produced by V2T
+-- 每行是 V2T 分镜脚本中的一个镜头，后续 T2I / I2V 可以按镜号引用
+CREATE TABLE IF NOT EXISTS `t_v2t_shots` (
+  `task_id` BIGINT NOT NULL COMMENT 'V2T 任务 ID',
+  `user_id` BIGINT NOT NULL,
+  `shot_no` INT NOT NULL COMMENT '镜号',
+  `framing` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '景别',
+  `content` TEXT COLLATE utf8mb4_unicode_ci COMMENT '画面内容',
+  `dialogue` TEXT COLLATE utf8mb4_unicode_ci COMMENT '台词 / 旁白',
+  `camera_move` TEXT COLLATE utf8mb4_unicode_ci COMMENT '运镜方式',
+  `sound` TEXT COLLATE utf8mb4_unicode_ci COMMENT '音效',
+  `duration` DECIMAL(6,2) NOT NULL DEFAULT 0 COMMENT '时长（秒）',
+  `image_prompt` TEXT COLLATE utf8mb4_unicode_ci COMMENT '图片生成提示词',
+  `video_prompt` TEXT COLLATE utf8mb4_unicode_ci COMMENT '视频生成提示词',
+  `created_at` DATETIME DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`task_id`, `shot_no`),
+  KEY `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- T2I 任务记录其分镜来自哪个 V2T 任务
+ALTER TABLE `t2i_tasks` ADD COLUMN `v2t_task_id` BIGINT NULL COMMENT '分镜来源的 V2T 任务 ID' AFTER `user_id`;
@@ -0,0 +1,3 @@
+-- Migration: record which storyboard shot each I2V sub-task renders
+-- index 为参考图在 T2I 结果中的序号，shot_no 为其对应的分镜镜号（分镜不可用时为 NULL）
+ALTER TABLE `i2v_task_main` ADD COLUMN `shot_no` INT NULL COMMENT '分镜镜号' AFTER `index`;
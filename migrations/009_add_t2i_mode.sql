@@ -0,0 +1,6 @@
+-- Migration: per-shot image generation mode for T2I
+-- sequential：一次调用按分镜数生成一组图片；per_shot：每个分镜单独生成一张图片
+ALTER TABLE `t2i_tasks`
+  ADD COLUMN `mode` VARCHAR(16) NOT NULL DEFAULT 'sequential' COMMENT '生图模式：sequential / per_shot' AFTER `v2t_task_id`,
+  ADD COLUMN `shot_numbers` JSON NULL COMMENT 'per_shot 模式下第 i 张图片对应的镜号' AFTER `image_url`,
+  ADD COLUMN `shot_errors` JSON NULL COMMENT 'per_shot 模式下生成失败的分镜与原因' AFTER `shot_numbers`;
@@ -0,0 +1,3 @@
+-- Migration: one row per video generation sub-task
+-- I2V 任务在子任务创建后重试时会再次写入同一 video_id，唯一键让写入幂等
+ALTER TABLE `i2v_task_main` ADD UNIQUE KEY `uk_i2v_video_id` (`video_id`);
@@ -1,7 +1,48 @@
 package models
 
+// I2V 子任务（单个分镜的视频生成）状态，与 Ark 返回的状态一致；timed_out 为轮询超过截止时间后本地标记的终态
+const (
+	I2VSubTaskQueued    = "queued"
+	I2VSubTaskRunning   = "running"
+	I2VSubTaskSucceeded = "succeeded"
+	I2VSubTaskFailed    = "failed"
+	I2VSubTaskCancelled = "cancelled"
+	I2VSubTaskTimedOut  = "timed_out"
+)
+
+// IsI2VSubTaskTerminal 子任务是否已到终态（之后不会再变化）
+func IsI2VSubTaskTerminal(status string) bool {
+	switch status {
+	case I2VSubTaskSucceeded, I2VSubTaskFailed, I2VSubTaskCancelled, I2VSubTaskTimedOut:
+		return true
+	}
+	return false
+}
+
 type I2VRequest struct {
 	TaskID string `json:"task_id"`
+	// Options 生成参数，未填写的字段使用配置的默认值
+	Options VideoOptions `json:"options"`
+	// Project 项目标识（由调用方自定义），用于匹配项目级的提示词模板
+	Project string `json:"project,omitempty"`
+	// ShotNumbers 第 i 张参考图对应的分镜镜号；为空时参考图与分镜按顺序一一对应（两者数量必须一致）
+	ShotNumbers []int `json:"shot_numbers,omitempty"`
+}
+
+// VideoOptions I2V 生成参数；提交时按用户 VIP 等级校验并补全默认值后随任务保存
+type VideoOptions struct {
+	Model string `json:"model,omitempty"`
+	// Resolution 480p / 720p / 1080p
+	Resolution string `json:"resolution,omitempty"`
+	// AspectRatio 如 16:9，adaptive 表示跟随参考图
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+	// Seed -1 表示随机
+	Seed      *int64 `json:"seed,omitempty"`
+	Watermark *bool  `json:"watermark,omitempty"`
+	// Duration 每个分镜视频的时长（秒）
+	Duration int `json:"duration,omitempty"`
+	// CameraFixed 是否固定镜头
+	CameraFixed *bool `json:"camera_fixed,omitempty"`
 }
 
 type I2VTask struct {
@@ -12,6 +53,14 @@ type I2VTask struct {
 	ImageURL  string `json:"image_url"`
 	Priority  int    `json:"priority,omitempty"`
 	CreatedAt int64  `json:"created_at,omitempty"`
+	// ShotNo 参考图对应的分镜镜号，Prompt 为该分镜的视频生成提示词；为 0 时分镜不可用，Prompt 为整段分镜脚本
+	ShotNo int `json:"shot_no,omitempty"`
+	// CameraMove 分镜的运镜方式
+	CameraMove string `json:"camera_move,omitempty"`
+	// Options 补全默认值后的生成参数（时长与是否固定镜头按分镜调整）
+	Options VideoOptions `json:"options"`
+	// PromptTemplate 提交时解析出的图生视频提示词模板版本
+	PromptTemplate *PromptRef `json:"prompt_template,omitempty"`
 }
 
 type I2VResponse struct {
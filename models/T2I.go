@@ -1,7 +1,35 @@
 package models
 
+// T2I 生图模式
+const (
+	// T2IModeSequential 一次调用按整段分镜脚本生成一组图片，图片数与顺序由模型决定（默认）
+	T2IModeSequential = "sequential"
+	// T2IModePerShot 每个分镜按其图片生成提示词单独生成一张图片，结果与分镜一一对应
+	T2IModePerShot = "per_shot"
+)
+
 type T2IRequest struct {
 	TaskID string `json:"task_id"`
+	// Mode 生图模式：sequential（默认）/ per_shot，per_shot 需要 V2T 任务有结构化分镜
+	Mode string `json:"mode,omitempty"`
+	// Options 生成参数，未填写的字段使用配置的默认值
+	Options ImageOptions `json:"options"`
+	// Project 项目标识（由调用方自定义），用于匹配项目级的提示词模板
+	Project string `json:"project,omitempty"`
+}
+
+// ImageOptions T2I 生成参数；提交时按用户 VIP 等级校验并补全默认值后随任务保存
+type ImageOptions struct {
+	Model string `json:"model,omitempty"`
+	// Size 1K / 2K / 4K
+	Size string `json:"size,omitempty"`
+	// AspectRatio 如 16:9、1:1，为空时由模型按提示词决定
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+	// Seed -1 表示随机
+	Seed      *int64 `json:"seed,omitempty"`
+	Watermark *bool  `json:"watermark,omitempty"`
+	// Count 最多生成的图片数
+	Count int `json:"count,omitempty"`
 }
 
 type T2ITask struct {
@@ -14,6 +42,22 @@ type T2ITask struct {
 	Result          string `json:"result"` // 生成的图片URL或base64
 	CreatedAt       int64  `json:"created_at"`
 	GeneratedImages int64  `json:"generated_images"`
+	// V2TTaskID 分镜脚本来源的 V2T 任务，其分镜按镜号保存在 t_v2t_shots
+	V2TTaskID uint64 `json:"v2t_task_id,omitempty"`
+	// Mode 生图模式，为空时同 sequential
+	Mode string `json:"mode,omitempty"`
+	// Shots per_shot 模式下提交时的分镜快照，每个分镜生成一张图片
+	Shots []Shot `json:"shots,omitempty"`
+	// ShotNumbers per_shot 模式下 Result 中第 i 张图片对应的镜号（失败的分镜没有图片）
+	ShotNumbers []int `json:"shot_numbers,omitempty"`
+	// ShotErrors per_shot 模式下生成失败的分镜
+	ShotErrors []ShotError `json:"shot_errors,omitempty"`
+	// Options 补全默认值后的生成参数
+	Options ImageOptions `json:"options"`
+	// PromptTemplate 提交时解析出的生图提示词模板版本（per_shot 模式为 t2i_shot 模板）
+	PromptTemplate *PromptRef `json:"prompt_template,omitempty"`
+	// Attempts 失败执行的历史（由队列运行时记录，提交时为空）
+	Attempts []TaskAttempt `json:"attempts,omitempty"`
 }
 
 type T2IResponse struct {
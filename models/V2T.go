@@ -5,10 +5,29 @@ const (
 	StatusProcessing = "processing"
 	StatusCompleted  = "completed"
 	StatusFailed     = "failed"
+	// StatusRetrying 执行失败，等待退避后重试
+	StatusRetrying = "retrying"
 )
 
 type V2TRequest struct {
 	VideoURL string `json:"video_url"`
+	// VideoFile 直接上传的视频（multipart 提交时由服务端填写），与 VideoURL 二选一
+	VideoFile *VideoFile `json:"video_file,omitempty" swaggerignore:"true"`
+	// Provider 指定视频分析服务（gemini / doubao），为空时使用配置的默认服务
+	Provider string `json:"provider,omitempty"`
+	// Project 项目标识（由调用方自定义），用于匹配项目级的提示词模板
+	Project string `json:"project,omitempty"`
+}
+
+// VideoFile 服务端保存的上传视频
+type VideoFile struct {
+	// Path 本地存储路径（worker 从这里读取）
+	Path string `json:"path"`
+	// URL 访问路径（/api/v1/V2T/<task_id>/video，需要登录且只有上传者可以读取）
+	URL         string `json:"url"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
 }
 
 type V2TTask struct {
@@ -18,12 +37,26 @@ type V2TTask struct {
 	Result     string     `json:"result"`
 	Priority   int        `json:"priority,omitempty"`
 	V2TRequest V2TRequest `json:"v2t_request"`
+	// Provider 实际完成分析的服务（主服务失败切换到备用服务时与 V2TRequest.Provider 不同）
+	Provider string `json:"provider,omitempty"`
+	// PromptTemplate 提交时解析出的分镜分析指令模板版本
+	PromptTemplate *PromptRef `json:"prompt_template,omitempty"`
+	// Shots 结构化的分镜（Result 为其 Markdown 表格形式）；模型输出无法解析时为空，Result 保留原文
+	Shots []Shot `json:"shots,omitempty"`
+	// Attempts 失败执行的历史（由队列运行时记录，提交时为空）
+	Attempts []TaskAttempt `json:"attempts,omitempty"`
 }
 
 type V2TResponse struct {
-	TaskID string `json:"task_id"`
-	Status string `json:"status"`
-	Result string `json:"result"`
+	TaskID   string `json:"task_id"`
+	Status   string `json:"status"`
+	Result   string `json:"result"`
+	Provider string `json:"provider,omitempty"`
+	// VideoFile 上传视频的访问路径（通过 video_url 提交时为空）
+	VideoFile      string        `json:"video_file,omitempty"`
+	PromptTemplate *PromptRef    `json:"prompt_template,omitempty"`
+	Shots          []Shot        `json:"shots,omitempty"`
+	Attempts       []TaskAttempt `json:"attempts,omitempty"`
 }
 
 type LoraTextRequest struct {
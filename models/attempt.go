@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TaskAttempt 任务一次失败执行的记录（按时间顺序保存在任务上，便于排查供应商故障）
+type TaskAttempt struct {
+	// Attempt 第几次执行（从 1 开始）
+	Attempt  int       `json:"attempt"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	// RetryAt 计划重试的时间；最后一次失败（进入死信）时为空
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
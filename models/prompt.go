@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// 提示词模板类型
+const (
+	// PromptV2T 视频分析（分镜脚本）指令
+	PromptV2T = "v2t"
+	// PromptT2I 分镜首帧生图提示词
+	PromptT2I = "t2i"
+	// PromptT2IShot 逐镜头生图模式下单个分镜的首帧生图提示词
+	PromptT2IShot = "t2i_shot"
+	// PromptI2V 单个分镜的图生视频提示词
+	PromptI2V = "i2v"
+)
+
+// 提示词模板的作用范围；提交任务时按 user → project → global 的顺序取第一个激活的版本
+const (
+	PromptScopeGlobal  = "global"
+	PromptScopeProject = "project"
+	PromptScopeUser    = "user"
+	// PromptScopeBuiltin 代码内置的默认模板（版本 0），没有激活的模板时使用
+	PromptScopeBuiltin = "builtin"
+)
+
+// PromptTemplate 提示词模板的一个版本；版本创建后内容不再修改，同一 name + scope + scope_id 下最多一个激活版本
+type PromptTemplate struct {
+	ID   uint64 `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// Scope global / project / user
+	Scope string `json:"scope" db:"scope"`
+	// ScopeID user 范围为用户 ID，project 范围为项目标识，global 范围为空
+	ScopeID string `json:"scope_id,omitempty" db:"scope_id"`
+	Version int    `json:"version" db:"version"`
+	// Content text/template 语法，如 {{.storyboard}}
+	Content string `json:"content" db:"content"`
+	// Variables 模板中引用的变量
+	Variables []string  `json:"variables" db:"-"`
+	Active    bool      `json:"active" db:"active"`
+	CreatedBy uint64    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PromptTemplateRequest 创建提示词模板版本的请求
+type PromptTemplateRequest struct {
+	// Name v2t / t2i / t2i_shot / i2v
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// Scope / ScopeID 仅管理接口使用，用户接口固定为当前用户
+	Scope   string `json:"scope,omitempty"`
+	ScopeID string `json:"scope_id,omitempty"`
+	// Activate 创建后立即激活
+	Activate bool `json:"activate"`
+}
+
+// PromptRef 任务使用的提示词模板版本，随任务保存以便复现；ID 为 0 表示内置模板
+type PromptRef struct {
+	ID      uint64 `json:"id"`
+	Name    string `json:"name"`
+	Scope   string `json:"scope"`
+	Version int    `json:"version"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// Shot 分镜脚本中的一个镜头
+type Shot struct {
+	// ShotNo 镜号，从 1 开始
+	ShotNo int `json:"shot_no" db:"shot_no"`
+	// Framing 景别（远景、中景、近景、特写等）
+	Framing string `json:"framing" db:"framing"`
+	// Content 画面内容
+	Content string `json:"content" db:"content"`
+	// Dialogue 台词 / 旁白
+	Dialogue string `json:"dialogue" db:"dialogue"`
+	// CameraMove 运镜方式
+	CameraMove string `json:"camera_move" db:"camera_move"`
+	Sound      string `json:"sound" db:"sound"`
+	// Duration 时长（秒）
+	Duration float64 `json:"duration" db:"duration"`
+	// ImagePrompt 首帧图片生成提示词
+	ImagePrompt string `json:"image_prompt" db:"image_prompt"`
+	// VideoPrompt 由首帧图片生成视频的提示词
+	VideoPrompt string `json:"video_prompt" db:"video_prompt"`
+}
+
+// ShotError 单个分镜的生成失败原因
+type ShotError struct {
+	ShotNo int    `json:"shot_no"`
+	Error  string `json:"error"`
+}
+
+// 分镜脚本的来源格式
+const (
+	// StoryboardJSON 模型按 JSON Schema 输出
+	StoryboardJSON = "json"
+	// StoryboardMarkdown 从 Markdown 分镜表解析
+	StoryboardMarkdown = "markdown"
+)
@@ -0,0 +1,341 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"V2V/pkg/metrics"
+	"V2V/settings"
+
+	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"google.golang.org/genai"
+)
+
+// 外部生成服务（Gemini / Ark）的熔断器，每个 provider 一个，进程内共享：
+//   - closed：正常放行，连续失败达到 failure_threshold 后转为 open；
+//   - open：依赖该 provider 的队列暂停消费（消息留在 RabbitMQ），open_timeout 后转为 half_open；
+//   - half_open：只放行一条消息作为探测，成功则 closed，失败则重新 open 且等待时间翻倍。
+// 只有服务端故障（5xx、429、网络错误、超时）计为失败，参数错误 / 内容审核等 4xx 说明服务可用。
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+var (
+	conf     settings.CircuitBreakerConfig
+	mu       sync.Mutex
+	breakers = make(map[string]*Breaker)
+
+	// changed 任一熔断器状态变化时关闭并替换，唤醒等待中的消费者
+	changedMu sync.Mutex
+	changed   = make(chan struct{})
+)
+
+// Init 注入配置；未调用或 enabled=false 时熔断器始终放行
+func Init(cfg settings.CircuitBreakerConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+	conf = cfg
+}
+
+// For 返回 provider 的熔断器（首次使用时创建）
+func For(provider string) *Breaker {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := breakers[provider]
+	if !ok {
+		b = &Breaker{provider: provider, state: StateClosed}
+		breakers[provider] = b
+	}
+	return b
+}
+
+func config() settings.CircuitBreakerConfig {
+	mu.Lock()
+	defer mu.Unlock()
+	return conf
+}
+
+// Breaker 一个 provider 的熔断器
+type Breaker struct {
+	provider string
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	openFor  time.Duration
+	probing  bool
+	opens    int64
+}
+
+// Status 熔断器当前状态
+type Status struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	// ConsecutiveFailures 当前连续失败次数
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// OpenedAt / ProbeAt 最近一次熔断的时间与下一次允许探测的时间（closed 时为空）
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	ProbeAt  *time.Time `json:"probe_at,omitempty"`
+	// Opens 累计熔断次数
+	Opens int64 `json:"opens"`
+}
+
+// Wait 阻塞到 providers 中任意一个熔断器允许调用（队列依赖多个可互相切换的服务时，全部熔断才暂停）：
+// closed 时立即返回；open 时等待到半开；半开时只有一个调用者获得探测名额。stop 关闭时返回 false。
+// 返回的 done 必须在消息处理结束后调用：探测消息没有实际调用 provider（未 Record）时交还探测名额。
+func Wait(stop <-chan struct{}, providers ...string) (done func(), ok bool) {
+	noop := func() {}
+	for {
+		if !config().Enabled || len(providers) == 0 {
+			return noop, true
+		}
+		// 先取通知 channel 再检查状态，检查之后发生的状态变化不会被错过
+		changed := changes()
+		var wait time.Duration
+		for _, p := range providers {
+			done, ok, w := For(p).tryAcquire()
+			if ok {
+				return done, true
+			}
+			if w > 0 && (wait == 0 || w < wait) {
+				wait = w
+			}
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-stop:
+			ok = false
+		case <-changed:
+			ok = true
+		case <-timeout:
+			ok = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !ok {
+			return noop, false
+		}
+	}
+}
+
+// tryAcquire 不阻塞地尝试放行一次调用；不允许时返回距离半开还需等待的时间（0 表示等待状态变化）
+func (b *Breaker) tryAcquire() (done func(), ok bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		return func() {}, true, 0
+	case StateOpen:
+		if wait = time.Until(b.openedAt.Add(b.openFor)); wait > 0 {
+			return nil, false, wait
+		}
+		b.setState(StateHalfOpen)
+		log.Printf("breaker %s: half-open, letting one probe through", b.provider)
+	}
+	if b.probing {
+		return nil, false, 0
+	}
+	b.probing = true
+	return b.releaseProbe, true, 0
+}
+
+// releaseProbe 探测消息处理结束但没有产生结果时，让下一条消息继续探测
+func (b *Breaker) releaseProbe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen && b.probing {
+		b.probing = false
+		b.notify()
+	}
+}
+
+// Record 记录一次 provider 调用的结果（err 为调用返回的错误）
+func (b *Breaker) Record(err error) {
+	cfg := config()
+	if !cfg.Enabled {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !IsFailure(err) {
+		b.failures = 0
+		if b.state != StateClosed {
+			log.Printf("breaker %s: closed, provider recovered", b.provider)
+			b.setState(StateClosed)
+		}
+		return
+	}
+	b.failures++
+	switch b.state {
+	case StateClosed:
+		if b.failures >= cfg.FailureThreshold {
+			b.open(cfg.OpenTimeout.Duration, err)
+		}
+	case StateHalfOpen:
+		openFor := b.openFor * 2
+		if openFor > cfg.MaxOpenTimeout.Duration {
+			openFor = cfg.MaxOpenTimeout.Duration
+		}
+		b.open(openFor, err)
+	}
+}
+
+func (b *Breaker) open(openFor time.Duration, err error) {
+	b.openedAt = time.Now()
+	b.openFor = openFor
+	b.opens++
+	b.setState(StateOpen)
+	log.Printf("breaker %s: open for %s after %d consecutive failures: %v", b.provider, openFor, b.failures, err)
+}
+
+// setState 切换状态并唤醒等待者，调用方需持有 b.mu
+func (b *Breaker) setState(state string) {
+	b.state = state
+	b.probing = false
+	if state == StateClosed {
+		b.openFor = 0
+	}
+	b.notify()
+}
+
+// notify 唤醒所有等待中的消费者重新检查状态
+func (b *Breaker) notify() {
+	changedMu.Lock()
+	defer changedMu.Unlock()
+	close(changed)
+	changed = make(chan struct{})
+}
+
+func changes() <-chan struct{} {
+	changedMu.Lock()
+	defer changedMu.Unlock()
+	return changed
+}
+
+// AllOpen 判断 providers 的熔断器是否全部处于 open（依赖它们的队列暂停消费中）
+func AllOpen(providers ...string) bool {
+	if !config().Enabled || len(providers) == 0 {
+		return false
+	}
+	for _, p := range providers {
+		if For(p).State() != StateOpen {
+			return false
+		}
+	}
+	return true
+}
+
+// State 返回当前状态
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status 返回当前状态快照
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{
+		Provider:            b.provider,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Opens:               b.opens,
+	}
+	if b.state != StateClosed {
+		openedAt, probeAt := b.openedAt, b.openedAt.Add(b.openFor)
+		s.OpenedAt, s.ProbeAt = &openedAt, &probeAt
+	}
+	return s
+}
+
+// Statuses 返回本进程所有熔断器的状态（按 provider 排序）
+func Statuses() []Status {
+	mu.Lock()
+	list := make([]*Breaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	mu.Unlock()
+	statuses := make([]Status, 0, len(list))
+	for _, b := range list {
+		statuses = append(statuses, b.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Provider < statuses[j].Provider })
+	return statuses
+}
+
+// IsFailure 判断调用错误是否说明 provider 不可用：5xx / 429 / 网络错误 / 超时算失败，
+// 其余 4xx（参数错误、内容审核等）与进程关闭导致的取消不算
+func IsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if code := statusCode(err); code != 0 {
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
+
+// statusCode 从各 SDK 的错误中取出 HTTP 状态码，取不到时返回 0
+func statusCode(err error) int {
+	var gErr genai.APIError
+	if errors.As(err, &gErr) {
+		return gErr.Code
+	}
+	var apiErr *model.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *model.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+func init() {
+	collect := func(value func(s Status) float64) metrics.Collector {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, s := range Statuses() {
+				samples = append(samples, metrics.Sample{
+					Labels: map[string]string{"provider": s.Provider},
+					Value:  value(s),
+				})
+			}
+			return samples
+		}
+	}
+	metrics.RegisterGauge("v2v_breaker_state", "Circuit breaker state per provider (0 closed, 1 half-open, 2 open).",
+		collect(func(s Status) float64 {
+			switch s.State {
+			case StateOpen:
+				return 2
+			case StateHalfOpen:
+				return 1
+			}
+			return 0
+		}))
+	metrics.RegisterGauge("v2v_breaker_consecutive_failures", "Consecutive failed calls to the provider.",
+		collect(func(s Status) float64 { return float64(s.ConsecutiveFailures) }))
+	metrics.RegisterCounter("v2v_breaker_opens_total", "Times the provider circuit breaker has opened.",
+		collect(func(s Status) float64 { return float64(s.Opens) }))
+}
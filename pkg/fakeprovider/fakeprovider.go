@@ -0,0 +1,581 @@
+package fakeprovider
+
+import (
+	"V2V/settings"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 本地模拟的外部生成服务，用于 CI 与本地端到端测试（不访问外网）：
+//   - Gemini generateContent（POST {base}/v1beta/models/{model}:generateContent）
+//   - Gemini Files API（断点续传上传 {base}/upload/v1beta/files，查询 / 删除 {base}/v1beta/files/{id}）
+//   - 方舟 chat completions（POST {base}/chat/completions，豆包视频理解）
+//   - 方舟生图（POST {base}/images/generations）
+//   - 方舟内容生成任务（POST / GET / DELETE {base}/contents/generations/tasks[/{id}]）
+//
+// 方舟的路径按后缀匹配，ark.base_url 可以带任意前缀（如 http://127.0.0.1:9900/api/v3）。
+// 返回的图片 / 视频链接指向本服务的 /media/ 下的样例文件。
+// 每个端点的延迟与失败可以通过 Script 编排；Server 实现 http.Handler，Go 测试中使用 NewTestServer（见 testserver.go）。
+
+// 端点名（Script.Endpoints 的键，也是 Calls 的参数）
+const (
+	EndpointGemini      = "gemini.generate"
+	EndpointFileUpload  = "gemini.files.upload"
+	EndpointFileGet     = "gemini.files.get"
+	EndpointFileDelete  = "gemini.files.delete"
+	EndpointChat        = "ark.chat"
+	EndpointImages      = "ark.images"
+	EndpointTaskCreate  = "ark.tasks.create"
+	EndpointTaskGet     = "ark.tasks.get"
+	EndpointTaskCancel  = "ark.tasks.cancel"
+	endpointMedia       = "media"
+	defaultFailStatus   = http.StatusServiceUnavailable
+	defaultImageCount   = 4
+	defaultTaskDuration = 10 * time.Second
+)
+
+// Rule 一个端点的行为
+type Rule struct {
+	// Latency 每次请求返回前的固定延迟
+	Latency settings.Duration `yaml:"latency"`
+	// FailFirst 前 N 次请求返回错误（确定性，便于测试重试与熔断）
+	FailFirst int `yaml:"fail_first"`
+	// FailureRate 之后的请求以该比例（0-1）随机返回错误
+	FailureRate float64 `yaml:"failure_rate"`
+	// FailStatus 返回错误时的 HTTP 状态码，默认 503
+	FailStatus int `yaml:"fail_status"`
+}
+
+// TaskScript 内容生成任务的行为：创建后前 1/3 时间为 queued，之后 running，到 Duration 时结束
+type TaskScript struct {
+	Duration settings.Duration `yaml:"duration"`
+	// FailureRate 任务以 failed 结束的比例（0-1）
+	FailureRate float64 `yaml:"failure_rate"`
+}
+
+// Script 模拟服务的整体编排
+type Script struct {
+	Endpoints map[string]Rule `yaml:"endpoints"`
+	Tasks     TaskScript      `yaml:"tasks"`
+	// Images 每次生图返回的图片数（不超过请求的 max_images）
+	Images int `yaml:"images"`
+	// Storyboard 视频分析返回的文本，为空时使用内置示例
+	Storyboard string `yaml:"storyboard"`
+	// StoryboardJSON 请求要求 JSON 输出（Gemini responseMimeType / 方舟 response_format）时返回的分镜，为空时使用内置示例
+	StoryboardJSON string `yaml:"storyboard_json"`
+	// SampleVideo 生成任务返回的样例视频文件，为空时用 ffmpeg 生成
+	SampleVideo string `yaml:"sample_video"`
+	// FileProcessing 经 Files API 上传的视频保持 PROCESSING 的时间，为 0 时上传完成即为 ACTIVE
+	FileProcessing settings.Duration `yaml:"file_processing"`
+}
+
+// LoadScript 从 YAML 文件读取编排
+func LoadScript(path string) (Script, error) {
+	var s Script
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return s, nil
+}
+
+type fakeTask struct {
+	id        string
+	model     string
+	createdAt time.Time
+	fail      bool
+	cancelled bool
+}
+
+// fakeFile 经 Files API 上传的文件；size 为已收到的字节数
+type fakeFile struct {
+	id        string
+	mimeType  string
+	size      int64
+	createdAt time.Time
+	finalized bool
+}
+
+// Server 模拟服务
+type Server struct {
+	script Script
+
+	mu    sync.Mutex
+	calls map[string]int
+	tasks map[string]*fakeTask
+	files map[string]*fakeFile
+	seq   int
+
+	mediaOnce sync.Once
+	video     []byte
+	videoErr  error
+}
+
+// New 按编排创建模拟服务
+func New(script Script) *Server {
+	if script.Images <= 0 {
+		script.Images = defaultImageCount
+	}
+	if script.Tasks.Duration.Duration <= 0 {
+		script.Tasks.Duration.Duration = defaultTaskDuration
+	}
+	if script.Storyboard == "" {
+		script.Storyboard = sampleStoryboard
+	}
+	if script.StoryboardJSON == "" {
+		script.StoryboardJSON = sampleStoryboardJSON
+	}
+	return &Server{
+		script: script,
+		calls:  make(map[string]int),
+		tasks:  make(map[string]*fakeTask),
+		files:  make(map[string]*fakeFile),
+	}
+}
+
+// Calls 返回某个端点已收到的请求数
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/media/"):
+		s.serveMedia(w, r)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/upload/v1beta/files"):
+		s.handle(w, r, EndpointFileUpload, s.geminiUpload)
+	case strings.Contains(path, "/v1beta/files/"):
+		id := path[strings.LastIndex(path, "/")+1:]
+		switch r.Method {
+		case http.MethodGet:
+			s.handle(w, r, EndpointFileGet, func(w http.ResponseWriter, r *http.Request) { s.geminiGetFile(w, r, id) })
+		case http.MethodDelete:
+			s.handle(w, r, EndpointFileDelete, func(w http.ResponseWriter, r *http.Request) { s.geminiDeleteFile(w, r, id) })
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case r.Method == http.MethodPost && strings.HasSuffix(path, ":generateContent"):
+		s.handle(w, r, EndpointGemini, s.geminiGenerate)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/chat/completions"):
+		s.handle(w, r, EndpointChat, s.arkChat)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/images/generations"):
+		s.handle(w, r, EndpointImages, s.arkImages)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/contents/generations/tasks"):
+		s.handle(w, r, EndpointTaskCreate, s.arkCreateTask)
+	case strings.Contains(path, "/contents/generations/tasks/"):
+		id := path[strings.LastIndex(path, "/")+1:]
+		switch r.Method {
+		case http.MethodGet:
+			s.handle(w, r, EndpointTaskGet, func(w http.ResponseWriter, r *http.Request) { s.arkGetTask(w, r, id) })
+		case http.MethodDelete:
+			s.handle(w, r, EndpointTaskCancel, func(w http.ResponseWriter, r *http.Request) { s.arkCancelTask(w, r, id) })
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handle 记录调用次数，按编排延迟或返回错误，否则交给 fn
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, endpoint string, fn http.HandlerFunc) {
+	s.mu.Lock()
+	s.calls[endpoint]++
+	n := s.calls[endpoint]
+	s.mu.Unlock()
+
+	rule := s.script.Endpoints[endpoint]
+	if d := rule.Latency.Duration; d > 0 {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if n <= rule.FailFirst || (rule.FailureRate > 0 && rand.Float64() < rule.FailureRate) {
+		status := rule.FailStatus
+		if status == 0 {
+			status = defaultFailStatus
+		}
+		log.Printf("fakeprovider: %s #%d -> scripted %d", endpoint, n, status)
+		writeError(w, endpoint, status, "scripted failure")
+		return
+	}
+	log.Printf("fakeprovider: %s #%d %s %s", endpoint, n, r.Method, r.URL.Path)
+	fn(w, r)
+}
+
+// writeError 按各服务的错误格式返回（SDK 据此解析出状态码与错误信息）
+func writeError(w http.ResponseWriter, endpoint string, status int, msg string) {
+	if strings.HasPrefix(endpoint, "gemini.") {
+		writeJSON(w, status, map[string]any{
+			"error": map[string]any{"code": status, "message": msg, "status": strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))},
+		})
+		return
+	}
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"code": "Fake" + strconv.Itoa(status), "message": msg, "type": "fake"},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) geminiGenerate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GenerationConfig struct {
+			ResponseMIMEType string `json:"responseMimeType"`
+		} `json:"generationConfig"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	text := s.script.Storyboard
+	if req.GenerationConfig.ResponseMIMEType == "application/json" {
+		text = s.script.StoryboardJSON
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"candidates": []any{map[string]any{
+			"content":      map[string]any{"role": "model", "parts": []any{map[string]any{"text": text}}},
+			"finishReason": "STOP",
+		}},
+		"usageMetadata": map[string]any{"promptTokenCount": 100, "candidatesTokenCount": 200, "totalTokenCount": 300},
+	})
+}
+
+// geminiUpload 断点续传上传：start 请求返回上传地址（同一路径带 upload_id），之后按块上传，finalize 时返回文件信息
+func (s *Server) geminiUpload(w http.ResponseWriter, r *http.Request) {
+	command := r.Header.Get("X-Goog-Upload-Command")
+	if command == "start" {
+		var req struct {
+			File struct {
+				MIMEType string `json:"mimeType"`
+			} `json:"file"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f := &fakeFile{id: s.nextID("file"), mimeType: req.File.MIMEType, createdAt: time.Now()}
+		s.mu.Lock()
+		s.files[f.id] = f
+		s.mu.Unlock()
+		w.Header().Set("X-Goog-Upload-URL", baseURL(r)+r.URL.Path+"?upload_id="+f.id)
+		writeJSON(w, http.StatusOK, map[string]any{})
+		return
+	}
+
+	id := r.URL.Query().Get("upload_id")
+	n, _ := io.Copy(io.Discard, r.Body)
+	s.mu.Lock()
+	f, ok := s.files[id]
+	if ok {
+		f.size += n
+		if strings.Contains(command, "finalize") {
+			f.finalized = true
+			f.createdAt = time.Now()
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, EndpointFileUpload, http.StatusNotFound, "upload not found")
+		return
+	}
+	if !f.finalized {
+		w.Header().Set("X-Goog-Upload-Status", "active")
+		writeJSON(w, http.StatusOK, map[string]any{})
+		return
+	}
+	w.Header().Set("X-Goog-Upload-Status", "final")
+	writeJSON(w, http.StatusOK, map[string]any{"file": s.fileJSON(r, f)})
+}
+
+func (s *Server) geminiGetFile(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	f, ok := s.files[id]
+	s.mu.Unlock()
+	if !ok || !f.finalized {
+		writeError(w, EndpointFileGet, http.StatusNotFound, "file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fileJSON(r, f))
+}
+
+func (s *Server) geminiDeleteFile(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	_, ok := s.files[id]
+	delete(s.files, id)
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, EndpointFileDelete, http.StatusNotFound, "file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+// fileJSON 上传完成后 FileProcessing 时间内为 PROCESSING，之后为 ACTIVE
+func (s *Server) fileJSON(r *http.Request, f *fakeFile) map[string]any {
+	state := "ACTIVE"
+	if time.Since(f.createdAt) < s.script.FileProcessing.Duration {
+		state = "PROCESSING"
+	}
+	return map[string]any{
+		"name":       "files/" + f.id,
+		"mimeType":   f.mimeType,
+		"sizeBytes":  strconv.FormatInt(f.size, 10),
+		"createTime": f.createdAt.UTC().Format(time.RFC3339Nano),
+		"uri":        baseURL(r) + "/v1beta/files/" + f.id,
+		"state":      state,
+		"source":     "UPLOADED",
+	}
+}
+
+func (s *Server) arkChat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model          string `json:"model"`
+		ResponseFormat *struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	text := s.script.Storyboard
+	if req.ResponseFormat != nil && req.ResponseFormat.Type != "text" {
+		text = s.script.StoryboardJSON
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      s.nextID("chat"),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   req.Model,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": text},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]any{"prompt_tokens": 100, "completion_tokens": 200, "total_tokens": 300},
+	})
+}
+
+func (s *Server) arkImages(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model                            string `json:"model"`
+		SequentialImageGenerationOptions *struct {
+			MaxImages *int `json:"max_images"`
+		} `json:"sequential_image_generation_options"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	n := 1
+	if o := req.SequentialImageGenerationOptions; o != nil && o.MaxImages != nil {
+		n = min(*o.MaxImages, s.script.Images)
+	}
+	data := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		data = append(data, map[string]any{
+			"url":  fmt.Sprintf("%s/media/image-%d.png", baseURL(r), i),
+			"size": "1024x1024",
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"model":   req.Model,
+		"created": time.Now().Unix(),
+		"data":    data,
+		"usage":   map[string]any{"generated_images": n, "output_tokens": n * 4096, "total_tokens": n * 4096},
+	})
+}
+
+func (s *Server) arkCreateTask(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	t := &fakeTask{
+		id:        s.nextID("cgt"),
+		model:     req.Model,
+		createdAt: time.Now(),
+		fail:      s.script.Tasks.FailureRate > 0 && rand.Float64() < s.script.Tasks.FailureRate,
+	}
+	s.mu.Lock()
+	s.tasks[t.id] = t
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"id": t.id})
+}
+
+func (s *Server) arkGetTask(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	t, ok := s.tasks[id]
+	var status string
+	if ok {
+		status = s.taskStatus(t)
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, EndpointTaskGet, http.StatusNotFound, "task not found")
+		return
+	}
+	resp := map[string]any{
+		"id":         t.id,
+		"model":      t.model,
+		"status":     status,
+		"created_at": t.createdAt.Unix(),
+		"updated_at": time.Now().Unix(),
+		"content":    map[string]any{},
+	}
+	switch status {
+	case "succeeded":
+		resp["content"] = map[string]any{"video_url": baseURL(r) + "/media/video-" + t.id + ".mp4"}
+		resp["usage"] = map[string]any{"completion_tokens": 108900, "total_tokens": 108900}
+	case "failed":
+		resp["error"] = map[string]any{"code": "FakeGenerationFailed", "message": "scripted task failure"}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// arkCancelTask 与方舟一致：排队中的任务被取消，已结束的任务记录被删除，生成中的任务不能取消
+func (s *Server) arkCancelTask(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		writeError(w, EndpointTaskCancel, http.StatusNotFound, "task not found")
+		return
+	}
+	switch s.taskStatus(t) {
+	case "queued":
+		t.cancelled = true
+	case "running":
+		writeError(w, EndpointTaskCancel, http.StatusConflict, "running task cannot be cancelled")
+		return
+	default:
+		delete(s.tasks, id)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+// taskStatus 根据创建后经过的时间推算任务状态，调用方需持有 s.mu
+func (s *Server) taskStatus(t *fakeTask) string {
+	elapsed := time.Since(t.createdAt)
+	d := s.script.Tasks.Duration.Duration
+	switch {
+	case t.cancelled:
+		return "cancelled"
+	case elapsed < d/3:
+		return "queued"
+	case elapsed < d:
+		return "running"
+	case t.fail:
+		return "failed"
+	default:
+		return "succeeded"
+	}
+}
+
+func (s *Server) nextID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return fmt.Sprintf("%s-fake-%d-%d", prefix, time.Now().UnixNano(), s.seq)
+}
+
+// serveMedia 返回样例图片（任意 .png）或样例视频（任意 .mp4）
+func (s *Server) serveMedia(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.calls[endpointMedia]++
+	s.mu.Unlock()
+	switch filepath.Ext(r.URL.Path) {
+	case ".png":
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(samplePNG())
+	case ".mp4":
+		video, err := s.sampleVideo()
+		if err != nil {
+			http.Error(w, "sample video unavailable: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		_, _ = w.Write(video)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// samplePNG 一张纯色图片
+func samplePNG() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: 40, G: 120, B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// sampleVideo 首次请求时读取 Script.SampleVideo，未配置时用 ffmpeg 生成一段 2 秒的纯色视频
+// （流水线的拼接环节本来就依赖 ffmpeg）
+func (s *Server) sampleVideo() ([]byte, error) {
+	s.mediaOnce.Do(func() {
+		if s.script.SampleVideo != "" {
+			s.video, s.videoErr = os.ReadFile(s.script.SampleVideo)
+			return
+		}
+		dir, err := os.MkdirTemp("", "fakeprovider")
+		if err != nil {
+			s.videoErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+		out := filepath.Join(dir, "sample.mp4")
+		cmd := exec.Command("ffmpeg", "-f", "lavfi", "-i", "color=c=blue:s=320x240:d=2:r=24",
+			"-c:v", "libx264", "-pix_fmt", "yuv420p", "-y", out)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			s.videoErr = fmt.Errorf("ffmpeg: %v: %s", err, output)
+			return
+		}
+		s.video, s.videoErr = os.ReadFile(out)
+	})
+	return s.video, s.videoErr
+}
+
+const sampleStoryboard = `| 镜号 | 景别 | 画面内容 | 台词 / 旁白 | 运镜方式 | 音效 | 时长 | 图片生成提示词 | 视频生成提示词 |
+| --- | --- | --- | --- | --- | --- | --- | --- | --- |
+| 1 | 远景 | 清晨的城市天际线，薄雾笼罩 | 旁白：新的一天开始了 | 缓慢横摇 | 城市环境声 | 4 | 清晨城市天际线，薄雾，冷色调，电影感 | 镜头从左向右缓慢横摇，薄雾流动 |
+| 2 | 中景 | 主角推开咖啡店的门走进来 | 无 | 固定镜头 | 风铃声 | 3 | 年轻人推开咖啡店木门，暖色灯光 | 人物推门走入，门上风铃轻晃 |
+| 3 | 特写 | 咖啡杯中升起的热气 | 旁白：总有些温暖值得等待 | 缓慢推近 | 轻音乐 | 3 | 咖啡杯特写，热气升腾，浅景深 | 镜头缓慢推近杯口，热气缭绕 |
+`
+
+// sampleStoryboardJSON 与 sampleStoryboard 内容相同的结构化分镜
+const sampleStoryboardJSON = `{"shots": [
+  {"shot_no": 1, "framing": "远景", "content": "清晨的城市天际线，薄雾笼罩", "dialogue": "旁白：新的一天开始了", "camera_move": "缓慢横摇", "sound": "城市环境声", "duration": 4, "image_prompt": "清晨城市天际线，薄雾，冷色调，电影感", "video_prompt": "镜头从左向右缓慢横摇，薄雾流动"},
+  {"shot_no": 2, "framing": "中景", "content": "主角推开咖啡店的门走进来", "dialogue": "无", "camera_move": "固定镜头", "sound": "风铃声", "duration": 3, "image_prompt": "年轻人推开咖啡店木门，暖色灯光", "video_prompt": "人物推门走入，门上风铃轻晃"},
+  {"shot_no": 3, "framing": "特写", "content": "咖啡杯中升起的热气", "dialogue": "旁白：总有些温暖值得等待", "camera_move": "缓慢推近", "sound": "轻音乐", "duration": 3, "image_prompt": "咖啡杯特写，热气升腾，浅景深", "video_prompt": "镜头缓慢推近杯口，热气缭绕"}
+]}`
@@ -0,0 +1,55 @@
+package fakeprovider
+
+import (
+	"V2V/pkg/provider"
+	"V2V/settings"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestServer 在 Go 测试中运行的模拟服务
+type TestServer struct {
+	*Server
+	// URL 服务地址（如 http://127.0.0.1:34567）
+	URL string
+	cfg settings.AppConfig
+}
+
+// NewTestServer 用 httptest 在本机随机端口启动模拟服务，测试结束时自动关闭，
+// 并把 provider 包的 Gemini / 方舟客户端指向它：视频分析使用 gemini 且要求结构化输出，生图与图生视频使用方舟。
+// provider 的配置是包级变量，使用它的测试不能并行执行
+func NewTestServer(tb testing.TB, script Script) *TestServer {
+	tb.Helper()
+	srv := New(script)
+	hs := httptest.NewServer(srv)
+	tb.Cleanup(hs.Close)
+	s := &TestServer{Server: srv, URL: hs.URL}
+	s.Configure(settings.AppConfig{
+		VideoAnalysis:   settings.VideoAnalysisConfig{Provider: settings.AnalyzerGemini, StructuredOutput: true},
+		ImageGeneration: settings.ImageGenerationConfig{Provider: settings.ImageGeneratorArk, PerShotConcurrency: 2},
+		VideoGeneration: settings.VideoGenerationConfig{Provider: settings.VideoGeneratorArk},
+		Gemini:          settings.GeminiConfig{Model: "gemini-fake", InlineMaxMB: 14},
+		Ark: settings.ArkConfig{
+			ImageModel:  "seedream-fake",
+			VideoModel:  "seedance-fake",
+			VisionModel: "doubao-vision-fake",
+		},
+	})
+	return s
+}
+
+// Configure 把 cfg 中 Gemini / 方舟的地址与 API Key 指向模拟服务后用它初始化 provider 包；
+// 需要其他服务选择（如 doubao 视频分析、备用服务）时在 Config 的基础上修改后再次调用
+func (s *TestServer) Configure(cfg settings.AppConfig) {
+	cfg.Gemini.BaseURL = s.URL
+	cfg.Gemini.APIKey = "fake"
+	cfg.Ark.BaseURL = s.URL + "/api/v3"
+	cfg.Ark.APIKey = "fake"
+	s.cfg = cfg
+	provider.Init(&cfg)
+}
+
+// Config 返回当前注入 provider 包的配置
+func (s *TestServer) Config() settings.AppConfig {
+	return s.cfg
+}
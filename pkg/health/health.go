@@ -0,0 +1,127 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 组件与整体状态
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// checkTimeout 单个组件检查的最长耗时，避免某个依赖卡住导致探针超时
+const checkTimeout = 2 * time.Second
+
+// Checker 检查某个依赖是否可用，返回 nil 表示正常
+type Checker func(ctx context.Context) error
+
+// ComponentStatus 单个组件的检查结果
+type ComponentStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// Report 探针返回的整体结果
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type check struct {
+	name string
+	fn   Checker
+}
+
+var (
+	mu        sync.RWMutex
+	liveness  = make(map[string]Checker)
+	readiness = make(map[string]Checker)
+	ready     atomic.Bool
+)
+
+// RegisterLiveness 注册存活检查：失败意味着进程已不可恢复，需要被重启（例如 SSE hub 循环退出）
+// 存活检查同时也会计入就绪检查。
+func RegisterLiveness(name string, fn Checker) {
+	mu.Lock()
+	defer mu.Unlock()
+	liveness[name] = fn
+	readiness[name] = fn
+}
+
+// RegisterReadiness 注册就绪检查：失败意味着暂时不应接收流量（例如 MySQL / RabbitMQ 不可用）
+func RegisterReadiness(name string, fn Checker) {
+	mu.Lock()
+	defer mu.Unlock()
+	readiness[name] = fn
+}
+
+// SetReady 设置进程是否就绪；启动完成后置为 true，开始优雅关闭时置为 false
+func SetReady(v bool) {
+	ready.Store(v)
+}
+
+// Liveness 执行所有存活检查
+func Liveness(ctx context.Context) Report {
+	return run(ctx, snapshot(liveness))
+}
+
+// Readiness 执行所有就绪检查；进程未就绪（启动中或正在关闭）时整体状态为 down
+func Readiness(ctx context.Context) Report {
+	report := run(ctx, snapshot(readiness))
+	if !ready.Load() {
+		report.Status = StatusDown
+		report.Components["lifecycle"] = ComponentStatus{Status: StatusDown, Error: "starting or shutting down"}
+	} else {
+		report.Components["lifecycle"] = ComponentStatus{Status: StatusUp}
+	}
+	return report
+}
+
+func snapshot(m map[string]Checker) []check {
+	mu.RLock()
+	defer mu.RUnlock()
+	checks := make([]check, 0, len(m))
+	for name, fn := range m {
+		checks = append(checks, check{name: name, fn: fn})
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+	return checks
+}
+
+// run 并发执行检查，任何一个组件失败则整体为 down
+func run(ctx context.Context, checks []check) Report {
+	results := make([]ComponentStatus, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := c.fn(cctx)
+			status := ComponentStatus{Status: StatusUp, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = StatusDown
+				status.Error = err.Error()
+			}
+			results[i] = status
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: make(map[string]ComponentStatus, len(checks)+1)}
+	for i, c := range checks {
+		report.Components[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
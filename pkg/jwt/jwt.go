@@ -17,8 +17,13 @@ type MyClaims struct {
 	jwt.StandardClaims
 }
 
-// 定义Secret 用于加密的字符串
-var mySecret = []byte("bluebell-plus")
+// 定义Secret 用于加密的字符串，由 Init 从配置注入
+var mySecret []byte
+
+// Init 设置签名使用的密钥（来自配置 auth.jwt_secret）
+func Init(secret string) {
+	mySecret = []byte(secret)
+}
 
 func keyFunc(_ *jwt.Token) (i interface{}, err error) {
 	return mySecret, nil
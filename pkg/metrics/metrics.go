@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 轻量的 Prometheus 文本格式导出：各模块注册采集函数，/metrics 被抓取时现场读取当前值，
+// 不需要在业务代码里维护额外的指标对象。
+
+// 指标类型
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+// Sample 一个带标签的指标值
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector 抓取时调用，返回该指标的全部样本
+type Collector func() []Sample
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	collect Collector
+}
+
+var (
+	mu       sync.RWMutex
+	families = make(map[string]*family)
+)
+
+// RegisterGauge 注册一个 gauge 指标（同名重复注册时覆盖）
+func RegisterGauge(name, help string, c Collector) {
+	register(name, help, TypeGauge, c)
+}
+
+// RegisterCounter 注册一个 counter 指标（同名重复注册时覆盖）
+func RegisterCounter(name, help string, c Collector) {
+	register(name, help, TypeCounter, c)
+}
+
+func register(name, help, typ string, c Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	families[name] = &family{name: name, help: help, typ: typ, collect: c}
+}
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Write 按 Prometheus 文本格式输出所有指标（按名称排序，便于比对）
+func Write(w io.Writer) error {
+	mu.RLock()
+	list := make([]*family, 0, len(families))
+	for _, f := range families {
+		list = append(list, f)
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	var b strings.Builder
+	for _, f := range list {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.collect() {
+			b.WriteString(f.name)
+			writeLabels(&b, s.Labels)
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeLabels(b *strings.Builder, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,56 @@
+package prompt
+
+import "V2V/models"
+
+// 内置模板（版本 0）：没有任何激活的模板时使用，内容与引入模板管理之前的硬编码提示词一致
+// （i2v 在分镜可用时改为使用单个分镜的提示词）
+
+// kind 一类提示词：内置内容与渲染时提供的变量
+type kind struct {
+	builtin   string
+	variables []string
+}
+
+var kinds = map[string]kind{
+	// 分镜分析指令，渲染时没有变量
+	models.PromptV2T: {builtin: storyboardText},
+	// storyboard：V2T 生成的分镜脚本
+	models.PromptT2I: {
+		builtin:   "请按照分镜数生成图像数{{.storyboard}}",
+		variables: []string{"storyboard"},
+	},
+	// shot_no：镜号；image_prompt：该分镜的图片生成提示词（没有时为画面内容）；framing / content：景别与画面内容
+	models.PromptT2IShot: {
+		builtin:   "{{.image_prompt}}{{with .framing}}，景别：{{.}}{{end}}",
+		variables: []string{"shot_no", "image_prompt", "framing", "content"},
+	},
+	// index：参考图序号（从 1 开始）；shot_no：对应的镜号，prompt 为该分镜的视频生成提示词，
+	// camera_move / duration 为其运镜方式与时长；分镜不可用时 shot_no 为 0，prompt 为整段分镜脚本
+	models.PromptI2V: {
+		builtin:   "{{if .shot_no}}{{.prompt}}{{with .camera_move}}。运镜方式：{{.}}{{end}}{{else}}根据文本与参考图生成第{{.index}}张分镜的视频{{.prompt}}{{end}}",
+		variables: []string{"index", "shot_no", "prompt", "camera_move", "duration"},
+	},
+}
+
+const storyboardText = `#角色你是一位专业且经验丰富的影视分镜师，专注于拆解生动的视觉画面。熟练掌握镜头语言、构图、色彩搭配和叙事节奏，擅长为影视制作、广告宣传、动画创作等提供清晰、专业的分镜脚本框架，确保视觉表现力与叙事逻辑兼具。#技能## 技能 1：理解视频内容并构思分镜
+理解视频内容：
+全面分析视频内容主题、情节结构和目标用户，确保分镜紧密贴合故事主题。
+构思镜头序列：
+根据内容，还原镜头顺序。
+## 技能 2：生成并优化分镜脚本
+生成初始分镜脚本：
+根据构思的镜头序列，按照以下格式输出分镜脚本：
+镜号、景别、画面内容、台词、运镜方式、音效、时长、图片生成提示词、视频生成提示词
+对格式的具体要求：
+镜号：为每个镜头分配唯一编号，方便管理与引用（分镜数量与原视频保持一致）。
+景别：清晰描述镜头距离（近景、中景、远景、特写等），展现主体与背景的关系。
+画面内容：详细明确描述场景、人物、动作、细节，助力视觉化创意。
+台词 / 旁白：添加角色台词、旁白或文字提示（如需）。
+运镜方式：说明镜头操作（推、拉、摇、移等），体现叙事流动性。
+时长：合理估算镜头持续时间（秒为单位），确保节奏流畅。
+备注：对镜头的情感表达、技术要求或特殊细节进行补充说明。
+图片生成提示词：镜号的首帧图片该如何用文字描述生成图片
+视频生成提示词：如何用镜号的首帧图片根据提示词生成对应的视频
+检查与优化：
+检查清晰度与可行性：确保分镜描述简洁清晰、易懂，完全适合拍摄或制作，严格符合影视制作规范。
+合理调整：优化镜头设计，充分考量制作成本与技术难度，避免复杂镜头影响实际执行。`
@@ -0,0 +1,214 @@
+package prompt
+
+import (
+	"V2V/dao/mysql"
+	"V2V/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// 分镜分析指令与 T2I / I2V 提示词的模板管理。模板按版本保存在 MySQL（t_prompt_templates），
+// 可以按项目或用户覆盖全局模板。提交任务时解析出当前生效的版本并记录在任务上，
+// worker 按记录的版本渲染，重试与死信回放都使用同一版本，便于复现。
+
+var (
+	// ErrUnknownName 模板类型不存在
+	ErrUnknownName = errors.New("unknown prompt template name")
+	// ErrInvalidTemplate 模板语法错误或引用了不提供的变量
+	ErrInvalidTemplate = errors.New("invalid prompt template")
+)
+
+// scopeOrder 解析生效版本时的优先级：用户 > 项目 > 全局
+var scopeOrder = []string{models.PromptScopeUser, models.PromptScopeProject, models.PromptScopeGlobal}
+
+// Names 所有模板类型
+func Names() []string {
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidScope scope 是否为可以保存的作用范围（不含 builtin）
+func ValidScope(scope string) bool {
+	for _, s := range scopeOrder {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Builtins 内置模板（版本 0），用于展示默认内容与可用变量
+func Builtins() []models.PromptTemplate {
+	out := make([]models.PromptTemplate, 0, len(kinds))
+	for _, name := range Names() {
+		k := kinds[name]
+		out = append(out, models.PromptTemplate{
+			Name:      name,
+			Scope:     models.PromptScopeBuiltin,
+			Content:   k.builtin,
+			Variables: append([]string{}, k.variables...),
+		})
+	}
+	return out
+}
+
+// Parse 校验模板内容：语法正确且只引用该类型提供的变量，返回引用到的变量
+func Parse(name, content string) ([]string, error) {
+	k, ok := kinds[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (available: %s)", ErrUnknownName, name, strings.Join(Names(), ", "))
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("%w: empty content", ErrInvalidTemplate)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	used := map[string]bool{}
+	if tmpl.Tree != nil {
+		collectFields(tmpl.Tree.Root, used)
+	}
+	variables := make([]string, 0, len(used))
+	for v := range used {
+		if !contains(k.variables, v) {
+			available := strings.Join(k.variables, ", ")
+			if available == "" {
+				available = "none"
+			}
+			return nil, fmt.Errorf("%w: unknown variable %q (available for %s: %s)", ErrInvalidTemplate, v, name, available)
+		}
+		variables = append(variables, v)
+	}
+	sort.Strings(variables)
+	return variables, nil
+}
+
+// collectFields 收集模板中以 .name / $.name 形式引用的顶层变量。
+// range / with 内部的 . 不再指向顶层，这里仍按顶层变量检查，模板变量都是标量，不影响实际使用
+func collectFields(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectFields(c, used)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			collectFields(c, used)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			collectFields(a, used)
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, used)
+	case *parse.FieldNode:
+		used[n.Ident[0]] = true
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			used[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, used)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, used)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, used)
+	}
+}
+
+func collectBranch(n *parse.BranchNode, used map[string]bool) {
+	collectFields(n.Pipe, used)
+	collectFields(n.List, used)
+	collectFields(n.ElseList, used)
+}
+
+// Resolve 返回对该用户 / 项目生效的模板版本：用户 > 项目 > 全局，都没有激活版本时使用内置模板
+func Resolve(name string, userID uint64, project string) (*models.PromptRef, error) {
+	if _, ok := kinds[name]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownName, name)
+	}
+	candidates, err := mysql.GetActivePromptTemplates(name, userID, project)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopeOrder {
+		for _, t := range candidates {
+			if t.Scope == scope {
+				return &models.PromptRef{ID: t.ID, Name: t.Name, Scope: t.Scope, Version: t.Version}, nil
+			}
+		}
+	}
+	return &models.PromptRef{Name: name, Scope: models.PromptScopeBuiltin}, nil
+}
+
+// compiled 已解析的模板版本；版本创建后不再修改，可以一直缓存
+var compiled sync.Map // map[uint64]*template.Template
+
+// Render 按任务记录的模板版本渲染提示词；ref 为空（引入模板管理之前提交的任务）或 ID 为 0 时使用内置模板
+func Render(name string, ref *models.PromptRef, vars map[string]interface{}) (string, error) {
+	tmpl, err := load(name, ref)
+	if err != nil {
+		return "", err
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("%w: render %s: %v", ErrInvalidTemplate, name, err)
+	}
+	return b.String(), nil
+}
+
+func load(name string, ref *models.PromptRef) (*template.Template, error) {
+	if ref == nil || ref.ID == 0 {
+		k, ok := kinds[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownName, name)
+		}
+		return template.New(name).Option("missingkey=error").Parse(k.builtin)
+	}
+	if v, ok := compiled.Load(ref.ID); ok {
+		return v.(*template.Template), nil
+	}
+	t, err := mysql.GetPromptTemplate(ref.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load prompt template %d: %w", ref.ID, err)
+	}
+	if t.Name != name {
+		return nil, fmt.Errorf("%w: template %d is a %s template, want %s", ErrInvalidTemplate, ref.ID, t.Name, name)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(t.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	compiled.Store(ref.ID, tmpl)
+	return tmpl, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"V2V/pkg/breaker"
+	"V2V/pkg/ratelimit"
+	"V2V/settings"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"google.golang.org/genai"
+)
+
+// VideoSource 待分析的视频：公网地址或本地文件（用户直接上传的视频）二选一
+type VideoSource struct {
+	URL string
+	// Path 本地文件路径，MIMEType 为其类型
+	Path     string
+	MIMEType string
+}
+
+// VideoAnalyzer 视频理解服务：输入视频与提示词，返回模型生成的文本（V2T 的分镜脚本）
+type VideoAnalyzer interface {
+	// Name 服务名，与配置 video_analysis.provider 及任务的 provider 字段一致
+	Name() string
+	// Platform 服务所在平台（ratelimit.ProviderGemini / ProviderArk），限流与熔断按平台统计
+	Platform() string
+	// AnalyzeVideo schema 非空时要求模型按该 JSON Schema 输出 JSON
+	AnalyzeVideo(ctx context.Context, video VideoSource, prompt string, schema map[string]interface{}) (string, error)
+}
+
+var analyzers = map[string]VideoAnalyzer{
+	settings.AnalyzerGemini: geminiAnalyzer{},
+	settings.AnalyzerDoubao: doubaoAnalyzer{},
+}
+
+// Analyzer 按名称返回视频分析服务
+func Analyzer(name string) (VideoAnalyzer, bool) {
+	a, ok := analyzers[name]
+	return a, ok
+}
+
+// AnalyzerPlatforms 返回配置的主服务与备用服务所在的平台（去重），
+// V2T 队列在这些平台全部熔断时才暂停消费
+func AnalyzerPlatforms() []string {
+	var platforms []string
+	for _, name := range []string{analysisConf.Provider, analysisConf.Fallback} {
+		a, ok := Analyzer(name)
+		if !ok {
+			continue
+		}
+		if len(platforms) == 0 || platforms[0] != a.Platform() {
+			platforms = append(platforms, a.Platform())
+		}
+	}
+	return platforms
+}
+
+// AnalyzeVideo 使用 name 指定的服务（为空时使用配置的默认服务）分析视频；
+// 该服务返回临时错误或已经熔断时切换到配置的备用服务。返回结果文本与实际使用的服务名。
+// schema 为期望的 JSON 输出格式，配置 video_analysis.structured_output 关闭时忽略
+func AnalyzeVideo(ctx context.Context, name string, video VideoSource, prompt string, schema map[string]interface{}) (text, used string, err error) {
+	if name == "" {
+		name = analysisConf.Provider
+	}
+	if !analysisConf.StructuredOutput {
+		schema = nil
+	}
+	candidates := []string{name}
+	if fb := analysisConf.Fallback; fb != "" && fb != name {
+		candidates = append(candidates, fb)
+	}
+	for i, n := range candidates {
+		a, ok := Analyzer(n)
+		if !ok {
+			return "", n, fmt.Errorf("unknown video analyzer %q", n)
+		}
+		last := i == len(candidates)-1
+		if !last && breaker.For(a.Platform()).State() == breaker.StateOpen {
+			log.Printf("video analysis: %s circuit is open, failing over to %s", n, candidates[i+1])
+			continue
+		}
+		text, err = a.AnalyzeVideo(ctx, video, prompt, schema)
+		if err == nil {
+			return text, n, nil
+		}
+		if last || ctx.Err() != nil || !IsTransient(err) {
+			return "", n, fmt.Errorf("%s: %w", n, err)
+		}
+		log.Printf("video analysis: %s failed with transient error, failing over to %s: %v", n, candidates[i+1], err)
+	}
+	return "", name, err
+}
+
+// IsTransient 判断调用错误是否为服务端临时故障（限流等待超时、5xx、429、网络错误），
+// 这类错误可以切换到备用服务或稍后重试
+func IsTransient(err error) bool {
+	return errors.Is(err, ratelimit.ErrWaitTimeout) || breaker.IsFailure(err)
+}
+
+// geminiAnalyzer 通过 Gemini 多模态模型分析视频
+type geminiAnalyzer struct{}
+
+func (geminiAnalyzer) Name() string     { return settings.AnalyzerGemini }
+func (geminiAnalyzer) Platform() string { return ratelimit.ProviderGemini }
+
+func (geminiAnalyzer) AnalyzeVideo(ctx context.Context, video VideoSource, prompt string, schema map[string]interface{}) (string, error) {
+	//计算执行时间
+	starttime := time.Now()
+	defer func() {
+		log.Printf("Gemini video analysis API call took %s", time.Since(starttime))
+	}()
+	client, err := newGeminiClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	videoPart, cleanup, err := geminiVideoPart(ctx, client, video)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	release, err := ratelimit.Acquire(ctx, ratelimit.ProviderGemini, geminiConf.Model)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	parts := []*genai.Part{
+		genai.NewPartFromText(prompt),
+		videoPart,
+	}
+	contents := []*genai.Content{
+		genai.NewContentFromParts(parts, genai.RoleUser),
+	}
+	var config *genai.GenerateContentConfig
+	if schema != nil {
+		config = &genai.GenerateContentConfig{ResponseMIMEType: "application/json", ResponseJsonSchema: schema}
+	}
+	result, err := client.Models.GenerateContent(ctx, geminiConf.Model, contents, config)
+	breaker.For(ratelimit.ProviderGemini).Record(err)
+	if err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", errors.New("genai: empty generate response")
+	}
+	return result.Text(), nil
+}
+
+// geminiFilePollInterval 等待 Files API 处理上传视频时的查询间隔
+const geminiFilePollInterval = 2 * time.Second
+
+// geminiVideoPart 构造请求中的视频：公网地址直接引用；本地文件不超过 gemini.inline_max_mb 时内联发送，
+// 否则经 Files API 上传并等待处理完成。返回的 cleanup 在分析结束后删除已上传的文件
+func geminiVideoPart(ctx context.Context, client *genai.Client, video VideoSource) (*genai.Part, func(), error) {
+	noop := func() {}
+	if video.Path == "" {
+		return genai.NewPartFromURI(video.URL, "video/mp4"), noop, nil
+	}
+	mimeType := video.MIMEType
+	if mimeType == "video/quicktime" {
+		// Gemini 对 QuickTime 使用 video/mov
+		mimeType = "video/mov"
+	}
+	info, err := os.Stat(video.Path)
+	if err != nil {
+		return nil, noop, err
+	}
+	if info.Size() <= geminiConf.InlineMaxMB<<20 {
+		data, err := os.ReadFile(video.Path)
+		if err != nil {
+			return nil, noop, err
+		}
+		return genai.NewPartFromBytes(data, mimeType), noop, nil
+	}
+
+	file, err := client.Files.UploadFromPath(ctx, video.Path, &genai.UploadFileConfig{MIMEType: mimeType})
+	breaker.For(ratelimit.ProviderGemini).Record(err)
+	if err != nil {
+		return nil, noop, fmt.Errorf("gemini: upload video: %w", err)
+	}
+	name := file.Name
+	cleanup := func() {
+		// 上传的文件 48 小时后自动过期，删除失败只记录日志
+		if _, err := client.Files.Delete(context.WithoutCancel(ctx), name, nil); err != nil {
+			log.Printf("gemini: failed to delete uploaded file %s: %v", name, err)
+		}
+	}
+	// 视频上传后需要服务端处理完成（ACTIVE）才能引用
+	for file.State == genai.FileStateProcessing {
+		select {
+		case <-ctx.Done():
+			cleanup()
+			return nil, noop, ctx.Err()
+		case <-time.After(geminiFilePollInterval):
+		}
+		file, err = client.Files.Get(ctx, name, nil)
+		if err != nil {
+			cleanup()
+			return nil, noop, fmt.Errorf("gemini: get uploaded file: %w", err)
+		}
+	}
+	if file.State == genai.FileStateFailed {
+		cleanup()
+		msg := "unknown error"
+		if file.Error != nil {
+			msg = file.Error.Message
+		}
+		return nil, noop, fmt.Errorf("gemini: video processing failed: %s", msg)
+	}
+	return genai.NewPartFromURI(file.URI, file.MIMEType), cleanup, nil
+}
+
+// doubaoAnalyzer 通过方舟上的豆包视觉理解模型（chat completions + video_url）分析视频
+type doubaoAnalyzer struct{}
+
+func (doubaoAnalyzer) Name() string     { return settings.AnalyzerDoubao }
+func (doubaoAnalyzer) Platform() string { return ratelimit.ProviderArk }
+
+func (doubaoAnalyzer) AnalyzeVideo(ctx context.Context, video VideoSource, prompt string, schema map[string]interface{}) (string, error) {
+	//计算执行时间
+	starttime := time.Now()
+	defer func() {
+		log.Printf("Doubao video analysis API call took %s", time.Since(starttime))
+	}()
+	videoURL := video.URL
+	if video.Path != "" {
+		// 本地文件以 base64 data URL 的形式随请求发送
+		data, err := os.ReadFile(video.Path)
+		if err != nil {
+			return "", err
+		}
+		videoURL = "data:" + video.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	release, err := ratelimit.Acquire(ctx, ratelimit.ProviderArk, arkConf.VisionModel)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	req := model.CreateChatCompletionRequest{
+		Model: arkConf.VisionModel,
+		Messages: []*model.ChatCompletionMessage{
+			{
+				Role: model.ChatMessageRoleUser,
+				Content: &model.ChatCompletionMessageContent{
+					ListValue: []*model.ChatCompletionMessageContentPart{
+						{
+							Type:     model.ChatCompletionMessageContentPartTypeVideoURL,
+							VideoURL: &model.ChatMessageVideoURL{URL: videoURL},
+						},
+						{
+							Type: model.ChatCompletionMessageContentPartTypeText,
+							Text: prompt,
+						},
+					},
+				},
+			},
+		},
+	}
+	if schema != nil {
+		req.ResponseFormat = &model.ResponseFormat{
+			Type: model.ResponseFormatJSONSchema,
+			JSONSchema: &model.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "storyboard",
+				Schema: schema,
+				Strict: true,
+			},
+		}
+	}
+	resp, err := newArkClient().CreateChatCompletion(ctx, req)
+	breaker.For(ratelimit.ProviderArk).Record(err)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == nil || resp.Choices[0].Message.Content.StringValue == nil {
+		return "", errors.New("ark: empty chat completion response")
+	}
+	return *resp.Choices[0].Message.Content.StringValue, nil
+}
@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"V2V/pkg/breaker"
+	"V2V/pkg/ratelimit"
+	"V2V/settings"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"github.com/volcengine/volcengine-go-sdk/volcengine"
+)
+
+// ImageRequest 与具体服务无关的生图请求
+type ImageRequest struct {
+	// Model 为空时使用服务配置的默认模型
+	Model  string
+	Prompt string
+	// MaxImages 最多生成的图片数，大于 1 时由模型按提示词生成一组图片
+	MaxImages int
+	// Size 图片尺寸（如 1K / 2K / 1024x1024），为空时使用服务默认值
+	Size string
+	// AspectRatio 宽高比（如 16:9），为空时由模型决定
+	AspectRatio string
+	// Seed 随机种子，为空时由服务随机
+	Seed      *int64
+	Watermark bool
+}
+
+// GeneratedImage 一张生成结果：成功时 URL 与 Data 至少有一个，失败时 Error 为原因
+type GeneratedImage struct {
+	URL   string
+	Data  []byte
+	Size  string
+	Error string
+}
+
+// ImageUsage 计费用量
+type ImageUsage struct {
+	GeneratedImages int64
+	OutputTokens    int64
+	TotalTokens     int64
+}
+
+// ImageResult 一次生图调用的结果
+type ImageResult struct {
+	// Model 实际使用的模型
+	Model  string
+	Images []GeneratedImage
+	Usage  ImageUsage
+}
+
+// ImageGenerator 文生图服务
+type ImageGenerator interface {
+	// Name 服务名，与配置 image_generation.provider 一致
+	Name() string
+	// Platform 服务所在平台，限流与熔断按平台统计
+	Platform() string
+	GenerateImages(ctx context.Context, req ImageRequest) (*ImageResult, error)
+}
+
+var imageGenerators = map[string]ImageGenerator{
+	settings.ImageGeneratorArk: arkImageGenerator{},
+}
+
+// Images 返回配置的生图服务
+func Images() ImageGenerator {
+	if g, ok := imageGenerators[imageConf.Provider]; ok {
+		return g
+	}
+	return imageGenerators[settings.ImageGeneratorArk]
+}
+
+// PerShotConcurrency 逐镜头生图时单个任务同时进行的调用数
+func PerShotConcurrency() int {
+	return max(imageConf.PerShotConcurrency, 1)
+}
+
+// arkImageGenerator 方舟 Seedream 生图（模型见 ark.image_model）
+type arkImageGenerator struct{}
+
+func (arkImageGenerator) Name() string     { return settings.ImageGeneratorArk }
+func (arkImageGenerator) Platform() string { return ratelimit.ProviderArk }
+
+func (arkImageGenerator) GenerateImages(ctx context.Context, req ImageRequest) (*ImageResult, error) {
+	imageModel := req.Model
+	if imageModel == "" {
+		imageModel = arkConf.ImageModel
+	}
+	generateReq := model.GenerateImagesRequest{
+		Model:          imageModel,
+		Prompt:         req.Prompt,
+		ResponseFormat: volcengine.String(model.GenerateImagesResponseFormatURL),
+		Watermark:      volcengine.Bool(req.Watermark),
+		Seed:           req.Seed,
+	}
+	if size := arkImageSize(req.Size, req.AspectRatio); size != "" {
+		generateReq.Size = volcengine.String(size)
+	}
+	if req.MaxImages > 1 {
+		sequential := model.SequentialImageGeneration("auto")
+		maxImages := req.MaxImages
+		generateReq.SequentialImageGeneration = &sequential
+		generateReq.SequentialImageGenerationOptions = &model.SequentialImageGenerationOptions{
+			MaxImages: &maxImages,
+		}
+	}
+
+	release, err := ratelimit.Acquire(ctx, ratelimit.ProviderArk, imageModel)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	//计算执行时间
+	starttime := time.Now()
+	defer func() {
+		log.Printf("Ark GenerateImages API call took %s", time.Since(starttime))
+	}()
+	resp, err := newArkClient().GenerateImages(ctx, generateReq)
+	breaker.For(ratelimit.ProviderArk).Record(err)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("ark: %s - %s", resp.Error.Code, resp.Error.Message)
+	}
+
+	result := &ImageResult{Model: resp.Model}
+	if result.Model == "" {
+		result.Model = imageModel
+	}
+	for _, img := range resp.Data {
+		if img == nil {
+			continue
+		}
+		gi := GeneratedImage{Size: img.Size}
+		switch {
+		case img.Url != nil && *img.Url != "":
+			gi.URL = *img.Url
+		case img.B64Json != nil && *img.B64Json != "":
+			if gi.Data, err = base64.StdEncoding.DecodeString(*img.B64Json); err != nil {
+				gi.Error = "invalid base64 image: " + err.Error()
+			}
+		default:
+			gi.Error = "empty image in response"
+		}
+		result.Images = append(result.Images, gi)
+	}
+	if resp.Usage != nil {
+		result.Usage = ImageUsage{
+			GeneratedImages: resp.Usage.GeneratedImages,
+			OutputTokens:    resp.Usage.OutputTokens,
+			TotalTokens:     resp.Usage.TotalTokens,
+		}
+	}
+	if len(result.Images) == 0 {
+		return nil, errors.New("ark: no images in response")
+	}
+	return result, nil
+}
+
+// arkImageSizes 1K / 2K / 4K 对应的正方形边长
+var arkImageSizes = map[string]float64{"1K": 1024, "2K": 2048, "4K": 4096}
+
+// arkImageSize Seedream 的 size 只接受 1K / 2K / 4K（由模型决定宽高比）或具体像素；
+// 指定宽高比时按同样的像素总数换算为 <宽>x<高>（取 8 的倍数）
+func arkImageSize(size, aspectRatio string) string {
+	side, ok := arkImageSizes[strings.ToUpper(size)]
+	if !ok || aspectRatio == "" {
+		return size
+	}
+	var w, h float64
+	if _, err := fmt.Sscanf(aspectRatio, "%g:%g", &w, &h); err != nil || w <= 0 || h <= 0 {
+		return size
+	}
+	width := int(math.Round(side*math.Sqrt(w/h)/8)) * 8
+	height := int(math.Round(side*math.Sqrt(h/w)/8)) * 8
+	return fmt.Sprintf("%dx%d", width, height)
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"V2V/settings"
+	"context"
+
+	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
+	"google.golang.org/genai"
+)
+
+// 外部生成服务（Gemini / 火山方舟）的统一封装：业务代码只依赖这里定义的接口，
+// 具体调用哪个服务由配置或任务参数决定；限流（pkg/ratelimit）与熔断（pkg/breaker）在各实现内部完成。
+
+var (
+	analysisConf settings.VideoAnalysisConfig
+	imageConf    settings.ImageGenerationConfig
+	videoConf    settings.VideoGenerationConfig
+	geminiConf   settings.GeminiConfig
+	arkConf      settings.ArkConfig
+)
+
+// Init 注入各服务的连接配置（API Key、Base URL、模型）与服务选择配置，需要在使用任何服务之前调用
+func Init(cfg *settings.AppConfig) {
+	analysisConf = cfg.VideoAnalysis
+	imageConf = cfg.ImageGeneration
+	videoConf = cfg.VideoGeneration
+	geminiConf = cfg.Gemini
+	arkConf = cfg.Ark
+}
+
+// newGeminiClient 使用注入的配置创建 Gemini 客户端
+func newGeminiClient(ctx context.Context) (*genai.Client, error) {
+	return genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:      geminiConf.APIKey,
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: geminiConf.BaseURL},
+	})
+}
+
+// newArkClient 使用注入的配置创建方舟客户端
+func newArkClient() *arkruntime.Client {
+	return arkruntime.NewClientWithApiKey(arkConf.APIKey, arkruntime.WithBaseUrl(arkConf.BaseURL))
+}
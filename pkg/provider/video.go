@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"V2V/models"
+	"V2V/pkg/breaker"
+	"V2V/pkg/ratelimit"
+	"V2V/settings"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"github.com/volcengine/volcengine-go-sdk/volcengine"
+)
+
+// VideoRequest 与具体服务无关的图生视频请求
+type VideoRequest struct {
+	// Model 为空时使用服务配置的默认模型
+	Model  string
+	Prompt string
+	// ImageURL 首帧参考图
+	ImageURL string
+	// Resolution 分辨率（如 720p），为空时使用服务默认值
+	Resolution string
+	// AspectRatio 宽高比（如 16:9 / adaptive），为空时使用服务默认值
+	AspectRatio string
+	// Duration 视频时长（秒），为 0 时使用服务默认值
+	Duration int
+	// Seed 随机种子，为空时由服务随机
+	Seed *int64
+	// Watermark / CameraFixed 为空时使用服务默认值
+	Watermark   *bool
+	CameraFixed *bool
+}
+
+// VideoTask 归一化后的异步生成任务
+type VideoTask struct {
+	ID string
+	// Status 取值与 models.I2VSubTask* 一致（queued / running / succeeded / failed / cancelled）
+	Status   string
+	VideoURL string
+	// Error 失败原因（failed / cancelled 时）
+	Error string
+	// Tokens 计费用量（succeeded 时）
+	Tokens int64
+}
+
+// VideoGenerator 图生视频服务：生成是异步的，创建任务后通过轮询或回调得到结果
+type VideoGenerator interface {
+	// Name 服务名，与配置 video_generation.provider 一致
+	Name() string
+	// Platform 服务所在平台，限流与熔断按平台统计
+	Platform() string
+	// CreateVideoTask 创建生成任务，返回服务端任务 ID
+	CreateVideoTask(ctx context.Context, req VideoRequest) (string, error)
+	GetVideoTask(ctx context.Context, id string) (*VideoTask, error)
+	// CancelVideoTask 取消尚未完成的任务（服务不支持取消已在生成中的任务时返回错误）
+	CancelVideoTask(ctx context.Context, id string) error
+	// ParseCallback 解析服务推送的任务状态回调
+	ParseCallback(body []byte) (*VideoTask, error)
+}
+
+var videoGenerators = map[string]VideoGenerator{
+	settings.VideoGeneratorArk: arkVideoGenerator{},
+}
+
+// Videos 返回配置的图生视频服务
+func Videos() VideoGenerator {
+	if g, ok := videoGenerators[videoConf.Provider]; ok {
+		return g
+	}
+	return videoGenerators[settings.VideoGeneratorArk]
+}
+
+// arkVideoGenerator 方舟 Seedance 图生视频（模型见 ark.video_model）
+type arkVideoGenerator struct{}
+
+func (arkVideoGenerator) Name() string     { return settings.VideoGeneratorArk }
+func (arkVideoGenerator) Platform() string { return ratelimit.ProviderArk }
+
+func (arkVideoGenerator) CreateVideoTask(ctx context.Context, req VideoRequest) (string, error) {
+	videoModel := req.Model
+	if videoModel == "" {
+		videoModel = arkConf.VideoModel
+	}
+	createReq := model.CreateContentGenerationTaskRequest{
+		Model: videoModel,
+		Content: []*model.CreateContentGenerationContentItem{
+			{
+				Type: model.ContentGenerationContentItemTypeText,
+				Text: volcengine.String(req.Prompt + seedanceParams(req)),
+			},
+			{
+				Type:     model.ContentGenerationContentItemTypeImage,
+				ImageURL: &model.ImageURL{URL: req.ImageURL},
+			},
+		},
+	}
+	release, err := ratelimit.Acquire(ctx, ratelimit.ProviderArk, videoModel)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	resp, err := newArkClient().CreateContentGenerationTask(ctx, createReq)
+	breaker.For(ratelimit.ProviderArk).Record(err)
+	if err != nil {
+		return "", err
+	}
+	if resp.ID == "" {
+		return "", errors.New("ark: empty task id in create response")
+	}
+	return resp.ID, nil
+}
+
+// seedanceParams Seedance 的生成参数以 --key value 的形式追加在文本提示词后
+func seedanceParams(req VideoRequest) string {
+	var b strings.Builder
+	if req.Resolution != "" {
+		b.WriteString(" --resolution " + req.Resolution)
+	}
+	if req.AspectRatio != "" {
+		b.WriteString(" --ratio " + req.AspectRatio)
+	}
+	if req.Duration > 0 {
+		b.WriteString(" --duration " + strconv.Itoa(req.Duration))
+	}
+	if req.Seed != nil {
+		b.WriteString(" --seed " + strconv.FormatInt(*req.Seed, 10))
+	}
+	if req.CameraFixed != nil {
+		b.WriteString(" --camerafixed " + strconv.FormatBool(*req.CameraFixed))
+	}
+	if req.Watermark != nil {
+		b.WriteString(" --watermark " + strconv.FormatBool(*req.Watermark))
+	}
+	return b.String()
+}
+
+func (arkVideoGenerator) GetVideoTask(ctx context.Context, id string) (*VideoTask, error) {
+	release, err := ratelimit.Acquire(ctx, ratelimit.ProviderArk, arkConf.VideoModel)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := newArkClient().GetContentGenerationTask(ctx, model.GetContentGenerationTaskRequest{ID: id})
+	breaker.For(ratelimit.ProviderArk).Record(err)
+	if err != nil {
+		return nil, err
+	}
+	return arkVideoTask(resp), nil
+}
+
+func (arkVideoGenerator) CancelVideoTask(ctx context.Context, id string) error {
+	release, err := ratelimit.Acquire(ctx, ratelimit.ProviderArk, arkConf.VideoModel)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = newArkClient().DeleteContentGenerationTask(ctx, model.DeleteContentGenerationTaskRequest{ID: id})
+	breaker.For(ratelimit.ProviderArk).Record(err)
+	return err
+}
+
+// ParseCallback 方舟回调的请求体与查询任务的响应结构相同
+func (arkVideoGenerator) ParseCallback(body []byte) (*VideoTask, error) {
+	var resp model.GetContentGenerationTaskResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.ID == "" {
+		return nil, errors.New("ark: callback without task id")
+	}
+	return arkVideoTask(resp), nil
+}
+
+func arkVideoTask(resp model.GetContentGenerationTaskResponse) *VideoTask {
+	t := &VideoTask{ID: resp.ID, Status: arkVideoStatus(resp.Status)}
+	if t.Status == models.I2VSubTaskSucceeded {
+		t.VideoURL = resp.Content.VideoURL
+		t.Tokens = int64(resp.Usage.CompletionTokens)
+	}
+	if resp.Error != nil {
+		t.Error = resp.Error.Message
+	}
+	return t
+}
+
+// arkVideoStatus 把方舟的任务状态映射为 models.I2VSubTask*；未知状态按生成中处理，继续轮询
+func arkVideoStatus(status string) string {
+	switch s := strings.ToLower(status); s {
+	case models.I2VSubTaskQueued, models.I2VSubTaskRunning, models.I2VSubTaskSucceeded,
+		models.I2VSubTaskFailed, models.I2VSubTaskCancelled:
+		return s
+	case "canceled":
+		return models.I2VSubTaskCancelled
+	default:
+		log.Printf("ark: unknown content generation status %q, treating as running", status)
+		return models.I2VSubTaskRunning
+	}
+}
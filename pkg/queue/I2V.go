@@ -4,18 +4,15 @@ import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
 	"V2V/models"
+	"V2V/pkg/provider"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"log"
 	"strconv"
 	"sync"
-
-	"github.com/streadway/amqp"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
-	"github.com/volcengine/volcengine-go-sdk/volcengine"
+	"time"
 )
 
 // TODO： 实现I2V消息队列接口
@@ -23,6 +20,8 @@ import (
 type I2VMessageQueue interface {
 	PublishI2VTask([]byte, int) error
 	ConsumeI2V() error
+	Shutdown(ctx context.Context) error
+	Ping() error
 	Close() error
 }
 
@@ -56,169 +55,133 @@ func GetI2VRabbitMQ() (I2VMessageQueue, error) {
 	return i2vInstance, nil
 }
 
-// --- I2V AMQP 实现 ---
+// --- I2V 任务 ---
+
+const i2vQueueName = "i2v_task_queue"
+
+// i2vJob I2V 任务：为每张分镜图片提交一个视频生成子任务，结果由延迟检查队列轮询；
+// 提交最终失败时该分镜计为失败，主任务照常到达终态
+var i2vJob = JobType[models.I2VTask]{
+	JobSpec: JobSpec{
+		Name:                 "i2v",
+		Queue:                i2vQueueName,
+		DeadLetterExchange:   "i2v_dead_letter_exchange",
+		DeadLetterRoutingKey: i2vQueueName + "_dlq",
+		DeadLetterQueue:      i2vQueueName + "_dlq",
+		Persistent:           true,
+		// 并发数与 prefetch 来自 queue.consumers.i2v
+		Retry: RetryPolicy{MaxRetries: 3},
+	},
+	Handle:    handleI2V,
+	OnFailure: failI2V,
+}
+
+// i2vAMQPQueue 在通用任务队列上提供 I2VMessageQueue 的方法名
 type i2vAMQPQueue struct {
-	conn      *amqp.Connection
-	ch        *amqp.Channel
-	queueName string
+	*JobQueue[models.I2VTask]
 }
 
 func newI2VAMQPQueue(dsn string) (I2VMessageQueue, error) {
-	conn, err := amqp.Dial(dsn)
-	if err != nil {
-		return nil, err
-	}
-
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, err
-	}
-
-	// I2V专用死信交换机和队列
-	err = ch.ExchangeDeclare(
-		"i2v_dead_letter_exchange",
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	jt := i2vJob
+	jt.Concurrency = queueConf.Consumers.I2V.Concurrency
+	jt.Prefetch = queueConf.Consumers.I2V.Prefetch
+	jt.Breakers = []string{provider.Videos().Platform()}
+	q, err := NewJobQueue(dsn, jt)
 	if err != nil {
-		ch.Close()
-		conn.Close()
 		return nil, err
 	}
-
-	queueName := "i2v_task_queue"
-	_, err = ch.QueueDeclare(
-		queueName,
-		true,
-		false,
-		false,
-		false,
-		amqp.Table{
-			"x-dead-letter-exchange":    "i2v_dead_letter_exchange",
-			"x-dead-letter-routing-key": queueName + "_dlq",
-		},
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
-	}
-
-	return &i2vAMQPQueue{
-		conn:      conn,
-		ch:        ch,
-		queueName: queueName,
-	}, nil
-}
-func (q *i2vAMQPQueue) PublishI2VTask(body []byte, priority int) error {
-	return q.ch.Publish(
-		"",
-		q.queueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-			Priority:    uint8(priority),
-		},
-	)
+	return i2vAMQPQueue{q}, nil
 }
-func (q *i2vAMQPQueue) ConsumeI2V() error {
-	msgs, err := q.ch.Consume(
-		q.queueName,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		for d := range msgs {
-			// 处理I2V任务消息
-			var i2vTask models.I2VTask
-			err := json.Unmarshal(d.Body, &i2vTask)
-			if err != nil {
-				fmt.Printf("Failed to unmarshal I2V task: %v\n", err)
-				d.Nack(false, false)
-				continue
-			}
-
-			// 创建I2V任务
-			err = createI2VTask(i2vTask.ImageURL, i2vTask.Prompt, i2vTask.Index, int(i2vTask.TaskID), i2vTask.UserID)
-			if err != nil {
-				fmt.Printf("Failed to create I2V task: %v\n", err)
-				d.Nack(false, true) // 重试
-				continue
-			}
-
-			if err != nil {
-				fmt.Printf("Failed to insert I2V task to DB: %v\n", err)
-				d.Nack(false, true) // 重试
-				continue
-			}
 
-			d.Ack(false)
-			fmt.Printf("I2V task processed successfully: UserID=%d, TaskID=%d, Index=%d\n", i2vTask.UserID, i2vTask.TaskID, i2vTask.Index)
-		}
-	}()
+func (q i2vAMQPQueue) PublishI2VTask(body []byte, priority int) error {
+	return q.Publish(body, priority)
+}
 
-	return nil
+// ConsumeI2V 消费I2V任务（连接断开后会在重连成功时自动重新订阅）
+func (q i2vAMQPQueue) ConsumeI2V() error {
+	return q.Consume()
 }
-func (q *i2vAMQPQueue) Close() error {
-	if err := q.ch.Close(); err != nil {
+
+func handleI2V(ctx context.Context, job *Job[models.I2VTask]) error {
+	i2vTask := job.Payload
+	// 创建I2V任务
+	if err := createI2VTask(ctx, i2vTask); err != nil {
+		fmt.Printf("Failed to create I2V task: %v\n", err)
 		return err
 	}
-	return q.conn.Close()
+	fmt.Printf("I2V task processed successfully: UserID=%d, TaskID=%d, Index=%d\n", i2vTask.UserID, i2vTask.TaskID, i2vTask.Index)
+	return nil
 }
 
-func createI2VTask(refImg, prompts string, index, taskID int, userId uint64) error {
-	// err := createI2VTask(img, prompts, idx+1, int(taskID))
-	client := arkruntime.NewClientWithApiKey(
-		os.Getenv("ARK_API_KEY"),
-		arkruntime.WithBaseUrl("https://ark.cn-beijing.volces.com/api/v3"),
-	)
-	ctx := context.Background()
-	modelEp := "doubao-seedance-1-0-pro-250528"
-
-	fmt.Println("----- create content generation task -----")
-
-	createReq := model.CreateContentGenerationTaskRequest{
-		Model: modelEp,
-		Content: []*model.CreateContentGenerationContentItem{
-			{
-				Type: model.ContentGenerationContentItemTypeText,
-				Text: volcengine.String("根据文本与参考图生成第" + strconv.FormatInt(int64(index), 10) + "张分镜的视频" + prompts + " --resolution 720p"),
-			},
-			{
-				Type: model.ContentGenerationContentItemTypeImage,
-				ImageURL: &model.ImageURL{
-					URL: refImg,
-				},
-			},
-		},
+// failI2V 子任务提交最终失败（永久错误或重试耗尽）时计为失败：已创建并记录的服务端任务尽量取消，避免继续计费
+func failI2V(ctx context.Context, job *Job[models.I2VTask], err error) {
+	t := job.Payload
+	taskID := strconv.FormatUint(t.TaskID, 10)
+	subTaskID, lerr := store.GetI2VSubTaskID(int(t.TaskID), t.Index, t.UserID)
+	if lerr != nil {
+		log.Printf("i2v task %s part %d: failed to look up sub-task: %v", taskID, t.Index, lerr)
+	}
+	if subTaskID != "" {
+		if cerr := provider.Videos().CancelVideoTask(ctx, subTaskID); cerr != nil {
+			log.Printf("i2v subtask %s: cancel after failure failed: %v", subTaskID, cerr)
+		}
 	}
+	failI2VSubTask(ctx, t.UserID, taskID, t.Index, subTaskID, err)
+}
 
-	createResponse, err := client.CreateContentGenerationTask(ctx, createReq)
+// createI2VTask 创建单个分镜的视频生成任务；生成参数在提交时已按用户等级校验并补全默认值，
+// 提示词按提交时记录的模板版本渲染。
+// 子任务创建后即开始计费：创建成功后先把子任务 ID 记录到 Redis，之后的步骤失败重试时沿用已记录的子任务，
+// 不再重复创建；记录本身失败时不再重试
+func createI2VTask(ctx context.Context, t models.I2VTask) error {
+	refImg, prompts, index, taskID, userId, opts := t.ImageURL, t.Prompt, t.Index, int(t.TaskID), t.UserID, t.Options
+	subTaskID, err := store.GetI2VSubTaskID(taskID, index, userId)
 	if err != nil {
-		fmt.Printf("create content generation error: %v", err)
-		return err
+		return fmt.Errorf("failed to look up I2V sub-task of task %d part %d: %w", taskID, index, err)
 	}
-	fmt.Printf("Task Created with ID: %s \n", createResponse.ID)
-	//打印createResponse
-	fmt.Printf("Create Response: %+v\n", createResponse)
-	err = store.I2VTaskID(taskID, index, createResponse.ID, userId)
-	err = mysql.InsertI2VTask(taskID, index, createResponse.ID, userId, prompts)
-	if err != nil {
+	created := false
+	if subTaskID != "" {
+		fmt.Printf("Resuming I2V sub-task %s of task %d part %d\n", subTaskID, taskID, index)
+	} else {
+		fmt.Println("----- create content generation task -----")
+		text, err := renderPrompt(models.PromptI2V, t.PromptTemplate, map[string]interface{}{
+			"index":       index,
+			"shot_no":     t.ShotNo,
+			"prompt":      prompts,
+			"camera_move": t.CameraMove,
+			"duration":    opts.Duration,
+		})
+		if err != nil {
+			return err
+		}
+		subTaskID, err = provider.Videos().CreateVideoTask(ctx, provider.VideoRequest{
+			Model:       opts.Model,
+			Prompt:      text,
+			ImageURL:    refImg,
+			Resolution:  opts.Resolution,
+			AspectRatio: opts.AspectRatio,
+			Duration:    opts.Duration,
+			Seed:        opts.Seed,
+			Watermark:   opts.Watermark,
+			CameraFixed: opts.CameraFixed,
+		})
+		if err != nil {
+			fmt.Printf("create content generation error: %v", err)
+			return err
+		}
+		created = true
+		fmt.Printf("Task Created with ID: %s \n", subTaskID)
+	}
+	if err := store.I2VTaskID(taskID, index, subTaskID, userId); err != nil {
+		// 子任务 ID 没有记录下来时重试会重复创建（重复计费），交给死信队列人工处理
+		if created {
+			if recorded, _ := store.GetI2VSubTaskID(taskID, index, userId); recorded != subTaskID {
+				return Permanent(fmt.Errorf("I2V sub-task %s of task %d part %d created but not recorded: %w", subTaskID, taskID, index, err))
+			}
+		}
+		return fmt.Errorf("failed to store I2V sub-task %s: %w", subTaskID, err)
+	}
+	if err := mysql.InsertI2VTask(taskID, index, t.ShotNo, subTaskID, userId, prompts, opts, t.PromptTemplate); err != nil {
 		fmt.Printf("Failed to insert I2V task to DB: %v\n", err)
 		return err
 	}
@@ -228,21 +191,18 @@ func createI2VTask(refImg, prompts string, index, taskID int, userId uint64) err
 		fmt.Printf("Failed to get delayed I2V queue: %v\n", err)
 		return err
 	}
-	checkTask := struct {
-		UserID    uint64 `json:"user_id"`
-		TaskID    string `json:"task_id"`
-		SubTaskID string `json:"sub_task_id"`
-	}{
+	checkTask := i2vCheckTask{
 		UserID:    userId,
 		TaskID:    strconv.Itoa(taskID),
-		SubTaskID: createResponse.ID,
+		SubTaskID: subTaskID,
+		StartedAt: time.Now().Unix(),
 	}
 	body, err := json.Marshal(checkTask)
 	if err != nil {
 		fmt.Printf("Failed to marshal delayed check task: %v\n", err)
 		return err
 	}
-	err = delayedI2VAMQPQueueInstance.PublishDelayedCheck(body) // 延迟60秒检查
+	err = delayedI2VAMQPQueueInstance.PublishDelayedCheck(body) // 按 queue.i2v_poll.initial_delay 延迟检查
 	if err != nil {
 		fmt.Printf("Failed to publish delayed check task: %v\n", err)
 	}
@@ -3,292 +3,351 @@ package queue
 import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
+	"V2V/models"
+	"V2V/pkg/provider"
 	"V2V/pkg/sse"
 	"V2V/util"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"strconv"
-	"strings"
+	"time"
 
-	"github.com/streadway/amqp"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
+	"github.com/go-redis/redis"
 )
 
 // 延迟队列相关的方法和结构
 
 type DelayedI2VQueue interface {
+	// PublishDelayedCheck 按首次轮询间隔发布检查消息
 	PublishDelayedCheck(b []byte) error
+	// RescheduleCheck 子任务未完成时在 delay 后再次检查
+	RescheduleCheck(b []byte, delay time.Duration) error
 	ConsumeDelayedChecks() error
+	Shutdown(ctx context.Context) error
+	Ping() error
 }
 
-// --- 延迟队列 AMQP 实现 ---
+// --- 延迟检查任务 ---
+
+const delayedCheckQueueName = "i2v_delayed_check_queue"
+
+// i2vCheckTask 延迟检查消息：查询一个 I2V 子任务的生成结果
+type i2vCheckTask struct {
+	UserID    uint64 `json:"user_id"`
+	TaskID    string `json:"task_id"`
+	SubTaskID string `json:"sub_task_id"`
+	// StartedAt 子任务提交时间（unix 秒），用于计算轮询截止时间；旧消息没有该字段时从首次检查开始计时
+	StartedAt int64 `json:"started_at,omitempty"`
+	// Polls 已经查询过的次数
+	Polls int `json:"polls,omitempty"`
+}
+
+// i2vCheckJob 通过 x-delayed-message 交换机延迟投递，到期后查询子任务状态：
+// 未到终态时按 queue.i2v_poll 递增间隔重新发布，超过截止时间标记为 timed_out；全部完成时拼接视频。
+// 处理失败且重试耗尽的检查进入死信队列（子任务计为失败），可以通过 /admin/dlq/i2v-check 查看与回放。
+// 该队列最初声明时没有死信参数，死信路由通过 RabbitMQ policy 配置（见 QUICKSTART），已有部署升级时无需删除队列
+var i2vCheckJob = JobType[i2vCheckTask]{
+	JobSpec: JobSpec{
+		Name:                 "i2v-check",
+		Queue:                delayedCheckQueueName,
+		DeadLetterExchange:   "i2v_check_dlq_exchange",
+		DeadLetterRoutingKey: delayedCheckQueueName + "_dlq",
+		DeadLetterQueue:      delayedCheckQueueName + "_dlq",
+		DeadLetterByPolicy:   true,
+		DelayedExchange:      "i2v_delayed_exchange",
+		// 首次检查延迟来自 queue.i2v_poll.initial_delay
+		Persistent: true,
+		// 并发数与 prefetch 来自 queue.consumers.i2v_check
+		Retry: RetryPolicy{MaxRetries: 10},
+	},
+	Handle:    handleI2VCheck,
+	OnFailure: failI2VCheck,
+}
+
+// delayedI2VAMQPQueue 在通用任务队列上提供 DelayedI2VQueue 的方法名
 type delayedI2VAMQPQueue struct {
-	conn      *amqp.Connection
-	ch        *amqp.Channel
-	queueName string
+	*JobQueue[i2vCheckTask]
 }
 
 func NewDelayedI2VAMQPQueue(dsn string) (DelayedI2VQueue, error) {
-	conn, err := amqp.Dial(dsn)
+	jt := i2vCheckJob
+	jt.Concurrency = queueConf.Consumers.I2VCheck.Concurrency
+	jt.Prefetch = queueConf.Consumers.I2VCheck.Prefetch
+	jt.Breakers = []string{provider.Videos().Platform()}
+	jt.Delay = queueConf.I2VPoll.InitialDelay.Duration
+	q, err := NewJobQueue(dsn, jt)
 	if err != nil {
 		return nil, err
 	}
+	return delayedI2VAMQPQueue{q}, nil
+}
+
+// PublishDelayedCheck 发布延迟检查消息
+func (q delayedI2VAMQPQueue) PublishDelayedCheck(b []byte) error {
+	return q.Publish(b, 0)
+}
 
-	ch, err := conn.Channel()
+// RescheduleCheck 在 delay 后再次检查
+func (q delayedI2VAMQPQueue) RescheduleCheck(b []byte, delay time.Duration) error {
+	return q.publishDelayed(b, 0, nil, delay)
+}
+
+// ConsumeDelayedChecks 消费延迟检查消息
+// 连接断开后会在重连成功时自动重新订阅
+func (q delayedI2VAMQPQueue) ConsumeDelayedChecks() error {
+	return q.Consume()
+}
+
+// handleI2VCheck 查询子任务状态：未到终态时向 Ark 查询最新状态并更新统计；
+// 仍在生成中或查询失败则递增间隔重新发布检查，超过截止时间（包括一直查询失败）标记为 timed_out；全部完成时拼接视频
+func handleI2VCheck(ctx context.Context, job *Job[i2vCheckTask]) error {
+	checkTask := job.Payload
+
+	// 检查Redis中的状态
+	redisClient := store.GetRedis()
+	key := "user:" + strconv.FormatUint(checkTask.UserID, 10) + ":i2vtask:" + checkTask.SubTaskID + ":video_url"
+	key2 := "user:" + strconv.FormatUint(checkTask.UserID, 10) + ":i2vtaskstatus:" + checkTask.TaskID
+	status, err := redisClient.HGet(key, "status").Result()
+	if err == redis.Nil {
+		// 子任务记录不存在（已过期或从未写入），重试也查不到
+		return Permanent(fmt.Errorf("i2v subtask %s: status not found in redis (key %s)", checkTask.SubTaskID, key))
+	}
 	if err != nil {
-		conn.Close()
-		return nil, err
+		log.Printf("i2v subtask %s: failed to get status from redis: %v", checkTask.SubTaskID, err)
+		return err
 	}
 
-	// 声明延迟队列的交换机（x-delayed-message类型）
-	err = ch.ExchangeDeclare(
-		"i2v_delayed_exchange",
-		"x-delayed-message",
-		true,
-		false,
-		false,
-		false,
-		amqp.Table{
-			"x-delayed-type": "direct",
-		},
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, fmt.Errorf("Failed to declare delayed exchange: %v", err)
+	// 如果状态不是终态，则查询最新状态
+	if !models.IsI2VSubTaskTerminal(status) {
+		if checkTask.StartedAt == 0 {
+			checkTask.StartedAt = time.Now().Unix()
+		}
+		deadline := time.Unix(checkTask.StartedAt, 0).Add(queueConf.I2VPoll.Timeout.Duration)
+		videos := provider.Videos()
+		task, err := videos.GetVideoTask(ctx, checkTask.SubTaskID)
+		if err != nil {
+			log.Printf("i2v subtask %s: failed to get task result: %v", checkTask.SubTaskID, err)
+			if time.Now().Before(deadline) {
+				// 查询失败（服务不可用、限流等待超时等）：按轮询间隔再查，保留 StartedAt / Polls，
+				// 不走通用重试（重新投递原消息会丢失轮询进度，重试次数用完后消息被丢弃）
+				return rescheduleI2VCheck(checkTask, deadline)
+			}
+			// 截止时间已过仍查询不到结果：按超时处理
+			task = &provider.VideoTask{ID: checkTask.SubTaskID, Status: "unknown", Error: "query failed: " + err.Error()}
+		}
+
+		newStatus := task.Status
+		errMsg := task.Error
+		// 超过截止时间仍未完成：标记为超时，计入失败数，并尽量取消服务端任务避免继续计费
+		if !models.IsI2VSubTaskTerminal(newStatus) && !time.Now().Before(deadline) {
+			log.Printf("i2v subtask %s timed out after %d polls (last status %s)", checkTask.SubTaskID, checkTask.Polls+1, task.Status)
+			newStatus = models.I2VSubTaskTimedOut
+			errMsg = fmt.Sprintf("no result within %s, last status %s", queueConf.I2VPoll.Timeout.Duration, task.Status)
+			if task.Error != "" {
+				errMsg += ", " + task.Error
+			}
+			if err := videos.CancelVideoTask(ctx, checkTask.SubTaskID); err != nil {
+				log.Printf("i2v subtask %s: cancel after timeout failed: %v", checkTask.SubTaskID, err)
+			}
+		}
+
+		// 更新Redis中的状态（使用相同的Lua脚本保持原子性）
+		contentURL := ""
+		if newStatus == models.I2VSubTaskSucceeded {
+			log.Println("succeed subtask id:", checkTask.SubTaskID)
+			contentURL = task.VideoURL
+			//暂时不扣费
+			// temptaskid, _ := strconv.ParseUint(checkTask.TaskID, 10, 64)
+			// mysql.DeductTokensForTask(checkTask.UserID, temptaskid, int64(resp.Usage.CompletionTokens))
+		}
+
+		succeeded, failed, total, changed, err := setI2VSubTaskStatus(key, "status", key2, newStatus, contentURL)
+		if err != nil {
+			log.Printf("i2v subtask %s: failed to update redis status: %v", checkTask.SubTaskID, err)
+			return Requeue(err)
+		}
+		if !models.IsI2VSubTaskTerminal(newStatus) {
+			// 仍在排队 / 生成中：递增间隔后再次检查
+			return rescheduleI2VCheck(checkTask, deadline)
+		}
+		if !changed {
+			// 状态已由回调或其他检查更新过
+			return nil
+		}
+
+		if newStatus == models.I2VSubTaskSucceeded {
+			mysql.UpdateI2VTask(checkTask.SubTaskID, contentURL, int(task.Tokens))
+			//暂时不扣费
+			// temptaskid, _ := strconv.ParseUint(checkTask.TaskID, 10, 64)
+			// mysql.DeductTokensForTask(checkTask.UserID, temptaskid, int64(resp.Usage.CompletionTokens))
+		} else {
+			mysql.UpdateI2VTaskStatus(checkTask.SubTaskID, newStatus, errMsg)
+		}
+
+		notifyI2VProgress(ctx, checkTask.UserID, checkTask.TaskID, succeeded, failed, total)
 	}
+	//获得拿到Redis的状态后发送SSE事件给前端
+
+	return nil
+}
 
-	// 声明延迟队列
-	queueName := "i2v_delayed_check_queue"
-	_, err = ch.QueueDeclare(
-		queueName,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+// i2vSubTaskStatusScript 原子地把子任务状态（KEYS[1] 的 ARGV[1] 字段）迁移到终态并更新主任务计数（ARGV[4]），
+// 与 I2VCallback 的脚本保持一致：已是终态时不再变化。failed / cancelled / timed_out 都计入失败数；
+// 主任务的状态记录不存在（已过期）时不写入任何内容。
+// 返回 {succeeded, failed, total, changed}，changed 表示本次调用是否完成了到终态的迁移
+// （并发消费时只有完成最后一个子任务的那次调用负责拼接视频）
+const i2vSubTaskStatusScript = `
+	local key = KEYS[1]
+	local field = ARGV[1]
+	local new = ARGV[2]
+	local video_url = ARGV[3]
+	local key2 = ARGV[4]
+	local changed = 0
+	if redis.call('EXISTS', key2) == 0 then
+		return {'0', '0', '0', 0}
+	end
+	local old = redis.call('HGET', key, field)
+	if old ~= 'succeeded' and old ~= 'failed' and old ~= 'cancelled' and old ~= 'timed_out' then
+		redis.call('HSET', key, field, new)
+		if new == 'succeeded' then
+			redis.call('HINCRBY', key2, 'succeeded', 1)
+			redis.call('HSET', key, 'video_url', video_url)
+			changed = 1
+		elseif new == 'failed' or new == 'cancelled' or new == 'timed_out' then
+			redis.call('HINCRBY', key2, 'failed', 1)
+			changed = 1
+		end
+	end
+	return {redis.call('HGET', key2, 'succeeded') or '0', redis.call('HGET', key2, 'failed') or '0',
+		redis.call('HGET', key2, 'total') or '0', changed}
+`
+
+// setI2VSubTaskStatus 执行 i2vSubTaskStatusScript，返回主任务的成功数、失败数、总数与本次是否迁移到终态
+func setI2VSubTaskStatus(key, field, statusKey, status, videoURL string) (succeeded, failed, total int64, changed bool, err error) {
+	res, err := store.GetRedis().Eval(i2vSubTaskStatusScript, []string{key}, field, status, videoURL, statusKey).Result()
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
+		return 0, 0, 0, false, err
+	}
+	counts, ok := res.([]interface{})
+	if !ok || len(counts) != 4 {
+		return 0, 0, 0, false, fmt.Errorf("unexpected task statistics for %s: %v", statusKey, res)
 	}
+	parse := func(v interface{}) int64 {
+		str, _ := v.(string)
+		n, _ := strconv.ParseInt(str, 10, 64)
+		return n
+	}
+	flag, _ := counts[3].(int64)
+	return parse(counts[0]), parse(counts[1]), parse(counts[2]), flag == 1, nil
+}
 
-	// 绑定延迟队列到交换机
-	err = ch.QueueBind(
-		queueName,
-		queueName,
-		"i2v_delayed_exchange",
-		false,
-		nil,
-	)
+// notifyI2VProgress 子任务到达终态后通知前端：有失败时推送失败，全部成功时拼接视频并推送成功
+func notifyI2VProgress(ctx context.Context, userID uint64, taskID string, succeeded, failed, total int64) {
+	var sseMsg map[string]interface{}
+	if failed > 0 {
+		sseMsg = map[string]interface{}{
+			"code":      500,
+			"status":    "failed",
+			"task_id":   taskID,
+			"succeeded": succeeded,
+			"failed":    failed,
+			"total":     total,
+		}
+	} else if succeeded+failed == total && total > 0 {
+		// 所有任务完成且没有失败
+		if _, err := util.FFmpeg(ctx, userID, taskID); err != nil {
+			log.Printf("Failed to concat videos for task %s: %v", taskID, err)
+		}
+		sseMsg = map[string]interface{}{
+			"code":      200,
+			"status":    "success",
+			"task_id":   taskID,
+			"succeeded": succeeded,
+			"failed":    failed,
+			"total":     total,
+		}
+	}
+	if sseMsg == nil {
+		return
+	}
+	msgBytes, err := json.Marshal(sseMsg)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
+		log.Printf("Failed to marshal SSE message: %v", err)
+		return
+	}
+	topic := strconv.FormatUint(userID, 10)
+	if hub := sse.GetHub(); hub != nil {
+		hub.PublishTopic(topic, msgBytes)
+		log.Printf("Published SSE message for user %s: %s", topic, string(msgBytes))
 	}
+}
 
-	return &delayedI2VAMQPQueue{
-		conn:      conn,
-		ch:        ch,
-		queueName: queueName,
-	}, nil
+// failI2VSubTask 子任务的提交或状态检查最终失败（进入死信）时把它计为失败，使主任务仍能到达终态。
+// subTaskID 为空（服务端任务没有创建或没有记录下来）时按分镜序号记录在主任务的状态记录中，重复调用只计一次
+func failI2VSubTask(ctx context.Context, userID uint64, taskID string, index int, subTaskID string, err error) {
+	uid := strconv.FormatUint(userID, 10)
+	statusKey := "user:" + uid + ":i2vtaskstatus:" + taskID
+	key, field := statusKey, "part:"+strconv.Itoa(index)+":status"
+	if subTaskID != "" {
+		key, field = "user:"+uid+":i2vtask:"+subTaskID+":video_url", "status"
+	}
+	succeeded, failed, total, changed, serr := setI2VSubTaskStatus(key, field, statusKey, models.I2VSubTaskFailed, "")
+	if serr != nil {
+		log.Printf("i2v task %s part %d: failed to record failure in redis: %v", taskID, index, serr)
+		return
+	}
+	if !changed {
+		return
+	}
+	if subTaskID == "" {
+		log.Printf("i2v task %s part %d failed before a subtask was recorded: %v", taskID, index, err)
+	} else {
+		log.Printf("i2v subtask %s of task %s failed: %v", subTaskID, taskID, err)
+		if uerr := mysql.UpdateI2VTaskStatus(subTaskID, models.I2VSubTaskFailed, truncateError(err)); uerr != nil {
+			log.Printf("i2v subtask %s: failed to update status in MySQL: %v", subTaskID, uerr)
+		}
+	}
+	notifyI2VProgress(ctx, userID, taskID, succeeded, failed, total)
 }
 
-// PublishDelayedCheck 发布延迟检查消息
-func (q *delayedI2VAMQPQueue) PublishDelayedCheck(b []byte) error {
-	return q.ch.Publish(
-		"i2v_delayed_exchange",
-		q.queueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        b,
-			Headers: amqp.Table{
-				"x-delay": 60000, // 5分钟 = 300000毫秒
-			},
-		},
-	)
+// failI2VCheck 状态检查进入死信（子任务记录缺失或重试耗尽）时把子任务计为失败
+func failI2VCheck(ctx context.Context, job *Job[i2vCheckTask], err error) {
+	t := job.Payload
+	// 检查消息中没有分镜序号，子任务 ID 总是存在
+	failI2VSubTask(ctx, t.UserID, t.TaskID, 0, t.SubTaskID, err)
 }
 
-// ConsumeDelayedChecks 消费延迟检查消息
-func (q *delayedI2VAMQPQueue) ConsumeDelayedChecks() error {
-	msgs, err := q.ch.Consume(
-		q.queueName,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
+// rescheduleI2VCheck 子任务仍未完成：按 queue.i2v_poll 递增间隔再次发布检查消息，最晚在截止时间再查一次
+func rescheduleI2VCheck(t i2vCheckTask, deadline time.Time) error {
+	t.Polls++
+	p := queueConf.I2VPoll
+	policy := RetryPolicy{
+		BaseDelay:  p.InitialDelay.Duration,
+		MaxDelay:   p.MaxDelay.Duration,
+		Multiplier: p.Multiplier,
+		Jitter:     p.Jitter,
+	}
+	delay := policy.Backoff(t.Polls + 1)
+	if remaining := time.Until(deadline); delay > remaining {
+		delay = remaining
+	}
+	if delay < time.Second {
+		delay = time.Second
+	}
+	body, err := json.Marshal(t)
+	if err != nil {
+		return Permanent(err)
+	}
+	q, err := GetDelayedI2VQueue()
 	if err != nil {
 		return err
 	}
-
-	go func() {
-		for d := range msgs {
-			var checkTask struct {
-				UserID    uint64 `json:"user_id"`
-				TaskID    string `json:"task_id"`
-				SubTaskID string `json:"sub_task_id"`
-			}
-			if err := json.Unmarshal(d.Body, &checkTask); err != nil {
-				fmt.Printf("Failed to unmarshal delayed check task: %v\n", err)
-				d.Nack(false, false)
-				continue
-			}
-
-			// 检查Redis中的状态
-			redisClient := store.GetRedis()
-			key := "user:" + strconv.FormatUint(checkTask.UserID, 10) + ":i2vtask:" + checkTask.SubTaskID + ":video_url"
-			key2 := "user:" + strconv.FormatUint(checkTask.UserID, 10) + ":i2vtaskstatus:" + checkTask.TaskID
-			status, err := redisClient.HGet(key, "status").Result()
-			if err != nil {
-				fmt.Printf("Failed to get task status from Redis: %v\n", err)
-				fmt.Println("key:", key)
-				d.Nack(false, false) // 重试
-				continue
-			} else {
-				fmt.Println("succeed key:", key)
-			}
-
-			// 如果状态不是终态，则查询最新状态
-			if status != "succeeded" && status != "failed" {
-				client := arkruntime.NewClientWithApiKey(os.Getenv("ARK_API_KEY"))
-				ctx := context.Background()
-
-				req := model.GetContentGenerationTaskRequest{}
-				req.ID = checkTask.SubTaskID
-
-				resp, err := client.GetContentGenerationTask(ctx, req)
-				if err != nil {
-					fmt.Printf("Failed to get task result: %v\n", err)
-					d.Nack(false, true) // 重试
-					continue
-				}
-
-				// 更新Redis中的状态（使用相同的Lua脚本保持原子性）
-				contentURL := ""
-				if resp.Status == "succeeded" {
-					log.Println("succeed subtask id:", checkTask.SubTaskID)
-					contentURL = resp.Content.VideoURL
-					//暂时不扣费
-					// temptaskid, _ := strconv.ParseUint(checkTask.TaskID, 10, 64)
-					// mysql.DeductTokensForTask(checkTask.UserID, temptaskid, int64(resp.Usage.CompletionTokens))
-				}
-
-				// 使用与I2VCallback相同的Lua脚本更新状态
-				_, err = redisClient.Eval(`
-					local key = KEYS[1]
-					local field = ARGV[1]
-					local new = ARGV[2]
-					local video_url = ARGV[3]
-					local key2 = ARGV[4]
-					local old = redis.call('HGET', key, field)
-					if old == 'succeeded' or old == 'failed' then
-						return {redis.call('HGET', key2, 'succeeded'), redis.call('HGET', key2, 'failed')}
-					end
-					redis.call('HSET', key, field, new)
-					if new == 'succeeded' then
-						redis.call('HINCRBY', key2, 'succeeded', 1)
-						redis.call('HSET', key, 'video_url', video_url)
-					elseif new == 'failed' then
-						redis.call('HINCRBY', key2, 'failed', 1)
-					end
-					return {redis.call('HGET', key2, 'succeeded'), redis.call('HGET', key2, 'failed')}
-				`, []string{key}, "status", strings.ToLower(resp.Status), contentURL, key2).Result()
-
-				if err != nil {
-					fmt.Printf("Failed to update Redis status: %v\n", err)
-					d.Nack(false, true)
-					continue
-				}
-				// 获取任务统计信息
-				succeededStr, err := redisClient.HGet(key2, "succeeded").Result()
-				failedStr, err := redisClient.HGet(key2, "failed").Result()
-				totalStr, err := redisClient.HGet(key2, "total").Result()
-
-				if err != nil {
-					fmt.Printf("Failed to get task statistics key2: %s from Redis: %v\n", key2, err)
-					d.Ack(false)
-					continue
-				}
-
-				if resp.Status == "succeeded" {
-					mysql.UpdateI2VTask(checkTask.SubTaskID, contentURL, resp.Usage.CompletionTokens)
-					//暂时不扣费
-					// temptaskid, _ := strconv.ParseUint(checkTask.TaskID, 10, 64)
-					// mysql.DeductTokensForTask(checkTask.UserID, temptaskid, int64(resp.Usage.CompletionTokens))
-				}
-
-				// 解析计数值
-				succeeded := int64(0)
-				failed := int64(0)
-				total := int64(0)
-
-				if succeededStr != "" {
-					succeeded, _ = strconv.ParseInt(succeededStr, 10, 64)
-				}
-				if failedStr != "" {
-					failed, _ = strconv.ParseInt(failedStr, 10, 64)
-				}
-				if totalStr != "" {
-					total, _ = strconv.ParseInt(totalStr, 10, 64)
-				}
-
-				// 构建 SSE 消息
-				var sseMsg map[string]interface{}
-
-				// 检查是否有失败的任务
-				if failed > 0 {
-					sseMsg = map[string]interface{}{
-						"code":      500,
-						"status":    "failed",
-						"task_id":   checkTask.TaskID,
-						"succeeded": succeeded,
-						"failed":    failed,
-						"total":     total,
-					}
-				} else if succeeded+failed == total && total > 0 {
-					// 所有任务完成且没有失败
-					util.FFmpeg(checkTask.UserID, checkTask.TaskID)
-					sseMsg = map[string]interface{}{
-						"code":      200,
-						"status":    "success",
-						"task_id":   checkTask.TaskID,
-						"succeeded": succeeded,
-						"failed":    failed,
-						"total":     total,
-					}
-				}
-
-				// 发送 SSE 消息给前端
-				if sseMsg != nil {
-					msgBytes, err := json.Marshal(sseMsg)
-					if err != nil {
-						fmt.Printf("Failed to marshal SSE message: %v\n", err)
-					} else {
-						topic := strconv.FormatUint(checkTask.UserID, 10)
-						hub := sse.GetHub()
-						if hub != nil {
-							hub.PublishTopic(topic, msgBytes)
-							fmt.Printf("Published SSE message for user %s: %s\n", topic, string(msgBytes))
-						}
-					}
-				}
-			}
-			//获得拿到Redis的状态后发送SSE事件给前端
-
-			d.Ack(false)
-		}
-	}()
-
+	if err := q.RescheduleCheck(body, delay); err != nil {
+		return fmt.Errorf("reschedule check for subtask %s: %w", t.SubTaskID, err)
+	}
+	log.Printf("i2v subtask %s not finished, check #%d in %s", t.SubTaskID, t.Polls+1, delay.Round(time.Second))
 	return nil
 }
 
@@ -298,7 +357,7 @@ var (
 	delayedInitErr  error
 )
 
-// InitDelayedI2VQueue 初始化延迟队列
+// InitDelayedI2VQueue 初始化延迟队列（只负责连接与声明拓扑，消费者需另外调用 ConsumeDelayedChecks 启动）
 func InitDelayedI2VQueue(dsn string) error {
 	if delayedInstance != nil {
 		return nil
@@ -311,8 +370,7 @@ func InitDelayedI2VQueue(dsn string) error {
 	}
 
 	delayedInstance = inst
-	// 启动消费者
-	return inst.ConsumeDelayedChecks()
+	return nil
 }
 
 // GetDelayedI2VQueue 获取延迟队列实例
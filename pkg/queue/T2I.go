@@ -4,6 +4,7 @@ import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
 	"V2V/models"
+	"V2V/pkg/provider"
 	"V2V/pkg/sse"
 	"V2V/util"
 	"context"
@@ -11,22 +12,17 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
-
-	"github.com/streadway/amqp"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
-	"github.com/volcengine/volcengine-go-sdk/volcengine"
 )
 
 // T2IMessageQueue 文字生图像专用队列接口
 type T2IMessageQueue interface {
 	PublishT2ITask([]byte, int) error
 	ConsumeT2I() error
+	Shutdown(ctx context.Context) error
+	Ping() error
 	Close() error
 }
 
@@ -61,334 +57,312 @@ func GetT2IRabbitMQ() (T2IMessageQueue, error) {
 	return t2iInstance, nil
 }
 
-// --- T2I AMQP 实现 ---
+// --- T2I 任务 ---
+
+const t2iQueueName = "t2i_tasks"
+
+// t2iJob T2I 任务：根据分镜脚本生成每个分镜的首帧图片
+var t2iJob = JobType[models.T2ITask]{
+	JobSpec: JobSpec{
+		Name:                 "t2i",
+		Queue:                t2iQueueName,
+		MaxPriority:          10,
+		DeadLetterExchange:   "t2i_dlq_exchange",
+		DeadLetterRoutingKey: "t2i_dlq",
+		DeadLetterQueue:      "t2i_dlq",
+		// 失败重试经由延迟交换机按退避时间投递，退避参数来自 queue.retry.t2i
+		RetryExchange: "t2i_retry_exchange",
+		Persistent:    true,
+		Prefetch:      5, // T2I任务可能更耗资源，prefetch 可以小一些
+		Concurrency:   10,
+		// Breakers 为配置的生图服务所在平台，见 newT2IAMQPQueue
+	},
+	Handle:    handleT2I,
+	OnRetry:   retryT2I,
+	OnFailure: failT2I,
+}
+
+// t2iAMQPQueue 在通用任务队列上提供 T2IMessageQueue 的方法名
 type t2iAMQPQueue struct {
-	conn      *amqp.Connection
-	ch        *amqp.Channel
-	queueName string
+	*JobQueue[models.T2ITask]
 }
 
 func newT2IAMQPQueue(dsn string) (T2IMessageQueue, error) {
-	conn, err := amqp.Dial(dsn)
-	if err != nil {
-		return nil, err
-	}
-
-	ch, err := conn.Channel()
+	jt := t2iJob
+	jt.Retry = retryPolicyFrom(queueConf.Retry.T2I)
+	jt.Breakers = []string{provider.Images().Platform()}
+	q, err := NewJobQueue(dsn, jt)
 	if err != nil {
-		conn.Close()
-		return nil, err
-	}
-
-	// T2I专用死信交换机和队列
-	dlxName := "t2i_dlq_exchange"
-	dlqName := "t2i_dlq"
-
-	// 声明死信交换机
-	if err := ch.ExchangeDeclare(dlxName, "direct", true, false, false, false, nil); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
-	}
-
-	// 声明死信队列
-	if _, err := ch.QueueDeclare(dlqName, true, false, false, false, nil); err != nil {
-		ch.Close()
-		conn.Close()
 		return nil, err
 	}
-
-	// 绑定死信队列
-	if err := ch.QueueBind(dlqName, dlqName, dlxName, false, nil); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
-	}
-
-	// 主队列参数，设置死信路由
-	args := amqp.Table{
-		"x-dead-letter-exchange":    dlxName,
-		"x-dead-letter-routing-key": dlqName,
-		"x-max-priority":            10,
-	}
-
-	// 声明T2I任务队列
-
-	// _, _ = ch.QueueDelete("t2i_tasks", false, false, false)
-	q, err := ch.QueueDeclare(
-		"t2i_tasks", // 队列名称不同
-		true,        // durable
-		false,       // delete when unused
-		false,       // exclusive
-		false,       // no-wait
-		args,        // args
-	)
-	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
-	}
-
-	// 设置QoS
-	_ = ch.Qos(5, 0, false) // T2I任务可能更耗资源，并发数可以小一些
-
-	return &t2iAMQPQueue{conn: conn, ch: ch, queueName: q.Name}, nil
+	return t2iAMQPQueue{q}, nil
 }
 
 // PublishT2ITask 发布T2I任务
-func (q *t2iAMQPQueue) PublishT2ITask(b []byte, priority int) error {
+func (q t2iAMQPQueue) PublishT2ITask(b []byte, priority int) error {
+	return q.Publish(b, priority)
+}
 
-	return q.ch.Publish(
-		"", q.queueName, false, false,
-		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         b,
-			DeliveryMode: amqp.Persistent,
-			Priority:     uint8(priority),
-		},
-	)
+// ConsumeT2I 消费T2I任务（连接断开后会在重连成功时自动重新订阅）
+func (q t2iAMQPQueue) ConsumeT2I() error {
+	return q.Consume()
 }
 
-// publishWithHeaders 带header发布（用于重试）
-func (q *t2iAMQPQueue) publishWithHeaders(b []byte, headers amqp.Table) error {
-	msg := amqp.Publishing{
-		ContentType:  "application/json",
-		Body:         b,
-		DeliveryMode: amqp.Persistent,
-		Headers:      headers,
-		Priority:     5, // 默认中等优先级
+// handleT2I 调用文字生图像 API，下载图片并保存结果，最后通过 SSE 通知前端
+func handleT2I(ctx context.Context, job *Job[models.T2ITask]) error {
+	t2iTask := job.Payload
+	taskIDStr := strconv.FormatUint(t2iTask.TaskID, 10)
+	t2iTask.Attempts = job.History
+
+	// 更新任务状态为处理中
+	t2iTask.Status = models.StatusProcessing
+	if err := store.T2ITask(t2iTask); err != nil {
+		return Requeue(fmt.Errorf("failed to update T2I task status to processing, task id: %s: %w", taskIDStr, err))
 	}
-	return q.ch.Publish("", q.queueName, false, false, msg)
-}
 
-// ConsumeT2I 消费T2I任务
-func (q *t2iAMQPQueue) ConsumeT2I() error {
-	deliveries, err := q.ch.Consume(q.queueName, "", false, false, false, false, nil)
+	// 调用文字生图像API
+	result, err := T2IHandler(ctx, t2iTask)
 	if err != nil {
-		return err
+		// 永久错误：提示词不合法等
+		es := err.Error()
+		upper := strings.ToUpper(es)
+		if strings.Contains(upper, "INVALID") || strings.Contains(upper, "SAFETY") || strings.Contains(es, "400") {
+			return Permanent(fmt.Errorf("T2I API, task id: %s: %w", taskIDStr, err))
+		}
+		return fmt.Errorf("T2I API, task id: %s: %w", taskIDStr, err)
 	}
 
-	concurrency := 10 // T2I任务较耗资源，并发数减少
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
-
-	for d := range deliveries {
-		sem <- struct{}{}
-		wg.Add(1)
-
-		go func(del amqp.Delivery) {
-			defer func() { <-sem; wg.Done() }()
-
-			var t2iTask models.T2ITask
-			if err := json.Unmarshal(del.Body, &t2iTask); err != nil {
-				log.Printf("Invalid T2I task payload: %v", err)
-				_ = del.Nack(false, false) // 进入DLQ
-				return
-			}
-
-			taskIDStr := strconv.FormatUint(t2iTask.TaskID, 10)
-
-			// 更新任务状态为处理中
-			t2iTask.Status = models.StatusProcessing
-			if err := store.T2ITask(t2iTask); err != nil {
-				log.Printf("Failed to update T2I task status to processing, task id: %s: %v", taskIDStr, err)
-				_ = del.Nack(false, true) // 重试
-				return
-			}
-
-			// 调用文字生图像API
-			t2iTaskresp, err := T2IHandler(t2iTask)
-			if err != nil {
-				// 错误分类处理
-				es := err.Error()
-				upper := strings.ToUpper(es)
-
-				// 永久错误：提示词不合法等
-				isPermanent := strings.Contains(upper, "INVALID") ||
-					strings.Contains(upper, "SAFETY") ||
-					strings.Contains(es, "400")
-
-				if isPermanent {
-					log.Printf("Permanent error in T2I API, task id: %s: %v", taskIDStr, err)
-					t2iTask.Status = models.StatusFailed
-					store.T2ITask(t2iTask)     // 忽略存储错误
-					_ = del.Nack(false, false) // 进入DLQ
-					return
-				}
-
-				// 检查重试次数
-				attempts := 0
-				if h, ok := del.Headers["x-attempts"]; ok {
-					switch v := h.(type) {
-					case int:
-						attempts = v
-					case int32:
-						attempts = int(v)
-					case int64:
-						attempts = int(v)
-					case string:
-						if n, err := strconv.Atoi(v); err == nil {
-							attempts = n
-						}
-					}
-				}
-
-				maxRetries := 3
-				if attempts >= maxRetries {
-					log.Printf("T2I task exceeded retries, sending to DLQ, task id: %s: %v", taskIDStr, err)
-					t2iTask.Status = models.StatusFailed
-					store.T2ITask(t2iTask)
-					_ = del.Nack(false, false)
-					return
-				}
-
-				// 重试
-				newHeaders := amqp.Table{"x-attempts": attempts + 1}
-				for k, v := range del.Headers {
-					if k != "x-attempts" {
-						newHeaders[k] = v
-					}
-				}
-
-				if err := q.publishWithHeaders(del.Body, newHeaders); err != nil {
-					log.Printf("Failed to republish T2I message for retry, task id: %s: %v", taskIDStr, err)
-					_ = del.Nack(false, false)
-					return
-				}
-
-				log.Printf("Requeued T2I message for retry #%d, task id: %s", attempts+1, taskIDStr)
-				_ = del.Ack(false)
-				return
-			}
-
-			// 处理成功
-			var url string
-			for i, image := range t2iTaskresp.Data {
-
-				if image.Url != nil {
-					//下载图片存储到public/pic目录下
-					err = util.DownloadImages(*image.Url, strconv.FormatUint(t2iTask.TaskID, 10), i)
-					url = url + *image.Url + "|z|k|x|"
-				}
-			}
-			t2iTask.Result = url
-			t2iTask.Status = models.StatusCompleted
-			t2iTask.GeneratedImages = t2iTaskresp.Usage.GeneratedImages
-			t2iTask.Token = t2iTaskresp.Usage.TotalTokens
-			// 存储结果
-			if err := store.T2ITask(t2iTask); err != nil {
-				log.Printf("Failed to update T2I task result, task id: %s: %v", taskIDStr, err)
-				if del.Redelivered {
-					_ = del.Nack(false, false)
-				} else {
-					_ = del.Nack(false, true)
-				}
-				return
-			}
-			if err := mysql.InsertT2ITask(&t2iTask); err != nil {
-				log.Printf("Failed to persist T2I task to MySQL, task id: %s: %v", taskIDStr, err)
-				if del.Redelivered {
-					_ = del.Nack(false, false)
-				} else {
-					_ = del.Nack(false, true)
+	// 处理成功：单张失败的图片跳过，其余照常保存；per_shot 模式下图片与分镜一一对应，
+	// 记录保存下来的每张图片的镜号与失败的分镜
+	perShot := t2iTask.Mode == models.T2IModePerShot
+	t2iTask.ShotNumbers, t2iTask.ShotErrors = nil, nil
+	shotFailed := func(i int, reason string) {
+		if perShot && i < len(t2iTask.Shots) {
+			t2iTask.ShotErrors = append(t2iTask.ShotErrors, models.ShotError{ShotNo: t2iTask.Shots[i].ShotNo, Error: reason})
+		}
+	}
+	var url string
+	for i, image := range result.Images {
+		switch {
+		case image.Error != "":
+			log.Printf("T2I image %d failed, task id: %s: %s", i, taskIDStr, image.Error)
+			shotFailed(i, image.Error)
+			continue
+		case image.URL != "":
+			//下载图片存储到public/pic目录下
+			if err := util.DownloadImages(image.URL, taskIDStr, i); err != nil {
+				log.Printf("Failed to download T2I image %d, task id: %s: %v", i, taskIDStr, err)
+				// per_shot 模式下该分镜按失败上报；整组生成时仍保留服务返回的链接
+				if perShot {
+					shotFailed(i, err.Error())
+					continue
 				}
-				return
 			}
-			//暂时不扣费
-			// _, _, err = mysql.DeductTokensForTask(t2iTask.UserID, t2iTask.TaskID, t2iTask.Token)
-			// if err != nil {
-			// 	log.Printf("Failed to deduct tokens for T2I task, task id: %s: %v", taskIDStr, err)
-			// }
-
-			// SSE通知
-			payload := struct {
-				Code            int    `json:"code"`
-				UserID          uint64 `json:"user_id"`
-				TaskID          uint64 `json:"task_id"`
-				Status          string `json:"status"`
-				Result          string `json:"result,omitempty"`
-				GeneratedImages int64  `json:"generated_images"`
-			}{
-				Code:            200,
-				UserID:          t2iTask.UserID,
-				TaskID:          t2iTask.TaskID,
-				Status:          t2iTask.Status,
-				Result:          t2iTask.Result,
-				GeneratedImages: t2iTask.GeneratedImages,
-			}
-
-			if hub := sse.GetHub(); hub != nil {
-				if b, err := json.Marshal(payload); err == nil {
-					hub.PublishTopic(strconv.FormatUint(t2iTask.UserID, 10), b)
-				}
+			url = url + image.URL + "|z|k|x|"
+		case len(image.Data) > 0:
+			// 服务直接返回图片内容时保存到本地，通过 /pic 静态目录访问
+			name, err := util.SaveImage(image.Data, taskIDStr, i)
+			if err != nil {
+				log.Printf("Failed to save T2I image %d, task id: %s: %v", i, taskIDStr, err)
+				shotFailed(i, "failed to save image")
+				continue
 			}
+			url = url + "/pic/" + name + "|z|k|x|"
+		default:
+			continue
+		}
+		if perShot && i < len(t2iTask.Shots) {
+			t2iTask.ShotNumbers = append(t2iTask.ShotNumbers, t2iTask.Shots[i].ShotNo)
+		}
+	}
+	t2iTask.Result = url
+	if len(t2iTask.ShotErrors) > 0 {
+		failed := make([]string, 0, len(t2iTask.ShotErrors))
+		for _, e := range t2iTask.ShotErrors {
+			failed = append(failed, fmt.Sprintf("shot %d: %s", e.ShotNo, e.Error))
+		}
+		log.Printf("T2I task %s: %d of %d shots failed: %s", taskIDStr, len(t2iTask.ShotErrors), len(t2iTask.Shots), strings.Join(failed, "; "))
+	}
+	t2iTask.Status = models.StatusCompleted
+	t2iTask.GeneratedImages = result.Usage.GeneratedImages
+	t2iTask.Token = result.Usage.TotalTokens
+	// 存储结果
+	if err := store.T2ITask(t2iTask); err != nil {
+		return Requeue(fmt.Errorf("failed to update T2I task result, task id: %s: %w", taskIDStr, err))
+	}
+	if err := mysql.InsertT2ITask(&t2iTask); err != nil {
+		return Requeue(fmt.Errorf("failed to persist T2I task to MySQL, task id: %s: %w", taskIDStr, err))
+	}
+	//暂时不扣费
+	// _, _, err = mysql.DeductTokensForTask(t2iTask.UserID, t2iTask.TaskID, t2iTask.Token)
+	// if err != nil {
+	// 	log.Printf("Failed to deduct tokens for T2I task, task id: %s: %v", taskIDStr, err)
+	// }
+
+	// SSE通知
+	payload := struct {
+		Code            int                `json:"code"`
+		UserID          uint64             `json:"user_id"`
+		TaskID          uint64             `json:"task_id"`
+		Status          string             `json:"status"`
+		Result          string             `json:"result,omitempty"`
+		GeneratedImages int64              `json:"generated_images"`
+		ShotNumbers     []int              `json:"shot_numbers,omitempty"`
+		ShotErrors      []models.ShotError `json:"shot_errors,omitempty"`
+	}{
+		Code:            200,
+		UserID:          t2iTask.UserID,
+		TaskID:          t2iTask.TaskID,
+		Status:          t2iTask.Status,
+		Result:          t2iTask.Result,
+		GeneratedImages: t2iTask.GeneratedImages,
+		ShotNumbers:     t2iTask.ShotNumbers,
+		ShotErrors:      t2iTask.ShotErrors,
+	}
 
-			_ = del.Ack(false)
-			log.Printf("T2I task completed successfully, task id: %s", taskIDStr)
-
-		}(d)
+	if hub := sse.GetHub(); hub != nil {
+		if b, err := json.Marshal(payload); err == nil {
+			hub.PublishTopic(strconv.FormatUint(t2iTask.UserID, 10), b)
+		}
 	}
 
-	wg.Wait()
+	log.Printf("T2I task completed successfully, task id: %s", taskIDStr)
 	return nil
 }
 
-// T2I图像生成函数类型（可以替换为实际的AI服务调用）
+// failT2I 任务最终失败时把状态标记为失败
+func failT2I(ctx context.Context, job *Job[models.T2ITask], err error) {
+	t2iTask := job.Payload
+	t2iTask.Status = models.StatusFailed
+	t2iTask.Attempts = job.History
+	store.T2ITask(t2iTask) // 忽略存储错误
+}
 
-func T2IHandler(T2IRequest models.T2ITask) (model.ImagesResponse, error) {
-	client := arkruntime.NewClientWithApiKey(os.Getenv("ARK_API_KEY"))
-	ctx := context.Background()
+// retryT2I 把等待重试的状态与失败历史写到任务上
+func retryT2I(ctx context.Context, job *Job[models.T2ITask], err error) {
+	t2iTask := job.Payload
+	t2iTask.Status = models.StatusRetrying
+	t2iTask.Attempts = job.History
+	store.T2ITask(t2iTask) // 忽略存储错误
+}
 
-	var sequentialImageGeneration model.SequentialImageGeneration = "auto"
-	maxImages := 15
-	generateReq := model.GenerateImagesRequest{
-		Model:                     "doubao-seedream-4-0-250828",
-		Prompt:                    "请按照分镜数生成图像数" + T2IRequest.Prompt,
-		Size:                      volcengine.String("1K"),
-		ResponseFormat:            volcengine.String(model.GenerateImagesResponseFormatURL),
-		Watermark:                 volcengine.Bool(true),
-		Seed:                      volcengine.Int64(42),
-		SequentialImageGeneration: &sequentialImageGeneration,
-		SequentialImageGenerationOptions: &model.SequentialImageGenerationOptions{
-			MaxImages: &maxImages,
-		},
+// T2IHandler 按分镜脚本调用配置的生图服务生成一组分镜首帧图片
+func T2IHandler(ctx context.Context, T2IRequest models.T2ITask) (*provider.ImageResult, error) {
+	if T2IRequest.Mode == models.T2IModePerShot {
+		return t2iShotImages(ctx, T2IRequest)
 	}
-	//计算执行时间
-	starttime := time.Now()
-	defer func() {
-		elapsed := time.Since(starttime)
-		fmt.Printf("T2I API call took %s\n", elapsed)
-	}()
-	t2iTaskresp, err := client.GenerateImages(ctx, generateReq)
+	// 生成参数在提交时已按用户等级校验并补全默认值
+	opts := T2IRequest.Options
+	text, err := renderPrompt(models.PromptT2I, T2IRequest.PromptTemplate, map[string]interface{}{
+		"storyboard": T2IRequest.Prompt,
+	})
 	if err != nil {
-		fmt.Printf("call GenerateImages error: %v\n", err)
-		return t2iTaskresp, err
+		return nil, err
 	}
-	if t2iTaskresp.Error != nil {
-		fmt.Printf("API returned error: %s - %s\n", t2iTaskresp.Error.Code, t2iTaskresp.Error.Message)
-		return t2iTaskresp, errors.New(t2iTaskresp.Error.Message)
+	req := provider.ImageRequest{
+		Model:       opts.Model,
+		Prompt:      text,
+		MaxImages:   opts.Count,
+		Size:        opts.Size,
+		AspectRatio: opts.AspectRatio,
+		Seed:        opts.Seed,
+		Watermark:   opts.Watermark == nil || *opts.Watermark,
 	}
-	// 输出生成的图片信息
-	fmt.Printf("Generated %d images:\n", len(t2iTaskresp.Data))
-	for i, image := range t2iTaskresp.Data {
-		var url string
-		if image.Url != nil {
-			url = *image.Url
-		} else {
-			url = "N/A"
+	result, err := provider.Images().GenerateImages(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("T2I generated %d images, task id: %s", len(result.Images), strconv.FormatUint(T2IRequest.TaskID, 10))
+	return result, nil
+}
+
+// t2iShotImages 逐镜头生成首帧图片：每个分镜按其图片生成提示词单独调用一次生图服务，
+// 同一任务同时进行的调用数不超过 image_generation.per_shot_concurrency。
+// 返回的图片与 Shots 一一对应、顺序一致，失败的分镜在对应位置记录 Error；全部失败时返回错误按重试策略处理
+func t2iShotImages(ctx context.Context, task models.T2ITask) (*provider.ImageResult, error) {
+	if len(task.Shots) == 0 {
+		return nil, Permanent(errors.New("per_shot mode without storyboard shots"))
+	}
+	opts := task.Options
+	// 先渲染全部提示词，模板错误对所有分镜都一样，直接让任务失败
+	prompts := make([]string, len(task.Shots))
+	for i, shot := range task.Shots {
+		imagePrompt := shot.ImagePrompt
+		if imagePrompt == "" {
+			imagePrompt = shot.Content
+		}
+		text, err := renderPrompt(models.PromptT2IShot, task.PromptTemplate, map[string]interface{}{
+			"shot_no":      shot.ShotNo,
+			"image_prompt": imagePrompt,
+			"framing":      shot.Framing,
+			"content":      shot.Content,
+		})
+		if err != nil {
+			return nil, err
 		}
-		fmt.Printf("Image %d: Size: %s, URL: %s\n", i+1, image.Size, url)
+		prompts[i] = text
 	}
 
-	return t2iTaskresp, nil
-}
+	results := make([]*provider.ImageResult, len(task.Shots))
+	errs := make([]error, len(task.Shots))
+	sem := make(chan struct{}, provider.PerShotConcurrency())
+	var wg sync.WaitGroup
+	for i := range task.Shots {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			results[i], errs[i] = provider.Images().GenerateImages(ctx, provider.ImageRequest{
+				Model:       opts.Model,
+				Prompt:      prompts[i],
+				MaxImages:   1,
+				Size:        opts.Size,
+				AspectRatio: opts.AspectRatio,
+				Seed:        opts.Seed,
+				Watermark:   opts.Watermark == nil || *opts.Watermark,
+			})
+		}(i)
+	}
+	wg.Wait()
 
-func (q *t2iAMQPQueue) Close() error {
-	if q.ch != nil {
-		_ = q.ch.Close()
+	taskIDStr := strconv.FormatUint(task.TaskID, 10)
+	result := &provider.ImageResult{Images: make([]provider.GeneratedImage, len(task.Shots))}
+	var firstErr error
+	failed := 0
+	for i, shot := range task.Shots {
+		switch {
+		case errs[i] != nil:
+		case len(results[i].Images) == 0:
+			errs[i] = errors.New("no images in response")
+		case results[i].Images[0].Error != "":
+			errs[i] = errors.New(results[i].Images[0].Error)
+		}
+		if errs[i] != nil {
+			log.Printf("T2I shot %d failed, task id: %s: %v", shot.ShotNo, taskIDStr, errs[i])
+			result.Images[i] = provider.GeneratedImage{Error: errs[i].Error()}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("shot %d: %w", shot.ShotNo, errs[i])
+			}
+			failed++
+			continue
+		}
+		// 每次调用只生成一张，多返回的图片忽略
+		result.Images[i] = results[i].Images[0]
+		if result.Model == "" {
+			result.Model = results[i].Model
+		}
+		result.Usage.GeneratedImages += results[i].Usage.GeneratedImages
+		result.Usage.OutputTokens += results[i].Usage.OutputTokens
+		result.Usage.TotalTokens += results[i].Usage.TotalTokens
 	}
-	if q.conn != nil {
-		return q.conn.Close()
+	if failed == len(task.Shots) {
+		return nil, fmt.Errorf("all %d shots failed, %w", failed, firstErr)
 	}
-	return nil
+	return result, nil
 }
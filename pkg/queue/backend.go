@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"V2V/settings"
+
+	"github.com/streadway/amqp"
+)
+
+// transport 任务队列底层的消息通道：RabbitMQ（connManager）或进程内实现（memTransport）。
+// 两种实现都以 amqp.Delivery 投递消息，Ack / Nack 语义一致，JobQueue 无需关心具体后端。
+type transport interface {
+	publish(exchange, key string, msg amqp.Publishing) error
+	consume(queueName string, drain *consumerDrain, handle func(<-chan amqp.Delivery)) error
+	ping(queueName string) error
+	cancel(tag string)
+	close() error
+
+	// 以下供管理接口使用（死信查看 / 回放 / 清空）
+	// browse 取出队列头部最多 limit 条消息逐条交给 fn；fn 返回 true 的消息被删除，其余按原顺序放回
+	browse(queueName string, limit int, fn func(d amqp.Delivery) (remove bool, err error)) error
+	count(queueName string) (int, error)
+	purge(queueName string) (int, error)
+}
+
+var queueConf = settings.DefaultQueueConfig()
+
+// InitBackend 注入队列后端配置，需要在初始化各队列之前调用
+func InitBackend(cfg settings.QueueConfig) {
+	queueConf = cfg
+}
+
+// newTransport 按配置创建消息通道并声明拓扑
+func newTransport(dsn string, spec JobSpec) (transport, error) {
+	if queueConf.Backend == settings.QueueBackendMemory {
+		return defaultMemBroker().transport(spec), nil
+	}
+	mode := settings.QueueDelayPlugin
+	if spec.DelayedExchange != "" || spec.RetryExchange != "" {
+		var err error
+		if mode, err = resolveDelayMode(dsn); err != nil {
+			return nil, err
+		}
+	}
+	plugin := mode == settings.QueueDelayPlugin
+	m, err := newConnManager(spec.Name, dsn, func(ch *amqp.Channel) error { return spec.declare(ch, plugin) })
+	if err != nil {
+		return nil, err
+	}
+	if !plugin {
+		m.delay = newTTLDelay(spec)
+	}
+	return m, nil
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// 发布确认：channel 处于 confirm 模式，每条消息发布后等待 broker 的 ack 才算成功，
+// 提交接口据此保证返回 202 的任务确实已经落到 broker 上。
+
+var (
+	// ErrPublishNacked broker 拒绝了消息（通常是内部错误或队列超限）
+	ErrPublishNacked = errors.New("message nacked by broker")
+	// ErrUnroutable 消息没有路由到任何队列（mandatory 发布被退回）
+	ErrUnroutable = errors.New("message returned as unroutable")
+	// ErrPublishTimeout 在 publishConfirmTimeout 内没有收到 broker 的确认
+	ErrPublishTimeout = errors.New("timed out waiting for publish confirm")
+)
+
+// publishConfirmTimeout 等待单条消息确认的最长时间
+const publishConfirmTimeout = 10 * time.Second
+
+// IsTemporary 发布错误是否为 broker 暂时不可用（断线重连中、确认超时、被 nack），
+// HTTP 层据此返回 503 提示客户端稍后重试
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrReconnecting) || errors.Is(err, ErrPublishTimeout) || errors.Is(err, ErrPublishNacked)
+}
+
+type pendingPublish struct {
+	id       string
+	returned bool
+	done     chan error
+}
+
+// confirmer 把一个 confirm 模式的 channel 上的发布与 broker 的确认一一对应。
+// 发布在锁内完成，保证本地序号与 channel 的 delivery tag 一致；basic.return 总是先于
+// 对应消息的 basic.ack 到达，处理 ack 前先取走已到达的退回记录即可判断消息是否被路由。
+type confirmer struct {
+	name string
+	ch   *amqp.Channel
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*pendingPublish
+	byID    map[string]*pendingPublish
+	closed  bool
+}
+
+// newConfirmer 把 channel 切换到 confirm 模式并开始接收确认与退回
+func newConfirmer(name string, ch *amqp.Channel) (*confirmer, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("enable publisher confirms: %v", err)
+	}
+	c := &confirmer{
+		name:    name,
+		ch:      ch,
+		pending: make(map[uint64]*pendingPublish),
+		byID:    make(map[string]*pendingPublish),
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 256))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 64))
+	go c.loop(confirms, returns)
+	return c, nil
+}
+
+func (c *confirmer) loop(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.markReturned(r)
+		case conf, ok := <-confirms:
+			if !ok {
+				// channel 已关闭，未确认的消息无法得知是否落盘，按断线处理让调用方重试
+				c.failAll(fmt.Errorf("rabbitmq %s: channel closed before confirm: %w", c.name, ErrReconnecting))
+				return
+			}
+			c.drainReturns(returns)
+			c.resolve(conf)
+		}
+	}
+}
+
+func (c *confirmer) drainReturns(returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return
+			}
+			c.markReturned(r)
+		default:
+			return
+		}
+	}
+}
+
+func (c *confirmer) markReturned(r amqp.Return) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.byID[r.MessageId]; ok {
+		p.returned = true
+	}
+}
+
+func (c *confirmer) resolve(conf amqp.Confirmation) {
+	c.mu.Lock()
+	p, ok := c.pending[conf.DeliveryTag]
+	if ok {
+		delete(c.pending, conf.DeliveryTag)
+		delete(c.byID, p.id)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	switch {
+	case !conf.Ack:
+		p.done <- ErrPublishNacked
+	case p.returned:
+		p.done <- ErrUnroutable
+	default:
+		p.done <- nil
+	}
+}
+
+func (c *confirmer) failAll(err error) {
+	c.mu.Lock()
+	c.closed = true
+	pending := c.pending
+	c.pending = make(map[uint64]*pendingPublish)
+	c.byID = make(map[string]*pendingPublish)
+	c.mu.Unlock()
+	for _, p := range pending {
+		p.done <- err
+	}
+}
+
+// publish 发布消息并阻塞等待 broker 确认
+func (c *confirmer) publish(exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	p := &pendingPublish{id: msg.MessageId, done: make(chan error, 1)}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return fmt.Errorf("rabbitmq %s: %w", c.name, ErrReconnecting)
+	}
+	if err := c.ch.Publish(exchange, key, mandatory, false, msg); err != nil {
+		c.mu.Unlock()
+		if errors.Is(err, amqp.ErrClosed) {
+			return fmt.Errorf("rabbitmq %s: %w", c.name, ErrReconnecting)
+		}
+		return err
+	}
+	c.seq++
+	tag := c.seq
+	c.pending[tag] = p
+	if p.id != "" {
+		c.byID[p.id] = p
+	}
+	c.mu.Unlock()
+
+	timer := time.NewTimer(publishConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-p.done:
+		return err
+	case <-timer.C:
+		// 调用方已放弃等待：移除记录，之后到达的确认找不到对应消息直接忽略，长期使用的 channel 上也不会累积
+		c.forget(tag, p)
+		return fmt.Errorf("rabbitmq %s: %w", c.name, ErrPublishTimeout)
+	}
+}
+
+// forget 移除一条不再等待确认的消息
+func (c *confirmer) forget(tag uint64, p *pendingPublish) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[tag] == p {
+		delete(c.pending, tag)
+	}
+	if p.id != "" && c.byID[p.id] == p {
+		delete(c.byID, p.id)
+	}
+}
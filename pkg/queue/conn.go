@@ -0,0 +1,332 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrReconnecting 与 broker 的连接已断开、正在重连；发布方应稍后重试（HTTP 层返回 503）
+var ErrReconnecting = errors.New("rabbitmq connection lost, reconnecting")
+
+// 重连退避：从 reconnectMinDelay 开始翻倍，最长 reconnectMaxDelay
+const (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// connManager 管理一条 AMQP 连接及其 channel：
+//   - 监听 NotifyClose，连接或 channel 断开后按指数退避重新拨号；
+//   - 每次（重新）建立 channel 后调用 setup 重新声明交换机、队列与 QoS；
+//   - 断线期间 channel() 返回 ErrReconnecting，发布方立即得到明确错误而不是无限失败；
+//   - channel 处于 confirm 模式，publish 等到 broker 确认后才返回；
+//   - consume 在重连后自动重新订阅，消费循环不会静默结束。
+type connManager struct {
+	name  string
+	dsn   string
+	setup func(ch *amqp.Channel) error
+	// delay 非空时（没有 delayed-message 插件）发往延迟交换机的消息改写为发往 TTL 队列
+	delay *ttlDelay
+
+	mu     sync.RWMutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	conf   *confirmer
+	ready  chan struct{} // 连接可用时已关闭；断线时替换为新的未关闭通道
+	closed bool
+	done   chan struct{}
+}
+
+// newConnManager 同步完成首次连接（失败直接返回错误），随后在后台监听断线并自动重连
+func newConnManager(name, dsn string, setup func(ch *amqp.Channel) error) (*connManager, error) {
+	m := &connManager{
+		name:  name,
+		dsn:   dsn,
+		setup: setup,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	conn, ch, conf, err := m.dial()
+	if err != nil {
+		return nil, err
+	}
+	m.conn, m.ch, m.conf = conn, ch, conf
+	close(m.ready)
+	go m.watch(conn, ch)
+	return m, nil
+}
+
+// dial 建立连接与 channel，声明拓扑并开启发布确认
+func (m *connManager) dial() (*amqp.Connection, *amqp.Channel, *confirmer, error) {
+	conn, err := amqp.Dial(m.dsn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	if err := m.setup(ch); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	conf, err := newConfirmer(m.name, ch)
+	if err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	return conn, ch, conf, nil
+}
+
+// watch 等待当前连接断开，然后不断重连直到成功或管理器被关闭
+func (m *connManager) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+		var reason *amqp.Error
+		select {
+		case <-m.done:
+			return
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return
+		}
+		m.ready = make(chan struct{})
+		m.ch, m.conf = nil, nil
+		m.mu.Unlock()
+		// channel 单独被 broker 关闭时连接可能仍然存活，统一关闭后重新拨号
+		_ = conn.Close()
+		log.Printf("rabbitmq %s: connection lost (%v), reconnecting", m.name, reason)
+
+		var conf *confirmer
+		delay := reconnectMinDelay
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-time.After(delay):
+			}
+			var err error
+			conn, ch, conf, err = m.dial()
+			if err == nil {
+				break
+			}
+			log.Printf("rabbitmq %s: reconnect failed, retry in %s: %v", m.name, delay, err)
+			if delay *= 2; delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+		}
+
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			ch.Close()
+			conn.Close()
+			return
+		}
+		m.conn, m.ch, m.conf = conn, ch, conf
+		close(m.ready)
+		m.mu.Unlock()
+		log.Printf("rabbitmq %s: reconnected", m.name)
+	}
+}
+
+// channel 返回当前可用的 channel；断线期间返回 ErrReconnecting
+func (m *connManager) channel() (*amqp.Channel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, fmt.Errorf("rabbitmq %s: connection closed", m.name)
+	}
+	if m.ch == nil {
+		return nil, fmt.Errorf("rabbitmq %s: %w", m.name, ErrReconnecting)
+	}
+	return m.ch, nil
+}
+
+// publish 通过当前 channel 发布消息并等待 broker 确认。
+// 直接投递到队列的消息以 mandatory 发布，没有路由到队列时返回 ErrUnroutable；
+// 经由 x-delayed-message 交换机的消息在延迟到期后才路由，插件会把 mandatory 消息一律退回，因此不设置。
+func (m *connManager) publish(exchange, key string, msg amqp.Publishing) error {
+	m.mu.RLock()
+	ch, conf, closed := m.ch, m.conf, m.closed
+	m.mu.RUnlock()
+	if closed {
+		return fmt.Errorf("rabbitmq %s: connection closed", m.name)
+	}
+	if conf == nil {
+		return fmt.Errorf("rabbitmq %s: %w", m.name, ErrReconnecting)
+	}
+	if m.delay != nil {
+		var err error
+		if exchange, key, err = m.delay.route(ch, exchange, key, &msg); err != nil {
+			return err
+		}
+	}
+	_, delayed := msg.Headers["x-delay"]
+	return conf.publish(exchange, key, !delayed, msg)
+}
+
+// waitConnected 阻塞到连接可用；管理器关闭或 stop 被关闭时返回 false
+func (m *connManager) waitConnected(stop <-chan struct{}) bool {
+	m.mu.RLock()
+	ready := m.ready
+	m.mu.RUnlock()
+	select {
+	case <-ready:
+		return true
+	case <-m.done:
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+// consume 订阅队列并把投递交给 handle（handle 在投递通道关闭后返回）。
+// 首次订阅失败直接返回错误；之后连接断开会等待重连并重新订阅，直到 drain 开始关闭或管理器关闭。
+func (m *connManager) consume(queueName string, drain *consumerDrain, handle func(<-chan amqp.Delivery)) error {
+	deliveries, err := m.subscribe(queueName, drain.tag)
+	if err != nil {
+		return err
+	}
+	drain.started.Store(true)
+	drain.wg.Add(1)
+	go func() {
+		defer drain.wg.Done()
+		for {
+			handle(deliveries)
+			if drain.stopping.Load() {
+				return
+			}
+			log.Printf("rabbitmq %s: consumer on %s interrupted, waiting for reconnect", m.name, queueName)
+			for {
+				if !m.waitConnected(drain.stop) {
+					return
+				}
+				if deliveries, err = m.subscribe(queueName, drain.tag); err == nil {
+					break
+				}
+				// 刚拿到的 channel 可能又断开了，稍等后等待下一次重连
+				log.Printf("rabbitmq %s: resubscribe to %s failed: %v", m.name, queueName, err)
+				time.Sleep(reconnectMinDelay)
+			}
+			log.Printf("rabbitmq %s: consumer on %s resumed", m.name, queueName)
+		}
+	}()
+	return nil
+}
+
+func (m *connManager) subscribe(queueName, tag string) (<-chan amqp.Delivery, error) {
+	ch, err := m.channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch.Consume(queueName, tag, false, false, false, false, nil)
+}
+
+// ping 检查连接与 channel 是否可用：被动查询队列状态需要一次 broker 往返
+func (m *connManager) ping(queueName string) error {
+	ch, err := m.channel()
+	if err != nil {
+		return err
+	}
+	_, err = ch.QueueInspect(queueName)
+	return err
+}
+
+// withChannel 在独立的临时 channel 上执行管理操作，channel 级错误不会影响消费 channel
+func (m *connManager) withChannel(fn func(ch *amqp.Channel) error) error {
+	m.mu.RLock()
+	conn, ready := m.conn, m.ch != nil && !m.closed
+	m.mu.RUnlock()
+	if !ready {
+		return fmt.Errorf("rabbitmq %s: %w", m.name, ErrReconnecting)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	return fn(ch)
+}
+
+// browse 用 basic.get 逐条取出消息；未删除的消息保持未确认，channel 关闭时由 broker 放回队列
+func (m *connManager) browse(queueName string, limit int, fn func(d amqp.Delivery) (bool, error)) error {
+	return m.withChannel(func(ch *amqp.Channel) error {
+		for i := 0; i < limit; i++ {
+			d, ok, err := ch.Get(queueName, false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			remove, err := fn(d)
+			if err != nil {
+				return err
+			}
+			if remove {
+				if err := d.Ack(false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (m *connManager) count(queueName string) (n int, err error) {
+	err = m.withChannel(func(ch *amqp.Channel) error {
+		q, err := ch.QueueInspect(queueName)
+		n = q.Messages
+		return err
+	})
+	return n, err
+}
+
+func (m *connManager) purge(queueName string) (n int, err error) {
+	err = m.withChannel(func(ch *amqp.Channel) error {
+		n, err = ch.QueuePurge(queueName, false)
+		return err
+	})
+	return n, err
+}
+
+// cancel 取消消费者订阅（用于优雅关闭）；断线期间没有订阅可取消
+func (m *connManager) cancel(tag string) {
+	if ch, err := m.channel(); err == nil {
+		_ = ch.Cancel(tag, false)
+	}
+}
+
+// close 停止重连并关闭连接
+func (m *connManager) close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+	conn, ch := m.conn, m.ch
+	m.mu.Unlock()
+	if ch != nil {
+		_ = ch.Close()
+	}
+	if conn != nil && !conn.IsClosed() {
+		return conn.Close()
+	}
+	return nil
+}
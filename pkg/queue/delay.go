@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"V2V/settings"
+
+	"github.com/streadway/amqp"
+)
+
+// 延迟投递的两种 AMQP 实现：
+//   - plugin：x-delayed-message 交换机（rabbitmq-delayed-message-exchange 插件），消息带 x-delay header；
+//   - ttl：原生 RabbitMQ 没有该插件时，为每个（目标队列, 延迟时长）声明一个设置了 x-message-ttl 的队列，
+//     消息到期后经默认交换机死信回目标队列。同一个队列内所有消息 TTL 相同，不存在队头阻塞。
+//
+// JobQueue 始终按 plugin 的方式发布（交换机 + x-delay），ttl 模式下由 connManager.publish 改写路由，
+// 上层（包括 DelayedI2VQueue）无需感知具体实现。
+
+var (
+	delayModeOnce sync.Once
+	delayMode     string
+	delayModeErr  error
+)
+
+// resolveDelayMode 返回实际使用的延迟实现；auto 时探测一次插件并缓存结果
+func resolveDelayMode(dsn string) (string, error) {
+	delayModeOnce.Do(func() {
+		switch queueConf.Delay {
+		case settings.QueueDelayPlugin, settings.QueueDelayTTL:
+			delayMode = queueConf.Delay
+		default:
+			ok, err := probeDelayedPlugin(dsn)
+			if err != nil {
+				delayModeErr = err
+				return
+			}
+			delayMode = settings.QueueDelayTTL
+			if ok {
+				delayMode = settings.QueueDelayPlugin
+			}
+			log.Printf("rabbitmq: delayed-message plugin available=%v, using %s delays", ok, delayMode)
+		}
+	})
+	return delayMode, delayModeErr
+}
+
+// probeDelayedPlugin 在临时 channel 上声明一个 x-delayed-message 交换机：
+// 插件缺失时 broker 以 503 command_invalid 关闭该 channel，连接本身不受影响
+func probeDelayedPlugin(dsn string) (bool, error) {
+	conn, err := amqp.Dial(dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	const probe = "v2v_delayed_message_probe"
+	if err := ch.ExchangeDeclare(probe, "x-delayed-message", false, true, false, false,
+		amqp.Table{"x-delayed-type": "direct"}); err != nil {
+		if e, ok := err.(*amqp.Error); ok && e.Code == amqp.CommandInvalid {
+			return false, nil
+		}
+		return false, err
+	}
+	_ = ch.ExchangeDelete(probe, false, false)
+	_ = ch.Close()
+	return true, nil
+}
+
+// ttlDelay ttl 模式下记录哪些交换机本应是 x-delayed-message（它们以目标队列名作为 routing key）
+type ttlDelay struct {
+	exchanges map[string]bool
+}
+
+func newTTLDelay(spec JobSpec) *ttlDelay {
+	d := &ttlDelay{exchanges: make(map[string]bool)}
+	if spec.DelayedExchange != "" {
+		d.exchanges[spec.DelayedExchange] = true
+	}
+	if spec.RetryExchange != "" {
+		d.exchanges[spec.RetryExchange] = true
+	}
+	return d
+}
+
+// route 把发往延迟交换机的消息改写为发往对应的 TTL 队列（没有延迟时直接发往目标队列）；
+// 返回新的交换机与 routing key，msg.Headers 中的 x-delay 会被移除
+func (d *ttlDelay) route(ch *amqp.Channel, exchange, key string, msg *amqp.Publishing) (string, string, error) {
+	if !d.exchanges[exchange] {
+		return exchange, key, nil
+	}
+	delay := delayFromHeaders(msg.Headers)
+	if msg.Headers != nil {
+		headers := amqp.Table{}
+		for k, v := range msg.Headers {
+			if k != "x-delay" {
+				headers[k] = v
+			}
+		}
+		msg.Headers = headers
+	}
+	if delay <= 0 {
+		return "", key, nil
+	}
+	delay = quantizeDelay(delay)
+	name := fmt.Sprintf("%s.delay.%ds", key, int64(delay/time.Second))
+	// 每次发布前重新声明：声明是幂等的，同时刷新 x-expires 计时，
+	// 保证队列在最后一条消息到期（delay）之前不会被自动删除
+	_, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": key,
+		"x-expires":                 (2*delay + 10*time.Minute).Milliseconds(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("declare delay queue %s: %w", name, err)
+	}
+	return "", name, nil
+}
+
+// quantizeDelay 把延迟取整到两位有效数字的秒数（最小 1 秒），限制 TTL 队列的数量：
+// 100 秒以内精确到秒，1000 秒以内精确到 10 秒，依此类推
+func quantizeDelay(d time.Duration) time.Duration {
+	secs := (d.Milliseconds() + 500) / 1000
+	if secs < 1 {
+		return time.Second
+	}
+	unit := int64(1)
+	for secs/unit >= 100 {
+		unit *= 10
+	}
+	return time.Duration((secs+unit/2)/unit*unit) * time.Second
+}
@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"V2V/models"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// 死信队列管理：查看（解码后的任务载荷、死信原因、重试次数）、回放到原队列、清空。
+// 每个配置了 DeadLetterQueue 的 JobQueue 创建时会自动登记到这里。
+
+// ErrUnknownDeadLetterQueue 指定的死信队列不存在（或本进程没有初始化对应的任务队列）
+var ErrUnknownDeadLetterQueue = errors.New("unknown dead letter queue")
+
+// 单次查看 / 回放 / 清空处理的最大消息数
+const (
+	DefaultDeadLetterLimit = 50
+	MaxDeadLetterLimit     = 1000
+)
+
+// DeadLetterQueueInfo 死信队列概览
+type DeadLetterQueueInfo struct {
+	Name     string `json:"name"`
+	Queue    string `json:"queue"`
+	Origin   string `json:"origin"`
+	Messages int    `json:"messages"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DeadLetterMessage 一条死信消息
+type DeadLetterMessage struct {
+	ID         string `json:"id"`
+	Origin     string `json:"origin"`
+	Reason     string `json:"reason"`
+	DeathCount int64  `json:"death_count"`
+	Attempts   int    `json:"attempts"`
+	Replayed   int    `json:"replayed"`
+	// History 进入死信前每次失败执行的记录
+	History     []models.TaskAttempt `json:"history,omitempty"`
+	DeadAt      *time.Time           `json:"dead_at,omitempty"`
+	Priority    uint8                `json:"priority"`
+	Payload     interface{}          `json:"payload,omitempty"`
+	Raw         string               `json:"raw,omitempty"`
+	DecodeError string               `json:"decode_error,omitempty"`
+}
+
+// DeadLetterPage 死信队列头部的消息
+type DeadLetterPage struct {
+	DeadLetterQueueInfo
+	Items []DeadLetterMessage `json:"items"`
+}
+
+type deadLetterQueue struct {
+	name   string
+	queue  string
+	origin string
+	t      transport
+	// decode 把消息体解码为任务载荷
+	decode func(body []byte) (interface{}, error)
+	// republish 把消息重新发布到原队列
+	republish func(body []byte, priority uint8, headers amqp.Table) error
+}
+
+var (
+	dlqMu            sync.RWMutex
+	deadLetterQueues = make(map[string]*deadLetterQueue)
+)
+
+func registerDeadLetterQueue(d *deadLetterQueue) {
+	dlqMu.Lock()
+	defer dlqMu.Unlock()
+	deadLetterQueues[d.name] = d
+}
+
+func getDeadLetterQueue(name string) (*deadLetterQueue, error) {
+	dlqMu.RLock()
+	defer dlqMu.RUnlock()
+	d, ok := deadLetterQueues[name]
+	if !ok {
+		return nil, ErrUnknownDeadLetterQueue
+	}
+	return d, nil
+}
+
+// DeadLetterQueues 列出本进程已登记的死信队列及其消息数
+func DeadLetterQueues() []DeadLetterQueueInfo {
+	dlqMu.RLock()
+	list := make([]*deadLetterQueue, 0, len(deadLetterQueues))
+	for _, d := range deadLetterQueues {
+		list = append(list, d)
+	}
+	dlqMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	infos := make([]DeadLetterQueueInfo, 0, len(list))
+	for _, d := range list {
+		info := d.info()
+		if n, err := d.t.count(d.queue); err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Messages = n
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (d *deadLetterQueue) info() DeadLetterQueueInfo {
+	return DeadLetterQueueInfo{Name: d.name, Queue: d.queue, Origin: d.origin}
+}
+
+// ListDeadLetters 查看死信队列头部最多 limit 条消息（消息保持在队列中）
+func ListDeadLetters(name string, limit int) (*DeadLetterPage, error) {
+	d, err := getDeadLetterQueue(name)
+	if err != nil {
+		return nil, err
+	}
+	page := &DeadLetterPage{DeadLetterQueueInfo: d.info(), Items: []DeadLetterMessage{}}
+	if page.Messages, err = d.t.count(d.queue); err != nil {
+		return nil, err
+	}
+	err = d.t.browse(d.queue, clampLimit(limit), func(del amqp.Delivery) (bool, error) {
+		page.Items = append(page.Items, d.describe(del))
+		return false, nil
+	})
+	return page, err
+}
+
+// ReplayDeadLetters 把指定 id 的死信（ids 为空时为队列头部最多 limit 条）重新发布到原队列，
+// 重试计数清零；返回回放的条数。
+func ReplayDeadLetters(name string, ids []string, limit int) (int, error) {
+	d, err := getDeadLetterQueue(name)
+	if err != nil {
+		return 0, err
+	}
+	match := idMatcher(ids)
+	replayed := 0
+	err = d.t.browse(d.queue, browseLimit(ids, limit), func(del amqp.Delivery) (bool, error) {
+		if !match(messageID(del)) {
+			return false, nil
+		}
+		headers := amqp.Table{}
+		for k, v := range del.Headers {
+			switch k {
+			case "x-death", "x-first-death-exchange", "x-first-death-queue", "x-first-death-reason",
+				"x-last-death-exchange", "x-last-death-queue", "x-last-death-reason", "x-attempts":
+				continue
+			}
+			headers[k] = v
+		}
+		headers["x-replayed"] = headerInt(del.Headers, "x-replayed") + 1
+		if err := d.republish(del.Body, del.Priority, headers); err != nil {
+			return false, err
+		}
+		replayed++
+		return true, nil
+	})
+	return replayed, err
+}
+
+// PurgeDeadLetters 删除指定 id 的死信；ids 为空时清空整个死信队列。返回删除的条数。
+func PurgeDeadLetters(name string, ids []string) (int, error) {
+	d, err := getDeadLetterQueue(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return d.t.purge(d.queue)
+	}
+	match := idMatcher(ids)
+	purged := 0
+	err = d.t.browse(d.queue, MaxDeadLetterLimit, func(del amqp.Delivery) (bool, error) {
+		if !match(messageID(del)) {
+			return false, nil
+		}
+		purged++
+		return true, nil
+	})
+	return purged, err
+}
+
+// describe 解析死信消息：x-death 记录原队列、原因与死信次数，x-attempts 为重试次数
+func (d *deadLetterQueue) describe(del amqp.Delivery) DeadLetterMessage {
+	m := DeadLetterMessage{
+		ID:       messageID(del),
+		Origin:   d.origin,
+		Attempts: headerInt(del.Headers, "x-attempts"),
+		Replayed: headerInt(del.Headers, "x-replayed"),
+		History:  historyFromHeaders(del.Headers),
+		Priority: del.Priority,
+	}
+	if deaths, ok := del.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			if q, ok := death["queue"].(string); ok {
+				m.Origin = q
+			}
+			m.Reason, _ = death["reason"].(string)
+			m.DeathCount, _ = death["count"].(int64)
+			if t, ok := death["time"].(time.Time); ok {
+				m.DeadAt = &t
+			}
+		}
+	}
+	payload, err := d.decode(del.Body)
+	if err != nil {
+		m.Raw = string(del.Body)
+		m.DecodeError = err.Error()
+	} else {
+		m.Payload = payload
+	}
+	return m
+}
+
+// messageID 发布时写入的 MessageId；旧消息没有 MessageId 时用消息体摘要代替
+func messageID(del amqp.Delivery) string {
+	if del.MessageId != "" {
+		return del.MessageId
+	}
+	sum := sha1.Sum(del.Body)
+	return "sha1-" + hex.EncodeToString(sum[:8])
+}
+
+func idMatcher(ids []string) func(string) bool {
+	if len(ids) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return func(id string) bool { return set[id] }
+}
+
+// browseLimit 按 id 选择时需要扫描更多消息才能找到目标
+func browseLimit(ids []string, limit int) int {
+	if len(ids) > 0 {
+		return MaxDeadLetterLimit
+	}
+	return clampLimit(limit)
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultDeadLetterLimit
+	}
+	if limit > MaxDeadLetterLimit {
+		return MaxDeadLetterLimit
+	}
+	return limit
+}
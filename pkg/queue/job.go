@@ -0,0 +1,512 @@
+package queue
+
+import (
+	"V2V/models"
+	"V2V/pkg/breaker"
+	"V2V/settings"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// 通用任务运行时：每种任务只需要描述队列拓扑、载荷类型、处理函数、重试策略与并发数，
+// 声明交换机 / 死信、发布、消费循环、x-attempts 重试计数、优雅关闭与断线重连都由这里统一完成。
+
+// RetryPolicy 处理函数返回普通错误时的重试策略
+type RetryPolicy struct {
+	// MaxRetries 最多重新投递次数，超过后进入死信（没有配置死信时直接丢弃）
+	MaxRetries int
+	// BaseDelay 大于 0 时按指数退避延迟重试：第 n 次重试等待 BaseDelay*Multiplier^(n-1)，
+	// 不超过 MaxDelay，再叠加 ±Jitter 比例的随机抖动；为 0 时立即重试
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// retryPolicyFrom 把配置文件中的重试配置转换为 RetryPolicy
+func retryPolicyFrom(c settings.RetryConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: c.MaxRetries,
+		BaseDelay:  c.BaseDelay.Duration,
+		MaxDelay:   c.MaxDelay.Duration,
+		Multiplier: c.Multiplier,
+		Jitter:     c.Jitter,
+	}
+}
+
+// Backoff 返回第 retry 次重试（从 1 开始）前的等待时间
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	if p.BaseDelay <= 0 || retry < 1 {
+		return 0
+	}
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	d := float64(p.BaseDelay) * math.Pow(mult, float64(retry-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// JobSpec 描述一个任务队列
+type JobSpec struct {
+	// Name 用于日志与 consumer tag
+	Name string
+	// Queue 队列名
+	Queue string
+	// MaxPriority 大于 0 时声明为优先级队列（x-max-priority）
+	MaxPriority int
+	// DeadLetterExchange / DeadLetterRoutingKey 主队列的死信路由；DeadLetterQueue 非空时同时声明并绑定死信队列
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	DeadLetterQueue      string
+	// DeadLetterByPolicy 为 true 时主队列声明时不带 x-dead-letter 参数，死信路由由 RabbitMQ policy 配置
+	// （给已有队列补充死信时使用：RabbitMQ 不允许修改已声明队列的参数）；死信交换机与死信队列仍在这里声明
+	DeadLetterByPolicy bool
+	// DelayedExchange 非空时通过 x-delayed-message 交换机发布，每条消息默认延迟 Delay
+	DelayedExchange string
+	Delay           time.Duration
+	// RetryExchange 非空时声明一个绑定到主队列的 x-delayed-message 交换机，
+	// 失败重试经由它按 Retry 的退避时间延迟投递（新任务仍直接发布到主队列）
+	RetryExchange string
+	// Persistent 是否以持久化模式投递
+	Persistent bool
+	// Prefetch 为 channel 的 QoS；Concurrency 为同时处理的消息数（小于 1 按 1 处理）
+	Prefetch    int
+	Concurrency int
+	Retry       RetryPolicy
+	// Breakers 处理该队列依赖的外部服务（gemini / ark）；全部熔断时暂停消费，消息留在 broker 中
+	Breakers []string
+}
+
+// Job 一条待处理的任务
+type Job[T any] struct {
+	Payload T
+	// Attempt 已重试次数（来自 x-attempts header，首次投递为 0）
+	Attempt     int
+	Redelivered bool
+	// History 之前每次失败执行的记录（来自 x-attempt-history header）
+	History []models.TaskAttempt
+}
+
+// JobType 注册一种任务：队列描述 + 处理函数
+type JobType[T any] struct {
+	JobSpec
+	// Handle 返回 nil 表示成功；返回 Permanent / Requeue 包装的错误或普通错误时按对应策略处理
+	Handle func(ctx context.Context, job *Job[T]) error
+	// OnFailure 任务最终失败（永久错误或重试耗尽）进入死信时调用，可选；job.History 已包含本次失败
+	OnFailure func(ctx context.Context, job *Job[T], err error)
+	// OnRetry 任务失败、已安排延迟重试后调用（用于把重试状态与历史写到任务上），可选
+	OnRetry func(ctx context.Context, job *Job[T], err error)
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+type requeueError struct{ err error }
+
+func (e *requeueError) Error() string { return e.err.Error() }
+func (e *requeueError) Unwrap() error { return e.err }
+
+// Permanent 标记错误不可重试（参数错误、内容审核失败等），消息直接进入死信
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Requeue 标记错误为本地临时问题（如存储失败）：消息原样放回队列，已经重新投递过一次则进入死信
+func Requeue(err error) error {
+	return &requeueError{err: err}
+}
+
+// IsPermanent 判断错误是否被标记为永久错误
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// JobQueue 某种任务的 AMQP 队列：既可以发布也可以消费
+type JobQueue[T any] struct {
+	jt       JobType[T]
+	t        transport
+	drain    *consumerDrain
+	counters jobCounters
+}
+
+// NewJobQueue 按配置的后端连接 broker 并声明任务拓扑（AMQP 重连后会自动重新声明）
+func NewJobQueue[T any](dsn string, jt JobType[T]) (*JobQueue[T], error) {
+	t, err := newTransport(dsn, jt.JobSpec)
+	if err != nil {
+		return nil, err
+	}
+	q := &JobQueue[T]{jt: jt, t: t, drain: newConsumerDrain(jt.Name)}
+	registerStats(jt.Name, q.Stats)
+	if jt.DeadLetterQueue != "" {
+		registerDeadLetterQueue(&deadLetterQueue{
+			name:   jt.Name,
+			queue:  jt.DeadLetterQueue,
+			origin: jt.Queue,
+			t:      t,
+			decode: func(body []byte) (interface{}, error) {
+				var payload T
+				err := json.Unmarshal(body, &payload)
+				return payload, err
+			},
+			republish: q.publish,
+		})
+	}
+	return q, nil
+}
+
+// declare 声明死信交换机 / 死信队列、主队列、延迟交换机与 QoS；
+// delayedPlugin 为 false 时不声明 x-delayed-message 交换机，延迟消息改走 TTL 队列（见 delay.go）
+func (s JobSpec) declare(ch *amqp.Channel, delayedPlugin bool) error {
+	args := amqp.Table{}
+	if s.DeadLetterExchange != "" {
+		if err := ch.ExchangeDeclare(s.DeadLetterExchange, "direct", true, false, false, false, nil); err != nil {
+			return err
+		}
+		if s.DeadLetterQueue != "" {
+			if _, err := ch.QueueDeclare(s.DeadLetterQueue, true, false, false, false, nil); err != nil {
+				return err
+			}
+			if err := ch.QueueBind(s.DeadLetterQueue, s.DeadLetterRoutingKey, s.DeadLetterExchange, false, nil); err != nil {
+				return err
+			}
+		}
+		if !s.DeadLetterByPolicy {
+			args["x-dead-letter-exchange"] = s.DeadLetterExchange
+			args["x-dead-letter-routing-key"] = s.DeadLetterRoutingKey
+		}
+	}
+	if s.MaxPriority > 0 {
+		args["x-max-priority"] = s.MaxPriority
+	}
+	if _, err := ch.QueueDeclare(s.Queue, true, false, false, false, args); err != nil {
+		return err
+	}
+	if s.DelayedExchange != "" && delayedPlugin {
+		if err := ch.ExchangeDeclare(s.DelayedExchange, "x-delayed-message", true, false, false, false,
+			amqp.Table{"x-delayed-type": "direct"}); err != nil {
+			return fmt.Errorf("Failed to declare delayed exchange: %v", err)
+		}
+		if err := ch.QueueBind(s.Queue, s.Queue, s.DelayedExchange, false, nil); err != nil {
+			return err
+		}
+	}
+	if s.RetryExchange != "" && delayedPlugin {
+		if err := ch.ExchangeDeclare(s.RetryExchange, "x-delayed-message", true, false, false, false,
+			amqp.Table{"x-delayed-type": "direct"}); err != nil {
+			return fmt.Errorf("Failed to declare retry exchange: %v", err)
+		}
+		if err := ch.QueueBind(s.Queue, s.Queue, s.RetryExchange, false, nil); err != nil {
+			return err
+		}
+	}
+	if s.Prefetch > 0 {
+		return ch.Qos(s.Prefetch, 0, false)
+	}
+	return nil
+}
+
+// Enqueue 序列化并发布任务
+func (q *JobQueue[T]) Enqueue(payload T, priority int) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return q.Publish(b, priority)
+}
+
+// Publish 发布已序列化的任务
+func (q *JobQueue[T]) Publish(body []byte, priority int) error {
+	return q.publish(body, uint8(priority), nil)
+}
+
+func (q *JobQueue[T]) publish(body []byte, priority uint8, headers amqp.Table) error {
+	return q.publishDelayed(body, priority, headers, q.jt.Delay)
+}
+
+// publishDelayed 发布消息：配置了 DelayedExchange 的队列总是经由它延迟 delay 投递；
+// 其余队列在 delay 大于 0 且配置了 RetryExchange 时经由重试交换机延迟投递，否则直接进入主队列
+func (q *JobQueue[T]) publishDelayed(body []byte, priority uint8, headers amqp.Table, delay time.Duration) error {
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+		Priority:    priority,
+		Headers:     headers,
+		MessageId:   newMessageID(),
+		Timestamp:   time.Now(),
+	}
+	if q.jt.Persistent {
+		msg.DeliveryMode = amqp.Persistent
+	}
+	exchange := ""
+	switch {
+	case q.jt.DelayedExchange != "":
+		exchange = q.jt.DelayedExchange
+	case delay > 0 && q.jt.RetryExchange != "":
+		exchange = q.jt.RetryExchange
+	}
+	if exchange != "" {
+		if msg.Headers == nil {
+			msg.Headers = amqp.Table{}
+		}
+		msg.Headers["x-delay"] = delay.Milliseconds()
+	}
+	return q.t.publish(exchange, q.jt.Queue, msg)
+}
+
+var messageSeq atomic.Uint64
+
+// newMessageID 生成消息 ID（死信管理接口按 ID 选择回放 / 删除的消息）
+func newMessageID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(messageSeq.Add(1), 36)
+}
+
+// Consume 启动消费者（立即返回）；连接断开后会在重连成功时自动重新订阅
+func (q *JobQueue[T]) Consume() error {
+	return q.t.consume(q.jt.Queue, q.drain, q.handleDeliveries)
+}
+
+// handleDeliveries 处理一次订阅的投递，直到投递通道关闭（取消订阅或连接断开）
+func (q *JobQueue[T]) handleDeliveries(deliveries <-chan amqp.Delivery) {
+	concurrency := q.jt.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	for d := range deliveries {
+		sem <- struct{}{}
+		// 熔断期间停在这里：prefetch 占满后 broker 不再推送，其余消息留在队列中
+		done := func() {}
+		if len(q.jt.Breakers) > 0 {
+			done, _ = breaker.Wait(q.drain.stop, q.jt.Breakers...)
+		}
+		if !q.drain.accept(d) {
+			done()
+			<-sem
+			continue
+		}
+		q.drain.wg.Add(1)
+		q.counters.inFlight.Add(1)
+		go func(del amqp.Delivery) {
+			defer func() { done(); q.counters.inFlight.Add(-1); <-sem; q.drain.wg.Done() }()
+			q.process(del)
+		}(d)
+	}
+}
+
+// Stats 返回该队列消费者的并发配置、在途任务数与处理计数
+func (q *JobQueue[T]) Stats() QueueStats {
+	concurrency := q.jt.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return QueueStats{
+		Name:        q.jt.Name,
+		Queue:       q.jt.Queue,
+		Concurrency: concurrency,
+		Prefetch:    q.jt.Prefetch,
+		Consuming:   q.drain.started.Load(),
+		InFlight:    q.counters.inFlight.Load(),
+		Succeeded:   q.counters.succeeded.Load(),
+		Retried:     q.counters.retried.Load(),
+		Failed:      q.counters.failed.Load(),
+		Breakers:    q.jt.Breakers,
+		Paused:      q.drain.started.Load() && breaker.AllOpen(q.jt.Breakers...),
+	}
+}
+
+// process 解析载荷、调用处理函数，并根据结果 Ack / 重试 / 进入死信
+//
+// 重试采用 republish + ack 而不是 Nack(requeue=true)：这样可以在 header 中累加 x-attempts，
+// 精确控制最大重试次数（broker 的 redelivered 标记无法计数）。
+func (q *JobQueue[T]) process(del amqp.Delivery) {
+	var payload T
+	if err := json.Unmarshal(del.Body, &payload); err != nil {
+		// 非法消息，重试无意义，直接送死信
+		log.Printf("%s: invalid task payload: %v", q.jt.Name, err)
+		_ = del.Nack(false, false)
+		return
+	}
+	job := &Job[T]{
+		Payload:     payload,
+		Attempt:     attemptsFromHeaders(del.Headers),
+		Redelivered: del.Redelivered,
+		History:     historyFromHeaders(del.Headers),
+	}
+	ctx := q.drain.ctx
+
+	err := q.jt.Handle(ctx, job)
+	if err == nil {
+		q.counters.succeeded.Add(1)
+		_ = del.Ack(false)
+		return
+	}
+	// 进程关闭导致的取消：放回队列交给其他实例，不消耗重试次数
+	if ctx.Err() != nil {
+		_ = del.Nack(false, true)
+		return
+	}
+
+	var re *requeueError
+	switch {
+	case errors.As(err, &re):
+		log.Printf("%s: temporary error, requeue: %v", q.jt.Name, err)
+		if del.Redelivered {
+			// 已经重试过，丢弃
+			q.fail(ctx, del, job, err)
+			return
+		}
+		_ = del.Nack(false, true)
+	case IsPermanent(err):
+		log.Printf("%s: permanent error, sending to dead letter: %v", q.jt.Name, err)
+		q.fail(ctx, del, job, err)
+	case job.Attempt >= q.jt.Retry.MaxRetries:
+		log.Printf("%s: exceeded %d retries, sending to dead letter: %v", q.jt.Name, q.jt.Retry.MaxRetries, err)
+		q.fail(ctx, del, job, err)
+	default:
+		q.retry(ctx, del, job, err)
+	}
+}
+
+// retry 记录本次失败，并按退避策略经由重试交换机延迟重新发布（x-attempts+1）后 Ack 原消息
+func (q *JobQueue[T]) retry(ctx context.Context, del amqp.Delivery, job *Job[T], err error) {
+	delay := q.jt.Retry.Backoff(job.Attempt + 1)
+	if delay <= 0 {
+		delay = q.jt.Delay
+	}
+	now := time.Now()
+	retryAt := now.Add(delay)
+	job.History = append(job.History, models.TaskAttempt{
+		Attempt:  len(job.History) + 1,
+		Error:    truncateError(err),
+		FailedAt: now,
+		RetryAt:  &retryAt,
+	})
+
+	headers := amqp.Table{}
+	for k, v := range del.Headers {
+		headers[k] = v
+	}
+	headers["x-attempts"] = job.Attempt + 1
+	if h, herr := json.Marshal(job.History); herr == nil {
+		headers["x-attempt-history"] = string(h)
+	}
+	if perr := q.publishDelayed(del.Body, del.Priority, headers, delay); perr != nil {
+		log.Printf("%s: failed to republish message for retry: %v", q.jt.Name, perr)
+		_ = del.Nack(false, false)
+		return
+	}
+	q.counters.retried.Add(1)
+	log.Printf("%s: scheduled retry #%d in %s: %v", q.jt.Name, job.Attempt+1, delay.Round(time.Millisecond), err)
+	_ = del.Ack(false)
+	if q.jt.OnRetry != nil {
+		q.jt.OnRetry(ctx, job, err)
+	}
+}
+
+// fail 通知任务最终失败并通过 Nack(requeue=false) 按队列 x-dead-letter 配置路由到死信
+func (q *JobQueue[T]) fail(ctx context.Context, del amqp.Delivery, job *Job[T], err error) {
+	job.History = append(job.History, models.TaskAttempt{
+		Attempt:  len(job.History) + 1,
+		Error:    truncateError(err),
+		FailedAt: time.Now(),
+	})
+	q.counters.failed.Add(1)
+	if q.jt.OnFailure != nil {
+		q.jt.OnFailure(ctx, job, err)
+	}
+	_ = del.Nack(false, false)
+}
+
+// attemptsFromHeaders 读取 x-attempts 重试计数
+func attemptsFromHeaders(h amqp.Table) int {
+	return headerInt(h, "x-attempts")
+}
+
+// historyFromHeaders 读取 x-attempt-history 中的失败历史
+func historyFromHeaders(h amqp.Table) []models.TaskAttempt {
+	var raw []byte
+	switch v := h["x-attempt-history"].(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return nil
+	}
+	var history []models.TaskAttempt
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return nil
+	}
+	return history
+}
+
+// maxAttemptError 单条失败记录中错误信息的最大长度，避免 header 过大
+const maxAttemptError = 512
+
+func truncateError(err error) string {
+	s := err.Error()
+	if len(s) > maxAttemptError {
+		s = s[:maxAttemptError] + "..."
+	}
+	return s
+}
+
+// headerInt 读取整数 header（不同客户端可能写成不同的整数类型或字符串）
+func headerInt(h amqp.Table, key string) int {
+	v, ok := h[key]
+	if !ok {
+		return 0
+	}
+	switch v := v.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// Ping 检查连接与 channel（重连期间返回 ErrReconnecting）
+func (q *JobQueue[T]) Ping() error {
+	return q.t.ping(q.jt.Queue)
+}
+
+// Shutdown 取消订阅并等待在途任务完成，随后关闭连接
+func (q *JobQueue[T]) Shutdown(ctx context.Context) error {
+	err := q.drain.shutdown(ctx, q.t)
+	if cerr := q.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close 关闭连接
+func (q *JobQueue[T]) Close() error {
+	return q.t.close()
+}
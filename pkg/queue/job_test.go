@@ -0,0 +1,242 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	ID string `json:"id"`
+}
+
+// newMemJobQueue 在独立的内存 broker 上创建任务队列，避免测试之间共享队列
+func newMemJobQueue[T any](jt JobType[T]) *JobQueue[T] {
+	return &JobQueue[T]{jt: jt, t: newMemBroker().transport(jt.JobSpec), drain: newConsumerDrain(jt.Name)}
+}
+
+func TestJobQueueOutcomes(t *testing.T) {
+	errTemporary := errors.New("upstream unavailable")
+	tests := []struct {
+		name  string
+		retry RetryPolicy
+		// results 第 n 次调用处理函数的返回值，超出部分沿用最后一个
+		results []error
+		// wantCalls 处理函数被调用的次数
+		wantCalls int
+		// wantAttempts 每次调用时 job.Attempt 的值
+		wantAttempts []int
+		// wantRedelivered 每次调用时 job.Redelivered 的值
+		wantRedelivered []bool
+		wantDead        int
+		wantRetried     int64
+		// wantHistory 进入死信时失败历史的条数（0 表示不应进入死信）
+		wantHistory int
+	}{
+		{
+			name:            "success acks",
+			results:         []error{nil},
+			wantCalls:       1,
+			wantAttempts:    []int{0},
+			wantRedelivered: []bool{false},
+		},
+		{
+			name:            "permanent error goes to dead letter without retry",
+			retry:           RetryPolicy{MaxRetries: 3},
+			results:         []error{Permanent(errTemporary)},
+			wantCalls:       1,
+			wantAttempts:    []int{0},
+			wantRedelivered: []bool{false},
+			wantDead:        1,
+			wantHistory:     1,
+		},
+		{
+			name:            "retries exhausted go to dead letter",
+			retry:           RetryPolicy{MaxRetries: 2},
+			results:         []error{errTemporary},
+			wantCalls:       3,
+			wantAttempts:    []int{0, 1, 2},
+			wantRedelivered: []bool{false, false, false},
+			wantDead:        1,
+			wantRetried:     2,
+			wantHistory:     3,
+		},
+		{
+			name:            "delayed retry then success",
+			retry:           RetryPolicy{MaxRetries: 2, BaseDelay: 30 * time.Millisecond, Multiplier: 2},
+			results:         []error{errTemporary, nil},
+			wantCalls:       2,
+			wantAttempts:    []int{0, 1},
+			wantRedelivered: []bool{false, false},
+			wantRetried:     1,
+		},
+		{
+			name:            "requeue redelivers once then dead letters",
+			retry:           RetryPolicy{MaxRetries: 3},
+			results:         []error{Requeue(errTemporary)},
+			wantCalls:       2,
+			wantAttempts:    []int{0, 0},
+			wantRedelivered: []bool{false, true},
+			wantDead:        1,
+			wantHistory:     1,
+		},
+		{
+			name:            "requeue then success",
+			retry:           RetryPolicy{MaxRetries: 3},
+			results:         []error{Requeue(errTemporary), nil},
+			wantCalls:       2,
+			wantAttempts:    []int{0, 0},
+			wantRedelivered: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu          sync.Mutex
+				attempts    []int
+				redelivered []bool
+				failures    []*Job[testPayload]
+			)
+			jt := JobType[testPayload]{
+				JobSpec: JobSpec{
+					Name:                 "test-job",
+					Queue:                "test_queue",
+					MaxPriority:          10,
+					DeadLetterExchange:   "test_dlx",
+					DeadLetterRoutingKey: "test_queue_dlq",
+					DeadLetterQueue:      "test_queue_dlq",
+					RetryExchange:        "test_retry_exchange",
+					Retry:                tt.retry,
+				},
+				Handle: func(ctx context.Context, job *Job[testPayload]) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if job.Payload.ID != "job-1" {
+						t.Errorf("payload id %q, want job-1", job.Payload.ID)
+					}
+					n := len(attempts)
+					attempts = append(attempts, job.Attempt)
+					redelivered = append(redelivered, job.Redelivered)
+					if n >= len(tt.results) {
+						n = len(tt.results) - 1
+					}
+					return tt.results[n]
+				},
+				OnFailure: func(ctx context.Context, job *Job[testPayload], err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					failures = append(failures, job)
+				},
+			}
+			q := newMemJobQueue(jt)
+			t.Cleanup(func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				_ = q.Shutdown(ctx)
+			})
+			if err := q.Enqueue(testPayload{ID: "job-1"}, 5); err != nil {
+				t.Fatalf("enqueue: %v", err)
+			}
+			if err := q.Consume(); err != nil {
+				t.Fatalf("consume: %v", err)
+			}
+
+			// 等待任务到达终态（成功或进入死信）且处理 goroutine 退出
+			deadline := time.Now().Add(3 * time.Second)
+			for q.counters.succeeded.Load()+q.counters.failed.Load() == 0 || q.counters.inFlight.Load() != 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("timed out waiting for the job to finish")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			// 确认没有多余的重新投递
+			time.Sleep(50 * time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(attempts) != tt.wantCalls {
+				t.Fatalf("handler called %d times, want %d", len(attempts), tt.wantCalls)
+			}
+			for i := range attempts {
+				if attempts[i] != tt.wantAttempts[i] {
+					t.Errorf("call %d: attempt %d, want %d", i+1, attempts[i], tt.wantAttempts[i])
+				}
+				if redelivered[i] != tt.wantRedelivered[i] {
+					t.Errorf("call %d: redelivered %v, want %v", i+1, redelivered[i], tt.wantRedelivered[i])
+				}
+			}
+
+			dead, err := q.t.count(jt.DeadLetterQueue)
+			if err != nil {
+				t.Fatalf("count dead letters: %v", err)
+			}
+			if dead != tt.wantDead {
+				t.Errorf("dead letters = %d, want %d", dead, tt.wantDead)
+			}
+			ready, err := q.t.count(jt.Queue)
+			if err != nil {
+				t.Fatalf("count ready: %v", err)
+			}
+			if ready != 0 {
+				t.Errorf("ready messages = %d, want 0", ready)
+			}
+			if got := q.counters.retried.Load(); got != tt.wantRetried {
+				t.Errorf("retried = %d, want %d", got, tt.wantRetried)
+			}
+
+			if tt.wantHistory == 0 {
+				if len(failures) != 0 {
+					t.Errorf("OnFailure called %d times, want 0", len(failures))
+				}
+				return
+			}
+			if len(failures) != 1 {
+				t.Fatalf("OnFailure called %d times, want 1", len(failures))
+			}
+			// 失败历史包含每一次消耗重试次数的失败，原样放回队列的那次不计入
+			if got := len(failures[0].History); got != tt.wantHistory {
+				t.Errorf("failure history has %d attempts, want %d", got, tt.wantHistory)
+			}
+		})
+	}
+}
+
+func TestJobQueueDelayedExchange(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	handled := make(chan time.Time, 1)
+	q := newMemJobQueue(JobType[testPayload]{
+		JobSpec: JobSpec{
+			Name:            "test-delayed",
+			Queue:           "test_delayed_queue",
+			DelayedExchange: "test_delayed_exchange",
+			Delay:           delay,
+		},
+		Handle: func(ctx context.Context, job *Job[testPayload]) error {
+			handled <- time.Now()
+			return nil
+		},
+	})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = q.Shutdown(ctx)
+	})
+	if err := q.Consume(); err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	start := time.Now()
+	if err := q.Enqueue(testPayload{ID: "job-1"}, 0); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	select {
+	case at := <-handled:
+		if at.Sub(start) < delay {
+			t.Fatalf("handled after %s, want at least %s", at.Sub(start), delay)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("delayed job was never handled")
+	}
+}
@@ -0,0 +1,426 @@
+package queue
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// 进程内队列后端（queue.backend = memory）：在没有 RabbitMQ 的笔记本上跑通完整流水线。
+//
+// 模拟了流水线依赖的 RabbitMQ 语义：
+//   - 优先级队列（x-max-priority），同优先级先进先出；
+//   - x-delayed-message 交换机按 x-delay header 延迟投递；
+//   - Nack(requeue=false) 按队列的死信配置路由到死信队列，并附带 x-death header；
+//   - Nack(requeue=true) 放回队列原来的位置，再次投递时 Redelivered = true；
+//   - 取消订阅时，已从队列取出但尚未交给处理函数的消息会重新入队。
+//
+// 所有队列共享同一个 broker，因此只能在同一进程内发布与消费（all 角色）。
+
+type memMessage struct {
+	seq         uint64
+	pub         amqp.Publishing
+	exchange    string
+	routingKey  string
+	redelivered bool
+}
+
+// memHeap 按优先级从高到低、同优先级按 seq 从小到大出队
+type memHeap []*memMessage
+
+func (h memHeap) Len() int { return len(h) }
+func (h memHeap) Less(i, j int) bool {
+	if h[i].pub.Priority != h[j].pub.Priority {
+		return h[i].pub.Priority > h[j].pub.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h memHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *memHeap) Push(x interface{}) { *h = append(*h, x.(*memMessage)) }
+func (h *memHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	m := old[n-1]
+	*h = old[:n-1]
+	return m
+}
+
+type memQueue struct {
+	name        string
+	maxPriority uint8
+	dlx, dlrk   string
+
+	ready   memHeap
+	unacked map[uint64]*memMessage
+	cond    *sync.Cond
+	// consumers 记录订阅的 tag，取消时关闭对应的 stop 通道
+	consumers map[string]chan struct{}
+}
+
+type memBroker struct {
+	mu      sync.Mutex
+	queues  map[string]*memQueue
+	delayed map[string]bool
+	// bindings exchange -> routing key -> 队列名
+	bindings map[string]map[string]string
+	seq      uint64
+	tag      uint64
+}
+
+var (
+	memBrokerOnce     sync.Once
+	memBrokerInstance *memBroker
+)
+
+// defaultMemBroker 进程内共享的 broker
+func defaultMemBroker() *memBroker {
+	memBrokerOnce.Do(func() {
+		memBrokerInstance = newMemBroker()
+	})
+	return memBrokerInstance
+}
+
+func newMemBroker() *memBroker {
+	return &memBroker{
+		queues:   make(map[string]*memQueue),
+		delayed:  make(map[string]bool),
+		bindings: make(map[string]map[string]string),
+	}
+}
+
+// transport 按 JobSpec 声明队列、死信与延迟交换机，返回该任务使用的消息通道
+func (b *memBroker) transport(spec JobSpec) transport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if spec.DeadLetterQueue != "" {
+		b.declareLocked(spec.DeadLetterQueue, 0, "", "")
+		b.bindLocked(spec.DeadLetterExchange, spec.DeadLetterRoutingKey, spec.DeadLetterQueue)
+	}
+	b.declareLocked(spec.Queue, spec.MaxPriority, spec.DeadLetterExchange, spec.DeadLetterRoutingKey)
+	if spec.DelayedExchange != "" {
+		b.delayed[spec.DelayedExchange] = true
+		b.bindLocked(spec.DelayedExchange, spec.Queue, spec.Queue)
+	}
+	if spec.RetryExchange != "" {
+		b.delayed[spec.RetryExchange] = true
+		b.bindLocked(spec.RetryExchange, spec.Queue, spec.Queue)
+	}
+	return &memTransport{b: b}
+}
+
+func (b *memBroker) declareLocked(name string, maxPriority int, dlx, dlrk string) *memQueue {
+	if q, ok := b.queues[name]; ok {
+		return q
+	}
+	if maxPriority > 255 {
+		maxPriority = 255
+	}
+	q := &memQueue{
+		name:        name,
+		maxPriority: uint8(maxPriority),
+		dlx:         dlx,
+		dlrk:        dlrk,
+		unacked:     make(map[uint64]*memMessage),
+		cond:        sync.NewCond(&b.mu),
+		consumers:   make(map[string]chan struct{}),
+	}
+	b.queues[name] = q
+	return q
+}
+
+func (b *memBroker) bindLocked(exchange, key, queue string) {
+	if b.bindings[exchange] == nil {
+		b.bindings[exchange] = make(map[string]string)
+	}
+	b.bindings[exchange][key] = queue
+}
+
+// routeLocked 把消息投递到 exchange/key 对应的队列；没有绑定的消息与 RabbitMQ 一样被丢弃
+func (b *memBroker) routeLocked(exchange, key string, msg *memMessage) bool {
+	name := key
+	if exchange != "" {
+		name = b.bindings[exchange][key]
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		return false
+	}
+	if msg.pub.Priority > q.maxPriority {
+		msg.pub.Priority = q.maxPriority
+	}
+	heap.Push(&q.ready, msg)
+	q.cond.Signal()
+	return true
+}
+
+func (b *memBroker) publish(exchange, key string, pub amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	msg := &memMessage{seq: b.seq, pub: pub, exchange: exchange, routingKey: key}
+	if b.delayed[exchange] {
+		if delay := delayFromHeaders(pub.Headers); delay > 0 {
+			time.AfterFunc(delay, func() {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+				b.routeLocked(exchange, key, msg)
+			})
+			return nil
+		}
+	}
+	if !b.routeLocked(exchange, key, msg) {
+		return fmt.Errorf("memory queue: no queue bound for exchange %q key %q: %w", exchange, key, ErrUnroutable)
+	}
+	return nil
+}
+
+func delayFromHeaders(h amqp.Table) time.Duration {
+	switch v := h["x-delay"].(type) {
+	case int:
+		return time.Duration(v) * time.Millisecond
+	case int32:
+		return time.Duration(v) * time.Millisecond
+	case int64:
+		return time.Duration(v) * time.Millisecond
+	}
+	return 0
+}
+
+// ack / nack 实现 amqp.Acknowledger，使 amqp.Delivery 的 Ack / Nack 作用于内存队列
+type memAcknowledger struct {
+	b *memBroker
+	q *memQueue
+}
+
+func (a *memAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+	delete(a.q.unacked, tag)
+	return nil
+}
+
+func (a *memAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+	msg, ok := a.q.unacked[tag]
+	if !ok {
+		return fmt.Errorf("memory queue: unknown delivery tag %d", tag)
+	}
+	delete(a.q.unacked, tag)
+	if requeue {
+		msg.redelivered = true
+		heap.Push(&a.q.ready, msg)
+		a.q.cond.Signal()
+		return nil
+	}
+	if a.q.dlx == "" {
+		return nil
+	}
+	// 与 RabbitMQ 一致：死信消息携带 x-death，记录来源队列与原因
+	headers := amqp.Table{}
+	for k, v := range msg.pub.Headers {
+		headers[k] = v
+	}
+	headers["x-death"] = []interface{}{amqp.Table{
+		"queue":        a.q.name,
+		"reason":       "rejected",
+		"count":        int64(1),
+		"exchange":     msg.exchange,
+		"routing-keys": []interface{}{msg.routingKey},
+		"time":         time.Now(),
+	}}
+	a.b.seq++
+	dead := &memMessage{seq: a.b.seq, pub: msg.pub, exchange: a.q.dlx, routingKey: a.q.dlrk}
+	dead.pub.Headers = headers
+	a.b.routeLocked(a.q.dlx, a.q.dlrk, dead)
+	return nil
+}
+
+func (a *memAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// memTransport 某个任务在内存 broker 上的消息通道
+type memTransport struct {
+	b *memBroker
+}
+
+func (t *memTransport) publish(exchange, key string, msg amqp.Publishing) error {
+	return t.b.publish(exchange, key, msg)
+}
+
+// consume 为队列启动一个投递 goroutine；取消订阅后关闭投递通道
+func (t *memTransport) consume(queueName string, drain *consumerDrain, handle func(<-chan amqp.Delivery)) error {
+	b := t.b
+	b.mu.Lock()
+	q, ok := b.queues[queueName]
+	if !ok {
+		b.mu.Unlock()
+		return fmt.Errorf("memory queue: queue %q not declared", queueName)
+	}
+	stop := make(chan struct{})
+	q.consumers[drain.tag] = stop
+	b.mu.Unlock()
+
+	deliveries := make(chan amqp.Delivery)
+	ack := &memAcknowledger{b: b, q: q}
+	go func() {
+		defer close(deliveries)
+		for {
+			b.mu.Lock()
+			for q.ready.Len() == 0 && !isClosed(stop) {
+				q.cond.Wait()
+			}
+			if isClosed(stop) {
+				b.mu.Unlock()
+				return
+			}
+			msg := heap.Pop(&q.ready).(*memMessage)
+			b.tag++
+			tag := b.tag
+			q.unacked[tag] = msg
+			b.mu.Unlock()
+
+			d := amqp.Delivery{
+				Acknowledger:    ack,
+				Headers:         msg.pub.Headers,
+				ContentType:     msg.pub.ContentType,
+				ContentEncoding: msg.pub.ContentEncoding,
+				DeliveryMode:    msg.pub.DeliveryMode,
+				Priority:        msg.pub.Priority,
+				MessageId:       msg.pub.MessageId,
+				Timestamp:       msg.pub.Timestamp,
+				ConsumerTag:     drain.tag,
+				DeliveryTag:     tag,
+				Redelivered:     msg.redelivered,
+				Exchange:        msg.exchange,
+				RoutingKey:      msg.routingKey,
+				Body:            msg.pub.Body,
+			}
+			select {
+			case deliveries <- d:
+			case <-stop:
+				// 尚未交给处理函数：放回队列
+				_ = ack.Nack(tag, false, true)
+				return
+			}
+		}
+	}()
+
+	drain.started.Store(true)
+	drain.wg.Add(1)
+	go func() {
+		defer drain.wg.Done()
+		handle(deliveries)
+	}()
+	return nil
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *memTransport) ping(queueName string) error {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	if _, ok := t.b.queues[queueName]; !ok {
+		return fmt.Errorf("memory queue: queue %q not declared", queueName)
+	}
+	return nil
+}
+
+// cancel 取消订阅：停止投递新消息
+func (t *memTransport) cancel(tag string) {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	for _, q := range t.b.queues {
+		if stop, ok := q.consumers[tag]; ok {
+			close(stop)
+			delete(q.consumers, tag)
+			q.cond.Broadcast()
+		}
+	}
+}
+
+// browse 从队列头部取出最多 limit 条消息，未删除的按原来的位置放回
+func (t *memTransport) browse(queueName string, limit int, fn func(d amqp.Delivery) (bool, error)) error {
+	b := t.b
+	b.mu.Lock()
+	q, ok := b.queues[queueName]
+	if !ok {
+		b.mu.Unlock()
+		return fmt.Errorf("memory queue: queue %q not declared", queueName)
+	}
+	var taken []*memMessage
+	for len(taken) < limit && q.ready.Len() > 0 {
+		taken = append(taken, heap.Pop(&q.ready).(*memMessage))
+	}
+	b.mu.Unlock()
+
+	var kept []*memMessage
+	var err error
+	for i, msg := range taken {
+		remove, ferr := fn(amqp.Delivery{
+			Headers:     msg.pub.Headers,
+			ContentType: msg.pub.ContentType,
+			Priority:    msg.pub.Priority,
+			MessageId:   msg.pub.MessageId,
+			Timestamp:   msg.pub.Timestamp,
+			Redelivered: msg.redelivered,
+			Exchange:    msg.exchange,
+			RoutingKey:  msg.routingKey,
+			Body:        msg.pub.Body,
+		})
+		if ferr != nil {
+			kept = append(kept, taken[i:]...)
+			err = ferr
+			break
+		}
+		if !remove {
+			kept = append(kept, msg)
+		}
+	}
+
+	b.mu.Lock()
+	for _, msg := range kept {
+		heap.Push(&q.ready, msg)
+	}
+	q.cond.Broadcast()
+	b.mu.Unlock()
+	return err
+}
+
+func (t *memTransport) count(queueName string) (int, error) {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	q, ok := t.b.queues[queueName]
+	if !ok {
+		return 0, fmt.Errorf("memory queue: queue %q not declared", queueName)
+	}
+	return q.ready.Len(), nil
+}
+
+func (t *memTransport) purge(queueName string) (int, error) {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	q, ok := t.b.queues[queueName]
+	if !ok {
+		return 0, fmt.Errorf("memory queue: queue %q not declared", queueName)
+	}
+	n := q.ready.Len()
+	q.ready = nil
+	return n, nil
+}
+
+// close 内存 broker 在进程内共享，单个任务关闭时不影响其他队列
+func (t *memTransport) close() error {
+	return nil
+}
@@ -0,0 +1,272 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// startMemConsumer 订阅队列，把投递转发到返回的通道；测试结束时取消订阅
+func startMemConsumer(t *testing.T, tr transport, queueName string) <-chan amqp.Delivery {
+	t.Helper()
+	out := make(chan amqp.Delivery, 16)
+	drain := newConsumerDrain(queueName)
+	err := tr.consume(queueName, drain, func(deliveries <-chan amqp.Delivery) {
+		for d := range deliveries {
+			out <- d
+		}
+	})
+	if err != nil {
+		t.Fatalf("consume %s: %v", queueName, err)
+	}
+	t.Cleanup(func() { tr.cancel(drain.tag) })
+	return out
+}
+
+func receive(t *testing.T, ch <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return amqp.Delivery{}
+	}
+}
+
+func expectNoDelivery(t *testing.T, ch <-chan amqp.Delivery) {
+	t.Helper()
+	select {
+	case d := <-ch:
+		t.Fatalf("unexpected delivery %q", d.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemTransportDeliveryOrder(t *testing.T) {
+	type message struct {
+		body     string
+		priority uint8
+		// delay 大于 0 时经由延迟交换机发布
+		delay time.Duration
+	}
+	tests := []struct {
+		name     string
+		spec     JobSpec
+		messages []message
+		want     []string
+		// wantPriority 投递时的优先级（超过 x-max-priority 的会被截断）
+		wantPriority map[string]uint8
+	}{
+		{
+			name:     "priority first, fifo within priority",
+			spec:     JobSpec{Queue: "order.priority", MaxPriority: 10},
+			messages: []message{{body: "a", priority: 1}, {body: "b", priority: 5}, {body: "c", priority: 5}, {body: "d"}},
+			want:     []string{"b", "c", "a", "d"},
+		},
+		{
+			name:         "priority capped at max priority",
+			spec:         JobSpec{Queue: "order.capped", MaxPriority: 2},
+			messages:     []message{{body: "a", priority: 1}, {body: "b", priority: 9}, {body: "c", priority: 2}},
+			want:         []string{"b", "c", "a"},
+			wantPriority: map[string]uint8{"b": 2, "c": 2, "a": 1},
+		},
+		{
+			name:     "no priority queue is fifo",
+			spec:     JobSpec{Queue: "order.fifo"},
+			messages: []message{{body: "a", priority: 3}, {body: "b", priority: 7}},
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "delayed message after immediate ones",
+			spec:     JobSpec{Queue: "order.delayed", DelayedExchange: "order.delayed.exchange"},
+			messages: []message{{body: "late", delay: 150 * time.Millisecond}, {body: "now"}},
+			want:     []string{"now", "late"},
+		},
+		{
+			name:     "retry exchange delays like delayed exchange",
+			spec:     JobSpec{Queue: "order.retry", RetryExchange: "order.retry.exchange"},
+			messages: []message{{body: "retry", delay: 150 * time.Millisecond}, {body: "first"}},
+			want:     []string{"first", "retry"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newMemBroker().transport(tt.spec)
+			start := time.Now()
+			delays := make(map[string]time.Duration)
+			for _, m := range tt.messages {
+				exchange := ""
+				var headers amqp.Table
+				if m.delay > 0 {
+					exchange = tt.spec.DelayedExchange
+					if exchange == "" {
+						exchange = tt.spec.RetryExchange
+					}
+					headers = amqp.Table{"x-delay": m.delay.Milliseconds()}
+					delays[m.body] = m.delay
+				}
+				pub := amqp.Publishing{Body: []byte(m.body), Priority: m.priority, Headers: headers}
+				if err := tr.publish(exchange, tt.spec.Queue, pub); err != nil {
+					t.Fatalf("publish %s: %v", m.body, err)
+				}
+			}
+
+			deliveries := startMemConsumer(t, tr, tt.spec.Queue)
+			for _, want := range tt.want {
+				d := receive(t, deliveries)
+				if string(d.Body) != want {
+					t.Fatalf("got %q, want %q", d.Body, want)
+				}
+				if d.Redelivered {
+					t.Errorf("%s: first delivery marked redelivered", want)
+				}
+				if p, ok := tt.wantPriority[want]; ok && d.Priority != p {
+					t.Errorf("%s: priority %d, want %d", want, d.Priority, p)
+				}
+				if delay := delays[want]; delay > 0 && time.Since(start) < delay {
+					t.Errorf("%s: delivered after %s, want at least %s", want, time.Since(start), delay)
+				}
+				if err := d.Ack(false); err != nil {
+					t.Fatalf("ack %s: %v", want, err)
+				}
+			}
+			expectNoDelivery(t, deliveries)
+		})
+	}
+}
+
+func TestMemTransportUnroutable(t *testing.T) {
+	tr := newMemBroker().transport(JobSpec{Queue: "unroutable"})
+	if err := tr.publish("missing.exchange", "unroutable", amqp.Publishing{Body: []byte("x")}); err == nil {
+		t.Fatal("publish to unbound exchange succeeded")
+	}
+}
+
+func TestMemTransportNack(t *testing.T) {
+	const dlq = "nack.dlq"
+	withDLQ := func(queue string) JobSpec {
+		return JobSpec{
+			Queue:                queue,
+			DeadLetterExchange:   "nack.dlx",
+			DeadLetterRoutingKey: dlq,
+			DeadLetterQueue:      dlq,
+		}
+	}
+	tests := []struct {
+		name    string
+		spec    JobSpec
+		requeue bool
+		// wantRedelivered 消息放回主队列并再次投递
+		wantRedelivered bool
+		// wantDead 死信队列中的消息数（-1 表示没有声明死信队列）
+		wantDead int
+	}{
+		{name: "requeue redelivers", spec: withDLQ("nack.requeue"), requeue: true, wantRedelivered: true, wantDead: 0},
+		{name: "reject routes to dead letter", spec: withDLQ("nack.reject"), wantDead: 1},
+		{name: "reject without dead letter drops", spec: JobSpec{Queue: "nack.drop"}, wantDead: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newMemBroker().transport(tt.spec)
+			headers := amqp.Table{"x-attempts": 2}
+			if err := tr.publish("", tt.spec.Queue, amqp.Publishing{Body: []byte("job"), Headers: headers}); err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+			deliveries := startMemConsumer(t, tr, tt.spec.Queue)
+
+			d := receive(t, deliveries)
+			if err := d.Nack(false, tt.requeue); err != nil {
+				t.Fatalf("nack: %v", err)
+			}
+			if err := d.Nack(false, tt.requeue); err == nil {
+				t.Error("second nack of the same delivery succeeded")
+			}
+
+			if tt.wantRedelivered {
+				again := receive(t, deliveries)
+				if string(again.Body) != "job" || !again.Redelivered {
+					t.Fatalf("redelivery = %q (redelivered %v), want job (redelivered true)", again.Body, again.Redelivered)
+				}
+				_ = again.Ack(false)
+			} else {
+				expectNoDelivery(t, deliveries)
+			}
+
+			if tt.wantDead < 0 {
+				return
+			}
+			n, err := tr.count(dlq)
+			if err != nil {
+				t.Fatalf("count dead letters: %v", err)
+			}
+			if n != tt.wantDead {
+				t.Fatalf("dead letters = %d, want %d", n, tt.wantDead)
+			}
+			if n == 0 {
+				return
+			}
+			err = tr.browse(dlq, 1, func(dead amqp.Delivery) (bool, error) {
+				if string(dead.Body) != "job" {
+					t.Errorf("dead letter body %q, want job", dead.Body)
+				}
+				if headerInt(dead.Headers, "x-attempts") != 2 {
+					t.Errorf("dead letter lost x-attempts header: %v", dead.Headers)
+				}
+				deaths, _ := dead.Headers["x-death"].([]interface{})
+				if len(deaths) != 1 {
+					t.Fatalf("x-death = %v, want one entry", dead.Headers["x-death"])
+				}
+				death, _ := deaths[0].(amqp.Table)
+				if death["queue"] != tt.spec.Queue || death["reason"] != "rejected" {
+					t.Errorf("x-death = %v, want queue %s reason rejected", death, tt.spec.Queue)
+				}
+				return false, nil
+			})
+			if err != nil {
+				t.Fatalf("browse: %v", err)
+			}
+		})
+	}
+}
+
+func TestMemTransportCancelRequeues(t *testing.T) {
+	spec := JobSpec{Queue: "cancel.requeue"}
+	tr := newMemBroker().transport(spec)
+	drain := newConsumerDrain("cancel")
+	block := make(chan struct{})
+	// 处理函数不读取投递通道：投递 goroutine 已取出消息但无法交出
+	err := tr.consume(spec.Queue, drain, func(<-chan amqp.Delivery) { <-block })
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if err := tr.publish("", spec.Queue, amqp.Publishing{Body: []byte("job")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	tr.cancel(drain.tag)
+	close(block)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n, err := tr.count(spec.Queue)
+		if err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ready messages after cancel = %d, want 1", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	d := receive(t, startMemConsumer(t, tr, spec.Queue))
+	if string(d.Body) != "job" || !d.Redelivered {
+		t.Fatalf("delivery after cancel = %q (redelivered %v), want job (redelivered true)", d.Body, d.Redelivered)
+	}
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"V2V/models"
+	"V2V/pkg/fakeprovider"
+	"V2V/pkg/provider"
+	"V2V/pkg/storyboard"
+	"V2V/settings"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPipelineAgainstFakeProviders 对着本地模拟服务跑一遍 V2T → T2I（per_shot）→ I2V 的外部调用：
+// 与各阶段的处理函数使用相同的提示词渲染与服务调用，只是不经过 Redis / MySQL / 队列
+func TestPipelineAgainstFakeProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer string
+		// endpoint 视频分析应调用的模拟端点
+		endpoint string
+	}{
+		{name: "gemini", analyzer: settings.AnalyzerGemini, endpoint: fakeprovider.EndpointGemini},
+		{name: "doubao", analyzer: settings.AnalyzerDoubao, endpoint: fakeprovider.EndpointChat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 样例视频直接用一个文件代替，避免依赖 ffmpeg
+			sample := filepath.Join(t.TempDir(), "sample.mp4")
+			if err := os.WriteFile(sample, []byte("fake mp4"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			srv := fakeprovider.NewTestServer(t, fakeprovider.Script{
+				Tasks:       fakeprovider.TaskScript{Duration: settings.Duration{Duration: 300 * time.Millisecond}},
+				SampleVideo: sample,
+			})
+			cfg := srv.Config()
+			cfg.VideoAnalysis.Provider = tt.analyzer
+			srv.Configure(cfg)
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			// V2T：分析视频并解析出结构化分镜
+			instructions, err := renderPrompt(models.PromptV2T, nil, nil)
+			if err != nil {
+				t.Fatalf("render V2T prompt: %v", err)
+			}
+			video := provider.VideoSource{URL: srv.URL + "/media/source.mp4"}
+			text, used, err := provider.AnalyzeVideo(ctx, "", video, instructions, storyboard.Schema())
+			if err != nil {
+				t.Fatalf("analyze video: %v", err)
+			}
+			if used != tt.analyzer {
+				t.Errorf("analyzed with %s, want %s", used, tt.analyzer)
+			}
+			shots, format, err := storyboard.Parse(text)
+			if err != nil {
+				t.Fatalf("parse storyboard: %v", err)
+			}
+			if format != models.StoryboardJSON || len(shots) != 3 {
+				t.Fatalf("storyboard format %s with %d shots, want json with 3", format, len(shots))
+			}
+			if n := srv.Calls(tt.endpoint); n != 1 {
+				t.Errorf("%s calls = %d, want 1", tt.endpoint, n)
+			}
+
+			// T2I：逐镜头生成首帧图片，图片与分镜一一对应
+			result, err := T2IHandler(ctx, models.T2ITask{
+				TaskID:  1,
+				UserID:  1,
+				Mode:    models.T2IModePerShot,
+				Shots:   shots,
+				Options: models.ImageOptions{Size: "1K", Count: len(shots)},
+			})
+			if err != nil {
+				t.Fatalf("generate shot images: %v", err)
+			}
+			if len(result.Images) != len(shots) {
+				t.Fatalf("got %d images, want %d", len(result.Images), len(shots))
+			}
+			if n := srv.Calls(fakeprovider.EndpointImages); n != len(shots) {
+				t.Errorf("image calls = %d, want %d", n, len(shots))
+			}
+
+			// I2V：每个分镜用自己的首帧、视频提示词与时长创建任务并轮询到完成
+			ids := make([]string, len(shots))
+			for i, shot := range shots {
+				image := result.Images[i]
+				if image.Error != "" || image.URL == "" {
+					t.Fatalf("shot %d image = %+v, want a URL", shot.ShotNo, image)
+				}
+				opts := models.VideoOptions{Resolution: "720p", Duration: int(shot.Duration)}
+				prompt, err := renderPrompt(models.PromptI2V, nil, map[string]interface{}{
+					"index":       i,
+					"shot_no":     shot.ShotNo,
+					"prompt":      shot.VideoPrompt,
+					"camera_move": shot.CameraMove,
+					"duration":    opts.Duration,
+				})
+				if err != nil {
+					t.Fatalf("render I2V prompt: %v", err)
+				}
+				if !strings.Contains(prompt, shot.VideoPrompt) {
+					t.Errorf("shot %d prompt %q does not contain its video prompt %q", shot.ShotNo, prompt, shot.VideoPrompt)
+				}
+				ids[i], err = provider.Videos().CreateVideoTask(ctx, provider.VideoRequest{
+					Prompt:     prompt,
+					ImageURL:   image.URL,
+					Resolution: opts.Resolution,
+					Duration:   opts.Duration,
+				})
+				if err != nil {
+					t.Fatalf("create video task for shot %d: %v", shot.ShotNo, err)
+				}
+			}
+			for i, id := range ids {
+				task := waitVideoTask(ctx, t, id)
+				if task.Status != models.I2VSubTaskSucceeded {
+					t.Fatalf("shot %d video task %s ended %s: %s", shots[i].ShotNo, id, task.Status, task.Error)
+				}
+				body := download(t, task.VideoURL)
+				if body != "fake mp4" {
+					t.Errorf("shot %d video = %q, want the sample video", shots[i].ShotNo, body)
+				}
+			}
+			if n := srv.Calls(fakeprovider.EndpointTaskCreate); n != len(shots) {
+				t.Errorf("video task create calls = %d, want %d", n, len(shots))
+			}
+		})
+	}
+}
+
+// waitVideoTask 轮询视频任务直到结束
+func waitVideoTask(ctx context.Context, t *testing.T, id string) *provider.VideoTask {
+	t.Helper()
+	for {
+		task, err := provider.Videos().GetVideoTask(ctx, id)
+		if err != nil {
+			t.Fatalf("get video task %s: %v", id, err)
+		}
+		switch task.Status {
+		case models.I2VSubTaskQueued, models.I2VSubTaskRunning:
+		default:
+			return task
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("video task %s still %s: %v", id, task.Status, ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func download(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("download %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("download %s: status %d: %v", url, resp.StatusCode, err)
+	}
+	return string(b)
+}
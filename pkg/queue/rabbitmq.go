@@ -4,24 +4,29 @@ import (
 	"V2V/dao/mysql"
 	"V2V/dao/store"
 	"V2V/models"
+	"V2V/pkg/prompt"
+	"V2V/pkg/provider"
 	"V2V/pkg/sse"
+	"V2V/pkg/storyboard"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
-
-	"github.com/streadway/amqp"
-	"google.golang.org/genai"
 )
 
 // MessageQueue 是队列最小接口（用于发布与消费）
 type MessageQueue interface {
 	Publish([]byte, int) error
 	Consume() error
+	// Shutdown 停止消费新消息，等待在途任务完成（最长到 ctx 截止）后关闭连接
+	Shutdown(ctx context.Context) error
+	// Ping 检查与 broker 的连接是否可用（用于就绪探针）
+	Ping() error
 	Close() error
 }
 
@@ -57,408 +62,160 @@ func GetRabbitMQ() (MessageQueue, error) {
 	return rabbitInstance, nil
 }
 
-// --- AMQP 实现 ---------------------------------------------------------
-type amqpQueue struct {
-	conn      *amqp.Connection
-	ch        *amqp.Channel
-	queueName string
+// --- V2T 任务 ---------------------------------------------------------
+//
+// 死信概念回顾（注释说明）：
+//   - Dead Letter Queue (DLQ)：用于保存无法被正常处理或需要人工介入的消息。
+//   - Dead Letter Exchange (DLX)：当队列对某条消息执行 Nack(requeue=false) 或消息过期/超出长度等情况时，
+//     RabbitMQ 会把该消息路由到配置的 DLX，由 DLX 转发到指定的 DLQ。
+//   - 为什么需要交换机（DLX）而不是直接把消息放到队列：
+//     交换机（Exchange）是 RabbitMQ 的路由中心，DLX 允许把不同来源或不同路由 key 的消息进行灵活路由，
+//     例如可以把不同主队列的死信都路由到同一个 DLQ 或不同 DLQ；使用 exchange 可以实现更灵活的拓扑。
+//
+// 本实现：direct 类型的 DLX（v2t_dlq_exchange）绑定 DLQ（v2t_dlq），主队列 `v2t_tasks` 设置
+// `x-dead-letter-exchange` 与 `x-dead-letter-routing-key`，Nack(false,false) 的消息会被送到 DLX -> DLQ。
+// 当消息进入 DLQ 时，应该有独立的监控/处理流程用于人工排查或自动补救（例如把修复后的消息回放）。
+
+const v2tQueueName = "v2t_tasks"
+
+// v2tJob V2T 任务：调用视频分析 API 生成分镜脚本
+var v2tJob = JobType[models.V2TTask]{
+	JobSpec: JobSpec{
+		Name:                 "v2t",
+		Queue:                v2tQueueName,
+		MaxPriority:          10,
+		DeadLetterExchange:   "v2t_dlq_exchange",
+		DeadLetterRoutingKey: "v2t_dlq",
+		DeadLetterQueue:      "v2t_dlq",
+		// 失败重试经由延迟交换机按退避时间投递，退避参数来自 queue.retry.v2t
+		RetryExchange: "v2t_retry_exchange",
+		Persistent:    true,
+		// basic QoS: 设置 prefetch，配合消费者并发数使用以提高吞吐
+		Prefetch:    10,
+		Concurrency: 10,
+		// Breakers 为配置的视频分析服务所在平台，见 newAMQPQueue
+	},
+	Handle:    handleV2T,
+	OnRetry:   retryV2T,
+	OnFailure: failV2T,
 }
 
 func newAMQPQueue(dsn string) (MessageQueue, error) {
-	conn, err := amqp.Dial(dsn)
+	jt := v2tJob
+	jt.Retry = retryPolicyFrom(queueConf.Retry.V2T)
+	// 主服务熔断时任务会切换到备用服务，只有全部熔断才暂停消费
+	jt.Breakers = provider.AnalyzerPlatforms()
+	return NewJobQueue(dsn, jt)
+}
+
+// handleV2T 调用视频分析服务（任务指定或配置的默认服务，临时错误时切换到备用服务），
+// 结果写入 Redis 与 MySQL 后通过 SSE 通知前端
+//
+// 错误分类：
+//   - 永久错误（参数错误 / HTTP 400 / INVALID_ARGUMENT）重试没有意义，直接进入 DLQ；
+//   - 临时错误（网络、限流等，且备用服务也失败）按重试策略重新发布；
+//   - 存储失败视为临时问题，原样重入队一次。
+func handleV2T(ctx context.Context, job *Job[models.V2TTask]) error {
+	vt := job.Payload
+	taskIDStr := strconv.FormatUint(vt.TaskID, 10)
+	video := provider.VideoSource{URL: vt.V2TRequest.VideoURL}
+	if f := vt.V2TRequest.VideoFile; f != nil {
+		video = provider.VideoSource{Path: f.Path, MIMEType: f.ContentType}
+	}
+	instructions, err := renderPrompt(models.PromptV2T, vt.PromptTemplate, nil)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("task id: %s: %w", taskIDStr, err)
 	}
-	ch, err := conn.Channel()
+	text, used, err := provider.AnalyzeVideo(ctx, vt.V2TRequest.Provider, video, instructions, storyboard.Schema())
 	if err != nil {
-		conn.Close()
-		return nil, err
-	}
-	// 创建死信交换与死信队列
-	//
-	// 概念回顾（注释说明）：
-	// - Dead Letter Queue (DLQ)：用于保存无法被正常处理或需要人工介入的消息。
-	// - Dead Letter Exchange (DLX)：当队列对某条消息执行 Nack(requeue=false) 或消息过期/超出长度等情况时，
-	//   RabbitMQ 会把该消息路由到配置的 DLX，由 DLX 转发到指定的 DLQ。
-	// - 为什么需要交换机（DLX）而不是直接把消息放到队列：
-	//   交换机（Exchange）是 RabbitMQ 的路由中心，DLX 允许把不同来源或不同路由 key 的消息进行灵活路由，
-	//   例如可以把不同主队列的死信都路由到同一个 DLQ 或不同 DLQ；使用 exchange 可以实现更灵活的拓扑。
-	//
-	// 本实现：
-	// - 建立一个 direct 类型的 DLX（v2t_dlq_exchange），并声明 DLQ 队列（v2t_dlq）绑定到该 DLX；
-	// - 在主队列 `v2t_tasks` 的参数中设置 `x-dead-letter-exchange` 与 `x-dead-letter-routing-key`，
-	//   当我们对消息执行 `Nack(false,false)`（不重入队）时，消息会被送到 DLX -> DLQ。
-
-	dlxName := "v2t_dlq_exchange"
-	dlqName := "v2t_dlq"
-	if err := ch.ExchangeDeclare(dlxName, "direct", true, false, false, false, nil); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
-	}
-	if _, err := ch.QueueDeclare(dlqName, true, false, false, false, nil); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
-	}
-	if err := ch.QueueBind(dlqName, dlqName, dlxName, false, nil); err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
+		es := err.Error()
+		upper := strings.ToUpper(es)
+		// 上传的视频文件不存在（被清理或存储目录未共享）时重试也没有意义
+		if strings.Contains(upper, "INVALID_ARGUMENT") || strings.Contains(es, "400") || errors.Is(err, fs.ErrNotExist) {
+			return Permanent(fmt.Errorf("video analysis API, task id: %s: %w", taskIDStr, err))
+		}
+		return fmt.Errorf("video analysis API, task id: %s: %w", taskIDStr, err)
 	}
 
-	// 为主队列添加 dead-letter 配置（当 Nack requeue=false 时会进入 DLQ）
-	args := amqp.Table{
-		"x-dead-letter-exchange":    dlxName,
-		"x-dead-letter-routing-key": dlqName,
-		"x-max-priority":            10,
-	}
-	// _, _ = ch.QueueDelete("v2t_tasks", false, false, false)
-	q, err := ch.QueueDeclare(
-		"v2t_tasks", // name
-		true,        // durable
-		false,       // delete when unused
-		false,       // exclusive
-		false,       // no-wait
-		args,        // args
-	)
+	// 结构化的分镜按 Markdown 表格保存为 result；无法解析时保留模型原文，后续阶段按整段文本使用
+	shots, format, err := storyboard.Parse(text)
 	if err != nil {
-		ch.Close()
-		conn.Close()
-		return nil, err
+		log.Printf("V2T storyboard is not structured, keeping raw text, task id: %s: %v", taskIDStr, err)
+	} else {
+		vt.Shots = shots
+		if format == models.StoryboardJSON {
+			text = storyboard.Markdown(shots)
+		}
 	}
-	// basic QoS: 设置 prefetch，配合消费者并发数使用以提高吞吐
-	// 值可以根据实际负载调整或由环境变量配置
-	_ = ch.Qos(10, 0, false)
-	return &amqpQueue{conn: conn, ch: ch, queueName: q.Name}, nil
-}
+	vt.Result = text
+	vt.Provider = used
+	vt.Status = models.StatusCompleted
+	vt.Attempts = job.History
 
-func (q *amqpQueue) Publish(b []byte, priority int) error {
-	return q.ch.Publish(
-		"", q.queueName, false, false,
-		amqp.Publishing{ContentType: "application/json", Body: b, DeliveryMode: amqp.Persistent, Priority: uint8(priority)},
-	)
-}
-
-// publishWithHeaders 发布消息并携带自定义 header（用于重试计数）
-func (q *amqpQueue) publishWithHeaders(b []byte, headers amqp.Table) error {
-	msg := amqp.Publishing{
-		ContentType:  "application/json",
-		Body:         b,
-		DeliveryMode: amqp.Persistent,
-		Headers:      headers,
+	if err := store.V2TTask(vt); err != nil {
+		return Requeue(fmt.Errorf("failed to update redis, task id: %s: %w", taskIDStr, err))
 	}
-	return q.ch.Publish("", q.queueName, false, false, msg)
-}
-
-// ConsumeAndServe 在 AMQP 消费循环中直接执行 handler，每条消息处理成功后 Ack，失败时 Nack (并可重新入队)
-// handler 返回 nil 表示处理成功；非 nil 表示处理失败，函数会根据 requeue 参数决定是否重新入队。
-func (q *amqpQueue) Consume() error {
-	deliveries, err := q.ch.Consume(q.queueName, "", false, false, false, false, nil)
-	if err != nil {
-		return err
+	// 分镜整体覆盖写入，可以重复执行，放在任务记录之前
+	if len(vt.Shots) > 0 {
+		if err := mysql.ReplaceV2TShots(vt.TaskID, vt.UserID, vt.Shots); err != nil {
+			return Requeue(fmt.Errorf("failed to store V2T shots, task id: %s: %w", taskIDStr, err))
+		}
 	}
-
-	// 并发控制（与上面 ch.Qos 的值配合使用）
-	concurrency := 10
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
-
-	for d := range deliveries {
-		sem <- struct{}{}
-		wg.Add(1)
-		// spawn goroutine 处理每条消息，处理结束后 Ack/Nack
-		//
-		// 处理策略说明（注释）：
-		// - 首先把消息反序列化为内部任务结构 `V2TTask`，如果解析失败则认为该消息无效，直接 Nack(requeue=false) -> 进入 DLQ。
-		// - 调用外部视频分析 API：
-		//   - 若返回永久错误（例如参数错误 / HTTP 400 / INVALID_ARGUMENT），则认为重试没有意义，Nack(false,false) -> DLQ。
-		//   - 若返回临时错误（网络、限流等），则用 header `x-attempts` 跟踪重试次数：
-		//     - 如果 attempts < maxRetries：把消息带上 attempts+1 重新发布到主队列（publishWithHeaders），并 Ack 原消息。
-		//       这里采用 re-publish + ack 的方式而不是 Nack(requeue=true)，以便我们可以在 republish 时修改 header（amqp 内部 redelivery header 无法修改）。
-		//     - 如果 attempts >= maxRetries：Nack(false,false) -> DLQ。
-		// - 存储结果到 Redis 时也会进行错误判断：存储失败视为临时错误，可重试（使用 del.Redelivered 或 header 来决定是否丢弃）。
-		//
-		// 设计权衡：
-		// - 采用 republish 而不是直接 nack requeue=true 的原因是我们想在重试时增加/修改 header（x-attempts），
-		//   以便精确控制最大重试次数。直接 requeue 无法修改 header。
-		// - 目前实现是立即重试（republish 立刻入队），若需延迟重试应引入延迟队列/TTL 或 RabbitMQ 的 delayed-message 插件。
-		// - 当消息进入 DLQ 时，应该有独立的监控/处理流程用于人工排查或自动补救（例如把修复后的消息回放）。
-		go func(del amqp.Delivery) {
-			defer func() { <-sem; wg.Done() }()
-
-			var vt models.V2TTask
-			if err := json.Unmarshal(del.Body, &vt); err != nil {
-				log.Printf("Invalid task payload: %v", err)
-				// 非法消息，丢弃或送 DLQ（这里选择不重试）
-				// 注：对非法消息直接 Nack(false,false) 会触发队列的 x-dead-letter-exchange 路由到 DLQ
-				_ = del.Nack(false, false)
-				return
-			}
-
-			// 调用分析 API
-			taskIDStr := strconv.FormatUint(vt.TaskID, 10)
-			text, err := callVideoAnalysisAPI(vt.V2TRequest.VideoURL)
-			if err != nil {
-				// 将错误分类为永久错误或临时错误
-				es := err.Error()
-				upper := strings.ToUpper(es)
-				isPermanent := strings.Contains(upper, "INVALID_ARGUMENT") || strings.Contains(es, "400")
-				if isPermanent {
-					// 永久错误：参数不合法等原因，重试无意义，直接送 DLQ
-					log.Printf("Permanent error calling video analysis API, task id: %s: %v", taskIDStr, err)
-					_ = del.Nack(false, false)
-					payload := struct {
-						Code   int    `json:"code"`
-						UserID uint64 `json:"user_id"`
-						TaskID uint64 `json:"task_id"`
-						Status string `json:"status"`
-						Result string `json:"result,omitempty"`
-					}{
-						Code:   400,
-						UserID: vt.UserID,
-						TaskID: vt.TaskID,
-						Status: models.StatusFailed,
-						Result: err.Error(),
-					}
-					if hub := sse.GetHub(); hub != nil {
-						if b, err := json.Marshal(payload); err == nil {
-							hub.PublishTopic(strconv.FormatUint(vt.UserID, 10), b)
-						}
-					}
-					return
-				}
-
-				// 检查 header 中的重试计数（x-attempts），决定是否把消息送入 DLQ
-				attempts := 0
-				if h, ok := del.Headers["x-attempts"]; ok {
-					switch v := h.(type) {
-					case int:
-						attempts = v
-					case int32:
-						attempts = int(v)
-					case int64:
-						attempts = int(v)
-					case string:
-						if n, err := strconv.Atoi(v); err == nil {
-							attempts = n
-						}
-					}
-				}
-
-				// 重试策略：最多重试 maxRetries 次，超过则进入 DLQ
-				maxRetries := 1
-				if attempts >= maxRetries {
-					log.Printf("Exceeded retries, sending to DLQ, task id: %s: %v", taskIDStr, err)
-					payload := struct {
-						Code   int    `json:"code"`
-						UserID uint64 `json:"user_id"`
-						TaskID uint64 `json:"task_id"`
-						Status string `json:"status"`
-						Result string `json:"result,omitempty"`
-					}{
-						Code:   500,
-						UserID: vt.UserID,
-						TaskID: vt.TaskID,
-						Status: models.StatusFailed,
-						Result: err.Error(),
-					}
-					if hub := sse.GetHub(); hub != nil {
-						if b, err := json.Marshal(payload); err == nil {
-							hub.PublishTopic(strconv.FormatUint(vt.UserID, 10), b)
-						}
-					}
-					// 发送到死信队列（通过 nack requeue=false 按队列 x-dead-letter 配置路由）
-					_ = del.Nack(false, false)
-					return
-				}
-
-				// 重新发布消息到主队列并增加 attempts header，然后 ack 当前消息以避免重复
-				// 说明：使用 republish + ack 而不是 nack(requeue=true) 的原因是我们可以修改 header（x-attempts）
-				newHeaders := amqp.Table{}
-				for k, v := range del.Headers {
-					newHeaders[k] = v
-				}
-				newHeaders["x-attempts"] = attempts + 1
-
-				if err := q.publishWithHeaders(del.Body, newHeaders); err != nil {
-					log.Printf("Failed to republish message for retry, task id: %s: %v", taskIDStr, err)
-					// republish 失败，选择将原消息 nack 并不重入（可改为重入或记录为警告）
-					_ = del.Nack(false, false)
-					return
-				}
-				log.Printf("Requeued message for retry #%d, task id: %s", attempts+1, taskIDStr)
-				_ = del.Ack(false)
-				return
-			}
-
-			vt.Result = text
-			vt.Status = models.StatusCompleted
-
-			if err := store.V2TTask(vt); err != nil {
-				tid := strconv.FormatUint(vt.TaskID, 10)
-				log.Printf("Failed to update redis, task id: %s: %v", tid, err)
-				// 存储失败视为临时问题，重入队（或根据需要改为不重试）
-				if del.Redelivered {
-					// 已经重试过，丢弃
-					_ = del.Nack(false, false)
-				} else {
-					_ = del.Nack(false, true)
-				}
-				return
-			}
-			if err := mysql.InsertV2TTask(&vt); err != nil {
-				tid := strconv.FormatUint(vt.TaskID, 10)
-				log.Printf("Failed to insert V2T task into MySQL, task id: %s: %v", tid, err)
-				// 存储失败视为临时问题，重入队（或根据需要改为不重试）
-				if del.Redelivered {
-					// 已经重试过，丢弃
-					_ = del.Nack(false, false)
-				} else {
-					_ = del.Nack(false, true)
-				}
-				return
-			}
-			// 成功存储到 Redis 之后，通过 SSE 通知前端（按 task_id topic 发布）
-			// 构造通知载荷（可根据前端约定调整字段）
-			payload := struct {
-				Code   int    `json:"code"`
-				UserID uint64 `json:"user_id"`
-				TaskID uint64 `json:"task_id"`
-				Status string `json:"status"`
-				Result string `json:"result,omitempty"`
-			}{
-				Code:   200,
-				UserID: vt.UserID,
-				TaskID: vt.TaskID,
-				Status: vt.Status,
-				Result: vt.Result,
-			}
-			if hub := sse.GetHub(); hub != nil {
-				if b, err := json.Marshal(payload); err == nil {
-					hub.PublishTopic(strconv.FormatUint(vt.UserID, 10), b)
-				}
-			}
-
-			// 成功处理后 ack
-			_ = del.Ack(false)
-		}(d)
+	if err := mysql.InsertV2TTask(&vt); err != nil {
+		return Requeue(fmt.Errorf("failed to insert V2T task into MySQL, task id: %s: %w", taskIDStr, err))
 	}
-
-	// 等待所有处理 goroutine 完成
-	wg.Wait()
+	// 成功存储之后，通过 SSE 通知前端（按 user_id topic 发布）
+	publishV2TResult(vt, 200, vt.Status, vt.Result)
 	return nil
 }
 
-func (q *amqpQueue) Close() error {
-	if q.ch != nil {
-		_ = q.ch.Close()
-	}
-	if q.conn != nil {
-		return q.conn.Close()
-	}
-	return nil
+// retryV2T 把等待重试的状态与失败历史写到任务上，前端查询结果时可以看到重试进度
+func retryV2T(ctx context.Context, job *Job[models.V2TTask], err error) {
+	vt := job.Payload
+	vt.Status = models.StatusRetrying
+	vt.Attempts = job.History
+	store.V2TTask(vt) // 忽略存储错误
 }
 
-const videoAnalysisText = `#角色你是一位专业且经验丰富的影视分镜师，专注于拆解生动的视觉画面。熟练掌握镜头语言、构图、色彩搭配和叙事节奏，擅长为影视制作、广告宣传、动画创作等提供清晰、专业的分镜脚本框架，确保视觉表现力与叙事逻辑兼具。#技能## 技能 1：理解视频内容并构思分镜
-理解视频内容：
-全面分析视频内容主题、情节结构和目标用户，确保分镜紧密贴合故事主题。
-构思镜头序列：
-根据内容，还原镜头顺序。
-## 技能 2：生成并优化分镜脚本
-生成初始分镜脚本：
-根据构思的镜头序列，按照以下格式输出分镜脚本：
-镜号、景别、画面内容、台词、运镜方式、音效、时长、图片生成提示词、视频生成提示词
-对格式的具体要求：
-镜号：为每个镜头分配唯一编号，方便管理与引用（分镜数量与原视频保持一致）。
-景别：清晰描述镜头距离（近景、中景、远景、特写等），展现主体与背景的关系。
-画面内容：详细明确描述场景、人物、动作、细节，助力视觉化创意。
-台词 / 旁白：添加角色台词、旁白或文字提示（如需）。
-运镜方式：说明镜头操作（推、拉、摇、移等），体现叙事流动性。
-时长：合理估算镜头持续时间（秒为单位），确保节奏流畅。
-备注：对镜头的情感表达、技术要求或特殊细节进行补充说明。
-图片生成提示词：镜号的首帧图片该如何用文字描述生成图片
-视频生成提示词：如何用镜号的首帧图片根据提示词生成对应的视频
-检查与优化：
-检查清晰度与可行性：确保分镜描述简洁清晰、易懂，完全适合拍摄或制作，严格符合影视制作规范。
-合理调整：优化镜头设计，充分考量制作成本与技术难度，避免复杂镜头影响实际执行。`
-
-func callVideoAnalysisAPI(url string) (string, error) {
-	//计算执行时间
-	starttime := time.Now()
-	defer func() {
-		elapsed := time.Since(starttime)
-		log.Printf("Video analysis API call took %s", elapsed)
-	}()
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, nil)
-	if err != nil {
-		return "", err
-	}
-
-	parts := []*genai.Part{
-		genai.NewPartFromText(videoAnalysisText),
-		genai.NewPartFromURI(url, "video/mp4"),
-	}
-
-	contents := []*genai.Content{
-		genai.NewContentFromParts(parts, genai.RoleUser),
-	}
-
-	result, err := client.Models.GenerateContent(
-		ctx,
-		"gemini-2.5-flash",
-		contents,
-		nil,
-	)
-	if err != nil {
-		return "", err
-	}
-	if result == nil {
-		return "", errors.New("genai: empty generate response")
-	}
-
-	// 打印生成的结果（可选）
-	// log.Printf("Generated video analysis result: %s", result.Text())
-	return result.Text(), nil
+// failV2T 任务最终失败时记录失败历史并通知前端：永久错误返回 400，重试耗尽返回 500
+func failV2T(ctx context.Context, job *Job[models.V2TTask], err error) {
+	vt := job.Payload
+	vt.Status = models.StatusFailed
+	vt.Attempts = job.History
+	store.V2TTask(vt) // 忽略存储错误
+	code := 500
+	if IsPermanent(err) {
+		code = 400
+	}
+	publishV2TResult(job.Payload, code, models.StatusFailed, err.Error())
 }
 
-func callVideoAnalysisAPIDoubao(url string) (string, error) {
-	//计算执行时间
-	starttime := time.Now()
-	defer func() {
-		elapsed := time.Since(starttime)
-		log.Printf("Video analysis API call took %s", elapsed)
-	}()
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, nil)
-	if err != nil {
-		return "", err
-	}
-
-	parts := []*genai.Part{
-		genai.NewPartFromText(videoAnalysisText),
-		genai.NewPartFromURI(url, "video/mp4"),
-	}
-
-	contents := []*genai.Content{
-		genai.NewContentFromParts(parts, genai.RoleUser),
+func publishV2TResult(vt models.V2TTask, code int, status, result string) {
+	payload := struct {
+		Code   int    `json:"code"`
+		UserID uint64 `json:"user_id"`
+		TaskID uint64 `json:"task_id"`
+		Status string `json:"status"`
+		Result string `json:"result,omitempty"`
+	}{
+		Code:   code,
+		UserID: vt.UserID,
+		TaskID: vt.TaskID,
+		Status: status,
+		Result: result,
+	}
+	if hub := sse.GetHub(); hub != nil {
+		if b, err := json.Marshal(payload); err == nil {
+			hub.PublishTopic(strconv.FormatUint(vt.UserID, 10), b)
+		}
 	}
+}
 
-	result, err := client.Models.GenerateContent(
-		ctx,
-		"gemini-2.5-flash",
-		contents,
-		nil,
-	)
-	if err != nil {
-		return "", err
-	}
-	if result == nil {
-		return "", errors.New("genai: empty generate response")
+// renderPrompt 按任务记录的模板版本渲染提示词；模板不存在或无法渲染时重试没有意义，标记为永久错误
+func renderPrompt(name string, ref *models.PromptRef, vars map[string]interface{}) (string, error) {
+	text, err := prompt.Render(name, ref, vars)
+	if errors.Is(err, mysql.ErrPromptTemplateNotFound) || errors.Is(err, prompt.ErrInvalidTemplate) {
+		return "", Permanent(err)
 	}
-
-	// 打印生成的结果（可选）
-	// log.Printf("Generated video analysis result: %s", result.Text())
-	return result.Text(), nil
+	return text, err
 }
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// consumerDrain 记录一个消费者的运行状态，用于优雅关闭：
+//   - 通过 consumer tag 取消订阅，让 RabbitMQ 停止向本进程推送新消息；
+//   - wg 统计消费循环与在途消息处理 goroutine，关闭时等待它们完成；
+//   - ctx 传给外部 API 调用与 FFmpeg 进程，排空超时后统一取消，避免遗留孤儿进程。
+type consumerDrain struct {
+	tag      string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	started  atomic.Bool
+	stopping atomic.Bool
+	// stop 在开始关闭时被关闭，让等待重连的消费循环立即退出
+	stop chan struct{}
+}
+
+func newConsumerDrain(name string) *consumerDrain {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &consumerDrain{
+		tag:    name + "-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+	}
+}
+
+// accept 在消费循环中判断是否继续处理该消息；关闭过程中收到的消息会被放回队列交给其他实例
+func (d *consumerDrain) accept(del amqp.Delivery) bool {
+	if d.stopping.Load() {
+		_ = del.Nack(false, true)
+		return false
+	}
+	return true
+}
+
+// shutdown 停止拉取新消息并等待在途消息处理完成；ctx 到期后取消所有在途工作并返回 ctx.Err()
+func (d *consumerDrain) shutdown(ctx context.Context, t transport) error {
+	if !d.stopping.CompareAndSwap(false, true) {
+		return nil
+	}
+	close(d.stop)
+	if d.started.Load() {
+		t.cancel(d.tag)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		// 排空超时：取消在途的 API 调用与 FFmpeg 进程，未 ack 的消息会在连接关闭后由 RabbitMQ 重新投递
+		d.cancel()
+		return ctx.Err()
+	}
+}
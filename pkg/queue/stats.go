@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"V2V/pkg/metrics"
+)
+
+// 消费者运行状态：每个 JobQueue 创建时登记，供 /metrics 与管理接口查看在途任务数与处理结果。
+
+// QueueStats 一个任务队列消费者的当前状态
+type QueueStats struct {
+	Name        string `json:"name"`
+	Queue       string `json:"queue"`
+	Concurrency int    `json:"concurrency"`
+	Prefetch    int    `json:"prefetch"`
+	// Consuming 本进程是否在消费该队列（api 角色只发布不消费）
+	Consuming bool  `json:"consuming"`
+	InFlight  int64 `json:"in_flight"`
+	Succeeded int64 `json:"succeeded"`
+	Retried   int64 `json:"retried"`
+	Failed    int64 `json:"failed"`
+	// Breakers 该队列依赖的外部服务；Paused 为这些服务全部熔断、消费暂停中
+	Breakers []string `json:"breakers,omitempty"`
+	Paused   bool     `json:"paused"`
+}
+
+// jobCounters 消费过程中累计的计数
+type jobCounters struct {
+	inFlight  atomic.Int64
+	succeeded atomic.Int64
+	retried   atomic.Int64
+	failed    atomic.Int64
+}
+
+type statsSource func() QueueStats
+
+var (
+	statsMu      sync.RWMutex
+	statsSources = make(map[string]statsSource)
+)
+
+func registerStats(name string, fn statsSource) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	statsSources[name] = fn
+}
+
+// Stats 返回本进程所有任务队列的状态（按名称排序）
+func Stats() []QueueStats {
+	statsMu.RLock()
+	list := make([]QueueStats, 0, len(statsSources))
+	for _, fn := range statsSources {
+		list = append(list, fn())
+	}
+	statsMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func init() {
+	gauge := func(value func(s QueueStats) float64) metrics.Collector {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, s := range Stats() {
+				if !s.Consuming {
+					continue
+				}
+				samples = append(samples, metrics.Sample{
+					Labels: map[string]string{"job": s.Name, "queue": s.Queue},
+					Value:  value(s),
+				})
+			}
+			return samples
+		}
+	}
+	metrics.RegisterGauge("v2v_queue_in_flight", "Messages currently being processed by this worker.",
+		gauge(func(s QueueStats) float64 { return float64(s.InFlight) }))
+	metrics.RegisterGauge("v2v_queue_concurrency", "Configured maximum number of messages processed concurrently.",
+		gauge(func(s QueueStats) float64 { return float64(s.Concurrency) }))
+	metrics.RegisterGauge("v2v_queue_prefetch", "Configured AMQP prefetch count (0 means unlimited).",
+		gauge(func(s QueueStats) float64 { return float64(s.Prefetch) }))
+	metrics.RegisterGauge("v2v_queue_paused", "1 while consumption is paused because the provider circuit breaker is open.",
+		gauge(func(s QueueStats) float64 {
+			if s.Paused {
+				return 1
+			}
+			return 0
+		}))
+	metrics.RegisterCounter("v2v_queue_succeeded_total", "Messages handled successfully.",
+		gauge(func(s QueueStats) float64 { return float64(s.Succeeded) }))
+	metrics.RegisterCounter("v2v_queue_retried_total", "Failed messages scheduled for retry.",
+		gauge(func(s QueueStats) float64 { return float64(s.Retried) }))
+	metrics.RegisterCounter("v2v_queue_failed_total", "Messages that failed permanently or exhausted retries.",
+		gauge(func(s QueueStats) float64 { return float64(s.Failed) }))
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"V2V/settings"
+
+	"github.com/go-redis/redis"
+)
+
+// 外部服务（Gemini / Ark）按账号限制 QPS 与并发，所有 worker 进程共享同一份 Redis 状态：
+//   - 令牌桶：ratelimit:{provider}:{model}:bucket，按 rate 每秒补充、最多 burst 个令牌；
+//   - 并发名额：ratelimit:{provider}:{model}:leases（sorted set，成员为租约 ID，分数为过期时间），
+//     进程崩溃未释放的租约在 lease_ttl 后自动失效。
+// 调用外部 API 前先 Acquire，调用结束后执行返回的 release。Redis 不可用时放行（只记录日志），
+// 限流失效好过全部任务失败。
+
+// 服务名
+const (
+	ProviderGemini = "gemini"
+	ProviderArk    = "ark"
+)
+
+// ErrWaitTimeout 在 wait_timeout 内没有拿到令牌或并发名额；调用方应视为临时错误按退避重试
+var ErrWaitTimeout = errors.New("rate limit wait timeout")
+
+var (
+	conf   settings.RateLimitConfig
+	client *redis.Client
+	leases atomic.Uint64
+)
+
+// Init 注入配置与 Redis 客户端；未调用或 enabled=false 时 Acquire 直接放行
+func Init(cfg settings.RateLimitConfig, c *redis.Client) {
+	conf = cfg
+	client = c
+}
+
+// tokenBucket 取一个令牌：成功返回 0，否则返回还需等待的毫秒数。
+// 使用 Redis 服务器时间，避免各 worker 时钟偏差（Redis 5 以下需要 replicate_commands 才能在 TIME 之后写入）
+var tokenBucket = redis.NewScript(`
+redis.replicate_commands()
+local key = KEYS[1]
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', key, 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', key, math.ceil(burst / rate) + 1000)
+return wait
+`)
+
+// acquireLease 清理过期租约后尝试占用一个并发名额，成功返回 1
+var acquireLease = redis.NewScript(`
+redis.replicate_commands()
+local key = KEYS[1]
+local max = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+local id = ARGV[3]
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+if redis.call('ZCARD', key) >= max then
+	return 0
+end
+redis.call('ZADD', key, now + ttl, id)
+redis.call('PEXPIRE', key, ttl)
+return 1
+`)
+
+// 并发名额已满时的轮询间隔（叠加随机抖动，避免各 worker 同时重试）
+const leasePollInterval = 250 * time.Millisecond
+
+// Acquire 等待 provider/model 的令牌（以及配置了 max_concurrent 时的并发名额）。
+// 返回的 release 必须在外部调用结束后执行（没有占用名额时为空操作）。
+func Acquire(ctx context.Context, provider, model string) (release func(), err error) {
+	release = func() {}
+	limit, ok := lookup(provider, model)
+	if !ok || client == nil {
+		return release, nil
+	}
+	if conf.WaitTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.WaitTimeout.Duration)
+		defer cancel()
+	}
+	prefix := "ratelimit:" + provider + ":" + model
+	if limit.MaxConcurrent > 0 {
+		if release, err = waitLease(ctx, prefix+":leases", limit); err != nil {
+			return func() {}, waitError(err, provider, model)
+		}
+	}
+	if limit.Rate > 0 {
+		if err := waitToken(ctx, prefix+":bucket", limit); err != nil {
+			release()
+			return func() {}, waitError(err, provider, model)
+		}
+	}
+	return release, nil
+}
+
+// lookup 先找 provider/model 的配置，再找 provider 的配置
+func lookup(provider, model string) (settings.LimitConfig, bool) {
+	if !conf.Enabled {
+		return settings.LimitConfig{}, false
+	}
+	if l, ok := conf.Limits[provider+"/"+model]; ok {
+		return l, true
+	}
+	l, ok := conf.Limits[provider]
+	return l, ok
+}
+
+func waitToken(ctx context.Context, key string, limit settings.LimitConfig) error {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	for {
+		wait, err := tokenBucket.Run(client.WithContext(ctx), []string{key}, limit.Rate, burst).Int64()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("ratelimit: token bucket %s unavailable, allowing call: %v", key, err)
+			return nil
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, time.Duration(wait)*time.Millisecond); err != nil {
+			return err
+		}
+	}
+}
+
+func waitLease(ctx context.Context, key string, limit settings.LimitConfig) (func(), error) {
+	ttl := limit.LeaseTTL.Duration
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(leases.Add(1), 36)
+	for {
+		ok, err := acquireLease.Run(client.WithContext(ctx), []string{key}, limit.MaxConcurrent, ttl.Milliseconds(), id).Int64()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("ratelimit: concurrency lease %s unavailable, allowing call: %v", key, err)
+			return func() {}, nil
+		}
+		if ok == 1 {
+			return func() {
+				if err := client.ZRem(key, id).Err(); err != nil {
+					log.Printf("ratelimit: failed to release lease %s on %s: %v", id, key, err)
+				}
+			}, nil
+		}
+		jitter := time.Duration(rand.Int64N(int64(leasePollInterval)))
+		if err := sleep(ctx, leasePollInterval+jitter); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// waitError 等待超时转换为 ErrWaitTimeout；进程关闭导致的取消原样返回
+func waitError(err error, provider, model string) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s/%s: %w", provider, model, ErrWaitTimeout)
+	}
+	return err
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// reconnectDelayMillis 服务关闭时建议客户端等待多久后重连
+const reconnectDelayMillis = 3000
+
 // ServeSSE 处理 SSE（Server-Sent Events）连接
 // @Summary 订阅服务器事件流（SSE）
 // @Description 建立 SSE 长连接以接收服务端推送的事件。需要通过查询参数 `userid` 指定订阅的主题/用户 ID，例如 `/events?userid=12345`。会在V2T，T2I任务结束后推送消息。
@@ -59,6 +62,11 @@ func ServeSSE(c *gin.Context) {
 		select {
 		case <-notify:
 			return
+		case <-h.Done():
+			// 服务即将关闭：告诉客户端稍后重连（EventSource 会按 retry 指定的毫秒数自动重连到其他实例）
+			fmt.Fprintf(c.Writer, "retry: %d\nevent: reconnect\ndata: {}\n\n", reconnectDelayMillis)
+			flusher.Flush()
+			return
 		case msg := <-msgCh:
 			// 将消息以 SSE 格式发送（data: <payload>\n\n）
 			fmt.Fprintf(c.Writer, "data: %s\n\n", string(msg))
@@ -1,7 +1,11 @@
 package sse
 
 import (
+	"context"
+	"errors"
 	"sync"
+
+	"github.com/go-redis/redis"
 )
 
 // Hub 管理基于 topic 的 SSE 订阅者。
@@ -20,6 +24,16 @@ type Hub struct {
 	unsubscribe chan subscription
 	publish     chan topicMessage
 
+	// ping 用于健康检查：Run 循环收到后关闭回复通道，证明事件循环仍在运行
+	ping chan chan struct{}
+
+	// quit 在 Shutdown 时关闭，通知 Run 循环退出、所有 SSE 连接让客户端重连
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	// relay 非空时事件经 Redis 转发（见 relay.go），用于 API / worker 分进程部署
+	relay *redis.Client
+
 	mu sync.Mutex
 }
 
@@ -44,6 +58,8 @@ func NewHub() *Hub {
 		subscribe:   make(chan subscription),
 		unsubscribe: make(chan subscription),
 		publish:     make(chan topicMessage, 100),
+		ping:        make(chan chan struct{}),
+		quit:        make(chan struct{}),
 	}
 }
 
@@ -68,6 +84,10 @@ func GetHub() *Hub {
 func (h *Hub) Run() {
 	for {
 		select {
+		case <-h.quit:
+			return
+		case reply := <-h.ping:
+			close(reply)
 		case s := <-h.subscribe:
 			h.mu.Lock()
 			subs, ok := h.topics[s.topic]
@@ -105,8 +125,22 @@ func (h *Hub) Run() {
 // PublishTopic 将消息发布到指定 topic 的所有订阅者。
 //
 // 说明：该调用会把消息写入 hub 的 publish 缓冲通道，由 Run 循环负责把消息分发到订阅者。
+// 启用 relay 时消息写入 Redis，由订阅了频道的 API 进程投递；
+// Hub 关闭后发布的消息会被直接丢弃，避免发布者阻塞。
 func (h *Hub) PublishTopic(topic string, msg []byte) {
-	h.publish <- topicMessage{topic: topic, msg: msg}
+	if h.relay != nil {
+		h.publishRelay(topic, msg)
+		return
+	}
+	h.publishLocal(topic, msg)
+}
+
+// publishLocal 把消息交给本进程的 Run 循环分发
+func (h *Hub) publishLocal(topic string, msg []byte) {
+	select {
+	case h.publish <- topicMessage{topic: topic, msg: msg}:
+	case <-h.quit:
+	}
 }
 
 // Subscribe 将指定通道注册为 topic 的订阅者。
@@ -114,10 +148,46 @@ func (h *Hub) PublishTopic(topic string, msg []byte) {
 // 使用约定：调用方应提供一个有缓冲的 channel（例如缓冲 16），并且在不再需要时负责取消订阅
 // 并关闭通道。Hub 不会关闭订阅者提供的通道。
 func (h *Hub) Subscribe(ch chan []byte, topic string) {
-	h.subscribe <- subscription{ch: ch, topic: topic}
+	select {
+	case h.subscribe <- subscription{ch: ch, topic: topic}:
+	case <-h.quit:
+	}
 }
 
 // Unsubscribe 取消某个通道对 topic 的订阅。
 func (h *Hub) Unsubscribe(ch chan []byte, topic string) {
-	h.unsubscribe <- subscription{ch: ch, topic: topic}
+	select {
+	case h.unsubscribe <- subscription{ch: ch, topic: topic}:
+	case <-h.quit:
+	}
+}
+
+// Shutdown 停止 Hub：Run 循环退出，所有 ServeSSE 连接会向客户端发送重连指令后结束。
+//
+// 在进程优雅关闭时应先调用 Shutdown 再关闭 http.Server，否则长连接会一直阻塞 Server.Shutdown。
+func (h *Hub) Shutdown() {
+	h.quitOnce.Do(func() { close(h.quit) })
+}
+
+// Ping 检查 Run 循环是否仍在处理事件（用于存活探针）
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-h.quit:
+		return errors.New("sse hub stopped")
+	case <-ctx.Done():
+		return errors.New("sse hub event loop not responding")
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return errors.New("sse hub event loop not responding")
+	}
+}
+
+// Done 返回一个在 Hub 关闭后被关闭的通道
+func (h *Hub) Done() <-chan struct{} {
+	return h.quit
 }
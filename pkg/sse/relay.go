@@ -0,0 +1,62 @@
+package sse
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/go-redis/redis"
+)
+
+// relayChannel 跨进程转发 SSE 事件使用的 Redis Pub/Sub 频道
+const relayChannel = "v2v:sse:events"
+
+// relayMessage Redis 中传输的事件格式
+type relayMessage struct {
+	Topic string `json:"topic"`
+	Msg   []byte `json:"msg"`
+}
+
+// EnableRelay 让 PublishTopic 通过 Redis 发布事件，而不是直接投递给本进程的订阅者。
+//
+// API 与 worker 拆分部署后，消费者运行在 worker 进程，SSE 连接却在 API 进程上；
+// worker 只需 EnableRelay，API 进程再调用 RunRelay 订阅频道，把事件转交给本地 Hub。
+func (h *Hub) EnableRelay(client *redis.Client) {
+	h.relay = client
+}
+
+// RunRelay 订阅 Redis 频道并把收到的事件投递给本进程的订阅者，Hub 关闭后返回。
+//
+// 该方法应在单独的 goroutine 中运行，并且 Hub 的 Run 循环也需要在运行。
+func (h *Hub) RunRelay(client *redis.Client) {
+	pubsub := client.Subscribe(relayChannel)
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-h.quit:
+			return
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			var rm relayMessage
+			if err := json.Unmarshal([]byte(m.Payload), &rm); err != nil {
+				log.Printf("sse relay: invalid message: %v", err)
+				continue
+			}
+			h.publishLocal(rm.Topic, rm.Msg)
+		}
+	}
+}
+
+// publishRelay 把事件写入 Redis 频道
+func (h *Hub) publishRelay(topic string, msg []byte) {
+	b, err := json.Marshal(relayMessage{Topic: topic, Msg: msg})
+	if err != nil {
+		log.Printf("sse relay: marshal failed: %v", err)
+		return
+	}
+	if err := h.relay.Publish(relayChannel, b).Err(); err != nil {
+		log.Printf("sse relay: publish to topic %s failed: %v", topic, err)
+	}
+}
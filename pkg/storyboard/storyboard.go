@@ -0,0 +1,332 @@
+package storyboard
+
+import (
+	"V2V/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 分镜脚本的结构化：V2T 要求模型按 Schema 输出 JSON，解析失败时退回解析 Markdown 分镜表
+// （模型不支持 JSON Schema、或使用了自定义的分镜分析模板时）。解析结果统一校验后按镜号排序，
+// 再渲染成 Markdown 表格作为任务的 result，供前端展示与后续阶段使用。
+
+// ErrNoShots 输出中没有找到分镜
+var ErrNoShots = errors.New("storyboard: no shots found")
+
+// column 分镜的一个字段：JSON 字段名、Markdown 表头与识别表头用的关键词
+type column struct {
+	field       string
+	title       string
+	keywords    []string
+	kind        string
+	description string
+}
+
+// columns 的顺序即 Markdown 表格的列顺序；识别表头时按顺序取第一个匹配的字段
+var columns = []column{
+	{"shot_no", "镜号", []string{"镜号", "镜头号", "序号"}, "integer", "镜号，从 1 开始连续编号，与原视频的镜头顺序一致"},
+	{"framing", "景别", []string{"景别"}, "string", "景别：远景、全景、中景、近景、特写等"},
+	{"content", "画面内容", []string{"画面内容", "画面描述", "画面"}, "string", "画面内容：场景、人物、动作与细节"},
+	{"dialogue", "台词 / 旁白", []string{"台词", "旁白"}, "string", "台词、旁白或文字提示，没有时为空字符串"},
+	{"camera_move", "运镜方式", []string{"运镜", "镜头运动"}, "string", "运镜方式：推、拉、摇、移、跟、固定等"},
+	{"sound", "音效", []string{"音效", "音乐", "声音"}, "string", "音效与配乐"},
+	{"duration", "时长", []string{"时长"}, "number", "镜头时长（秒）"},
+	{"image_prompt", "图片生成提示词", []string{"图片生成提示词", "图片提示词", "图像生成提示词", "首帧"}, "string", "用于生成该镜头首帧图片的提示词"},
+	{"video_prompt", "视频生成提示词", []string{"视频生成提示词", "视频提示词"}, "string", "用该镜头首帧图片生成视频的提示词"},
+}
+
+// Schema 分镜脚本的 JSON Schema（Gemini responseJsonSchema / 方舟 response_format.json_schema）
+func Schema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := make([]string, 0, len(columns))
+	for _, c := range columns {
+		properties[c.field] = map[string]interface{}{"type": c.kind, "description": c.description}
+		required = append(required, c.field)
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"shots": map[string]interface{}{
+				"type":        "array",
+				"description": "按镜号顺序排列的全部镜头",
+				"minItems":    1,
+				"items": map[string]interface{}{
+					"type":                 "object",
+					"properties":           properties,
+					"required":             required,
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"shots"},
+		"additionalProperties": false,
+	}
+}
+
+// Parse 解析模型输出的分镜脚本：先按 JSON 解析，失败时按 Markdown 分镜表解析，返回分镜与来源格式
+func Parse(text string) ([]models.Shot, string, error) {
+	shots, jsonErr := ParseJSON(text)
+	if jsonErr == nil {
+		return shots, models.StoryboardJSON, nil
+	}
+	shots, mdErr := ParseMarkdown(text)
+	if mdErr == nil {
+		return shots, models.StoryboardMarkdown, nil
+	}
+	return nil, "", fmt.Errorf("not a JSON storyboard (%v) nor a markdown table (%v)", jsonErr, mdErr)
+}
+
+// ParseJSON 解析 {"shots": [...]}（也接受直接输出的数组与 ```json 代码块）并校验
+func ParseJSON(text string) ([]models.Shot, error) {
+	text = stripCodeFence(strings.TrimSpace(text))
+	var shots []models.Shot
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &shots); err != nil {
+			return nil, err
+		}
+	} else {
+		var out struct {
+			Shots []models.Shot `json:"shots"`
+		}
+		if err := json.Unmarshal([]byte(text), &out); err != nil {
+			return nil, err
+		}
+		shots = out.Shots
+	}
+	return normalize(shots)
+}
+
+func stripCodeFence(text string) string {
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+// ParseMarkdown 解析 Markdown 分镜表：按表头关键词识别列（列顺序与多余的列不影响），
+// 表头需要包含镜号；输出被拆成多个表格时合并
+func ParseMarkdown(text string) ([]models.Shot, error) {
+	var shots []models.Shot
+	var header []string // 当前表格每一列对应的字段，未识别的列为空
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			header = nil
+			continue
+		}
+		cells := splitRow(line)
+		if isSeparator(cells) {
+			continue
+		}
+		if fields, ok := parseHeader(cells); ok {
+			header = fields
+			continue
+		}
+		if header == nil {
+			continue
+		}
+		var shot models.Shot
+		for i, cell := range cells {
+			if i < len(header) && header[i] != "" {
+				set(&shot, header[i], cell)
+			}
+		}
+		shots = append(shots, shot)
+	}
+	return normalize(shots)
+}
+
+// splitRow 拆分表格行，支持 \| 转义
+func splitRow(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	var cells []string
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			b.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, cleanCell(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(line[i])
+		}
+	}
+	return append(cells, cleanCell(b.String()))
+}
+
+var breakTag = regexp.MustCompile(`(?i)<br\s*/?>`)
+
+func cleanCell(s string) string {
+	s = breakTag.ReplaceAllString(s, "\n")
+	s = strings.ReplaceAll(s, "**", "")
+	return strings.TrimSpace(s)
+}
+
+func isSeparator(cells []string) bool {
+	for _, c := range cells {
+		if strings.Trim(c, ":- ") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeader 识别表头行：至少有一列是镜号
+func parseHeader(cells []string) ([]string, bool) {
+	fields := make([]string, len(cells))
+	hasShotNo := false
+	for i, cell := range cells {
+	match:
+		for _, c := range columns {
+			for _, k := range c.keywords {
+				if strings.Contains(cell, k) {
+					fields[i] = c.field
+					hasShotNo = hasShotNo || c.field == "shot_no"
+					break match
+				}
+			}
+		}
+	}
+	return fields, hasShotNo
+}
+
+var (
+	integerPattern = regexp.MustCompile(`\d+`)
+	numberPattern  = regexp.MustCompile(`\d+(\.\d+)?`)
+)
+
+func set(shot *models.Shot, field, value string) {
+	switch field {
+	case "shot_no":
+		shot.ShotNo, _ = strconv.Atoi(integerPattern.FindString(value))
+	case "framing":
+		shot.Framing = value
+	case "content":
+		shot.Content = value
+	case "dialogue":
+		shot.Dialogue = value
+	case "camera_move":
+		shot.CameraMove = value
+	case "sound":
+		shot.Sound = value
+	case "duration":
+		// 如 "3秒"、"2.5s"、"3-4秒"（取第一个数）
+		shot.Duration, _ = strconv.ParseFloat(numberPattern.FindString(value), 64)
+	case "image_prompt":
+		shot.ImagePrompt = value
+	case "video_prompt":
+		shot.VideoPrompt = value
+	}
+}
+
+// normalize 去掉字段首尾空白、按镜号排序后校验
+func normalize(shots []models.Shot) ([]models.Shot, error) {
+	for i := range shots {
+		s := &shots[i]
+		for _, f := range []*string{&s.Framing, &s.Content, &s.Dialogue, &s.CameraMove, &s.Sound, &s.ImagePrompt, &s.VideoPrompt} {
+			*f = strings.TrimSpace(*f)
+		}
+	}
+	sort.SliceStable(shots, func(i, j int) bool { return shots[i].ShotNo < shots[j].ShotNo })
+	if err := Validate(shots); err != nil {
+		return nil, err
+	}
+	return shots, nil
+}
+
+// Validate 校验分镜：至少一个镜头，镜号为正且不重复，时长不为负，每个镜头都有画面内容或图片提示词
+func Validate(shots []models.Shot) error {
+	if len(shots) == 0 {
+		return ErrNoShots
+	}
+	seen := make(map[int]bool, len(shots))
+	for i, s := range shots {
+		if s.ShotNo <= 0 {
+			return fmt.Errorf("storyboard: shot %d has no valid shot_no", i+1)
+		}
+		if seen[s.ShotNo] {
+			return fmt.Errorf("storyboard: duplicate shot_no %d", s.ShotNo)
+		}
+		seen[s.ShotNo] = true
+		if s.Duration < 0 {
+			return fmt.Errorf("storyboard: shot %d has negative duration", s.ShotNo)
+		}
+		if s.Content == "" && s.ImagePrompt == "" {
+			return fmt.Errorf("storyboard: shot %d has neither content nor image_prompt", s.ShotNo)
+		}
+	}
+	return nil
+}
+
+// Markdown 把分镜渲染为 Markdown 表格（列与 ParseMarkdown 识别的表头一致，可以再解析回来）
+func Markdown(shots []models.Shot) string {
+	var b strings.Builder
+	row := func(cells []string) {
+		b.WriteString("|")
+		for _, c := range cells {
+			c = strings.ReplaceAll(c, "|", `\|`)
+			c = strings.ReplaceAll(c, "\n", "<br>")
+			b.WriteString(" " + c + " |")
+		}
+		b.WriteString("\n")
+	}
+	titles := make([]string, len(columns))
+	separators := make([]string, len(columns))
+	for i, c := range columns {
+		titles[i], separators[i] = c.title, "---"
+	}
+	row(titles)
+	row(separators)
+	for _, s := range shots {
+		row([]string{
+			strconv.Itoa(s.ShotNo), s.Framing, s.Content, s.Dialogue, s.CameraMove, s.Sound,
+			strconv.FormatFloat(s.Duration, 'f', -1, 64), s.ImagePrompt, s.VideoPrompt,
+		})
+	}
+	return b.String()
+}
+
+// ErrShotMapping 参考图与分镜无法对应
+var ErrShotMapping = errors.New("invalid image to shot mapping")
+
+// MapImages 确定每张参考图（按 T2I 结果的顺序）对应的分镜。shotNos 为空时按顺序一一对应，图片数必须与分镜数一致；
+// 否则 shotNos[i] 为第 i+1 张图片的镜号，长度必须与图片数一致，镜号必须在分镜中且不重复
+func MapImages(images int, shots []models.Shot, shotNos []int) ([]models.Shot, error) {
+	if len(shotNos) == 0 {
+		if images != len(shots) {
+			return nil, fmt.Errorf("%w: %d images but %d storyboard shots, specify shot_numbers", ErrShotMapping, images, len(shots))
+		}
+		return append([]models.Shot(nil), shots...), nil
+	}
+	if len(shotNos) != images {
+		return nil, fmt.Errorf("%w: %d shot_numbers for %d images", ErrShotMapping, len(shotNos), images)
+	}
+	byNo := make(map[int]models.Shot, len(shots))
+	for _, s := range shots {
+		byNo[s.ShotNo] = s
+	}
+	used := make(map[int]bool, len(shotNos))
+	out := make([]models.Shot, 0, images)
+	for i, no := range shotNos {
+		s, ok := byNo[no]
+		if !ok {
+			return nil, fmt.Errorf("%w: image %d is mapped to shot %d which is not in the storyboard", ErrShotMapping, i+1, no)
+		}
+		if used[no] {
+			return nil, fmt.Errorf("%w: shot %d is mapped to more than one image", ErrShotMapping, no)
+		}
+		used[no] = true
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,140 @@
+package upload
+
+import (
+	"V2V/models"
+	"V2V/settings"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// V2T 直接上传视频的校验与存储。文件保存在 upload.dir 下，以任务 ID 命名，
+// 不对外公开：上传者通过需要登录的 /api/v1/V2T/<task_id>/video 读取，worker 按本地路径读取后交给视频分析服务。
+
+var (
+	// ErrTooLarge 文件超过 upload.max_size_mb
+	ErrTooLarge = errors.New("video file too large")
+	// ErrUnsupportedType 文件类型不在 upload.allowed_types 中
+	ErrUnsupportedType = errors.New("unsupported video type")
+)
+
+var conf settings.UploadConfig
+
+// Init 注入上传配置并创建存储目录
+func Init(cfg settings.UploadConfig) error {
+	conf = cfg
+	return os.MkdirAll(cfg.Dir, 0755)
+}
+
+// MaxBytes 单个视频的大小上限（字节）
+func MaxBytes() int64 {
+	return conf.MaxSizeMB << 20
+}
+
+// videoExts 内容嗅探识别不出的视频（如 QuickTime）按扩展名识别；保存时也按类型选择扩展名（取第一个）
+var videoExts = []struct{ ext, mime string }{
+	{".mp4", "video/mp4"},
+	{".m4v", "video/mp4"},
+	{".mov", "video/quicktime"},
+	{".webm", "video/webm"},
+	{".avi", "video/avi"},
+	{".mkv", "video/x-matroska"},
+}
+
+// SaveVideo 校验上传的视频（大小、类型）并保存为 <name><扩展名>，返回保存结果（访问路径 URL 由调用方填写）
+func SaveVideo(fh *multipart.FileHeader, name string) (*models.VideoFile, error) {
+	if fh.Size > MaxBytes() {
+		return nil, ErrTooLarge
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	contentType, err := detectType(src, fh.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed(contentType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	filename := name + extFor(contentType, fh.Filename)
+	path := filepath.Join(conf.Dir, filename)
+	dst, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建文件失败: %v", err)
+	}
+	// 多读一个字节，超出上限时视为过大（multipart 头里的大小不可信）
+	n, err := io.Copy(dst, io.LimitReader(src, MaxBytes()+1))
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > MaxBytes() {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return &models.VideoFile{
+		Path:        path,
+		Filename:    filepath.Base(fh.Filename),
+		ContentType: contentType,
+		Size:        n,
+	}, nil
+}
+
+// detectType 按文件头识别类型，识别不出时按扩展名
+func detectType(r io.Reader, filename string) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if contentType != "application/octet-stream" {
+		return contentType, nil
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, v := range videoExts {
+		if v.ext == ext {
+			return v.mime, nil
+		}
+	}
+	return contentType, nil
+}
+
+func allowed(contentType string) bool {
+	for _, t := range conf.AllowedTypes {
+		if strings.EqualFold(t, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// extFor 优先沿用原文件名中与类型一致的扩展名
+func extFor(contentType, filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, v := range videoExts {
+		if v.ext == ext && v.mime == contentType {
+			return ext
+		}
+	}
+	for _, v := range videoExts {
+		if v.mime == contentType {
+			return v.ext
+		}
+	}
+	return ext
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"V2V/controller"
+	"V2V/dao/store"
+	"V2V/middlewares"
+	"V2V/pkg/health"
+	"V2V/pkg/queue"
+	"V2V/pkg/snowflake"
+	sse "V2V/pkg/sse"
+	"V2V/settings"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	_ "net/http/pprof"
+	"time"
+
+	_ "V2V/docs"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// startServe 初始化 API 角色所需的依赖（队列仅用于发布任务）并启动 HTTP 服务
+func startServe(a *app) error {
+	cfg := a.cfg
+
+	//初始化雪花算法
+	if err := snowflake.Init(cfg.MachineID); err != nil {
+		return fmt.Errorf("init snowflake: %v", err)
+	}
+
+	// API 进程只发布任务，不启动消费者
+	dsn := cfg.RabbitMQ.DSN
+	if err := queue.InitRabbitMQ(dsn); err != nil {
+		return fmt.Errorf("init V2T RabbitMQ: %v", err)
+	}
+	rabbitMQ, _ := queue.GetRabbitMQ()
+	a.addQueue(queueV2T, rabbitMQ)
+
+	if err := queue.InitT2IRabbitMQ(dsn); err != nil {
+		return fmt.Errorf("init T2I RabbitMQ: %v", err)
+	}
+	t2iRabbitMQ, _ := queue.GetT2IRabbitMQ()
+	a.addQueue(queueT2I, t2iRabbitMQ)
+
+	if err := queue.InitI2VRabbitMQ(dsn); err != nil {
+		return fmt.Errorf("init I2V RabbitMQ: %v", err)
+	}
+	i2vRabbitMQ, _ := queue.GetI2VRabbitMQ()
+	a.addQueue(queueI2V, i2vRabbitMQ)
+
+	// SSE hub 在本进程分发事件，事件来源是 Redis 频道（worker 进程发布）
+	go a.hub.Run()
+	go a.hub.RunRelay(store.GetRedis())
+	health.RegisterLiveness("sse_hub", a.hub.Ping)
+
+	a.srv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: newRouter(cfg),
+	}
+	go func() {
+		if err := a.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			a.fatal(fmt.Errorf("listen failed: %v", err))
+		}
+	}()
+	return nil
+}
+
+// newRouter 注册所有 HTTP 路由
+func newRouter(cfg *settings.AppConfig) *gin.Engine {
+	if cfg.Mode == "release" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.Default()
+
+	//CORS 配置：如果配置了 cors_allowed_origins（或环境变量 CORS_ALLOWED_ORIGINS，逗号分隔），则使用白名单；否则使用宽松的默认策略（方便开发）
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		r.Use(cors.New(cors.Config{
+			AllowOrigins:     []string{"*"}, // 开发环境允许所有来源
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+			AllowHeaders:     []string{"*"}, // 允许所有头，包括 Authorization
+			ExposeHeaders:    []string{"Content-Length", "Content-Range", "Authorization"},
+			AllowCredentials: false, // 当 AllowOrigins 为 * 时，此项必须为 false
+			MaxAge:           12 * time.Hour,
+		}))
+	} else {
+		r.Use(cors.New(cors.Config{
+			AllowOrigins:     cfg.CORSAllowedOrigins,
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+			ExposeHeaders:    []string{"Content-Length", "Content-Range"},
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		}))
+	}
+
+	registerPprof(r)
+	registerHealth(r)
+	r.GET("/events", sse.ServeSSE)
+
+	// 静态视频目录（返回 /videos/<taskid>.mp4）
+	r.Static("/videos", "./public/videos")
+	r.Static("/pic", "./public/pic")
+
+	// 公开路由（无需登录）
+
+	// Swagger 文档路由
+	//  /home/xc/go/lib/bin/swag init -g main.go -o ./docs
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// 运维管理接口（需要 X-Admin-Token）
+	admin := r.Group("/admin", middlewares.AdminAuthMiddleware(cfg.Admin.Token))
+	{
+		admin.GET("/queues", controller.ListQueueStats)
+		admin.GET("/breakers", controller.ListBreakers)
+		admin.GET("/dlq", controller.ListDeadLetterQueues)
+		admin.GET("/dlq/:queue", controller.ListDeadLetters)
+		admin.POST("/dlq/:queue/replay", controller.ReplayDeadLetters)
+		admin.POST("/dlq/:queue/purge", controller.PurgeDeadLetters)
+		admin.GET("/prompts", controller.AdminListPromptTemplates)
+		admin.POST("/prompts", controller.AdminCreatePromptTemplate)
+		admin.POST("/prompts/:id/activate", controller.AdminActivatePromptTemplate)
+	}
+
+	// 受保护的 API（需要 JWT）
+	v1 := r.Group("/api/v1")
+	v1.POST("/login", controller.LoginHandler)               // 登陆业务
+	v1.POST("/signup", controller.SignUpHandler)             // 注册业务
+	v1.GET("/refresh_token", controller.RefreshTokenHandler) // 刷新accessToken
+	v1.Use(middlewares.JWTAuthMiddleware())
+	{
+		v1.POST("/V2T", controller.SubmitV2TTask)
+		v1.POST("/V2T/LoraText", controller.LoraText)
+		v1.POST("/T2I", controller.SubmitT2ITask)
+		v1.GET("/V2T/:task_id", controller.GetV2TTaskResult)
+		v1.GET("/V2T/:task_id/video", controller.GetV2TVideo)
+		v1.POST("/I2V", controller.SubmitI2VTask)
+		v1.GET("/I2V/:task_id", controller.GetI2VTaskResult)
+		v1.POST("/I2VCallback/:task_id", controller.I2VCallback)
+		v1.GET("/FFmpeg/:task_id", controller.FFmpegHandler)
+
+		// 用户信息和任务历史
+		v1.GET("/user/info", controller.GetUserInfo)
+
+		// Token 相关接口
+		v1.GET("/token/info/:user_id", controller.GetUserTokenInfo)
+
+		// 提示词模板（个人版本）
+		v1.GET("/prompts", controller.ListPromptTemplates)
+		v1.POST("/prompts", controller.CreatePromptTemplate)
+		v1.POST("/prompts/:id/activate", controller.ActivatePromptTemplate)
+	}
+	return r
+}
+
+// registerHealth 注册存活 / 就绪探针与 Prometheus 指标（无需登录）
+func registerHealth(router *gin.Engine) {
+	router.GET("/healthz", controller.HealthzHandler)
+	router.GET("/readyz", controller.ReadyzHandler)
+	router.GET("/metrics", controller.MetricsHandler)
+}
+
+// startHealthServer worker 角色没有 API 端口，单独启动一个只包含探针与指标的 HTTP 服务
+func startHealthServer(a *app) {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	registerHealth(r)
+	a.healthSrv = &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.cfg.HealthPort),
+		Handler: r,
+	}
+	go func() {
+		if err := a.healthSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			a.fatal(fmt.Errorf("health listen failed: %v", err))
+		}
+	}()
+}
+
+func registerPprof(router *gin.Engine) {
+	// pprof 路由组
+	pprofGroup := router.Group("/debug/pprof")
+	{
+		pprofGroup.GET("/", pprofHandler(pprof.Index))
+		pprofGroup.GET("/cmdline", pprofHandler(pprof.Cmdline))
+		pprofGroup.GET("/profile", pprofHandler(pprof.Profile))
+		pprofGroup.POST("/symbol", pprofHandler(pprof.Symbol))
+		pprofGroup.GET("/symbol", pprofHandler(pprof.Symbol))
+		pprofGroup.GET("/trace", pprofHandler(pprof.Trace))
+		pprofGroup.GET("/allocs", pprofHandler(pprof.Handler("allocs").ServeHTTP))
+		pprofGroup.GET("/block", pprofHandler(pprof.Handler("block").ServeHTTP))
+		pprofGroup.GET("/goroutine", pprofHandler(pprof.Handler("goroutine").ServeHTTP))
+		pprofGroup.GET("/heap", pprofHandler(pprof.Handler("heap").ServeHTTP))
+		pprofGroup.GET("/mutex", pprofHandler(pprof.Handler("mutex").ServeHTTP))
+		pprofGroup.GET("/threadcreate", pprofHandler(pprof.Handler("threadcreate").ServeHTTP))
+	}
+}
+
+// pprofHandler 将 http.HandlerFunc 转换为 gin.HandlerFunc
+func pprofHandler(handler http.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
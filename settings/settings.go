@@ -0,0 +1,680 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Conf 全局配置，由 Init 从配置文件加载并经过环境变量覆盖与校验
+var Conf = new(AppConfig)
+
+// AppConfig 应用整体配置
+//
+// 加载顺序：配置文件 -> 环境变量覆盖（字段上的 env tag）-> Validate 校验。
+// 这样 staging 与 prod 可以使用同一个二进制，只需替换配置文件或注入环境变量。
+type AppConfig struct {
+	Name string `yaml:"name"`
+	Mode string `yaml:"mode" env:"V2V_MODE"`
+	Port int    `yaml:"port" env:"V2V_PORT"`
+	// HealthPort 仅 worker 角色使用：单独暴露 /healthz 与 /readyz（serve/all 角色挂在主端口上）
+	HealthPort         int      `yaml:"health_port" env:"V2V_HEALTH_PORT"`
+	MachineID          uint16   `yaml:"machine_id" env:"V2V_MACHINE_ID"`
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	// ShutdownTimeout 收到 SIGTERM 后等待 HTTP 请求、队列消费与渲染排空的最长时间
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" env:"V2V_SHUTDOWN_TIMEOUT"`
+
+	Auth  AuthConfig  `yaml:"auth"`
+	Admin AdminConfig `yaml:"admin"`
+	MySQL MySQLConfig `yaml:"mysql"`
+	Redis RedisConfig `yaml:"redis"`
+	Queue QueueConfig `yaml:"queue"`
+	// RateLimit 外部服务调用限流（所有 worker 共享 Redis 中的令牌桶）
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// CircuitBreaker 外部服务熔断（每个 worker 进程独立统计）
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	RabbitMQ       RabbitMQConfig       `yaml:"rabbitmq"`
+	// Upload V2T 直接上传视频的存储与限制
+	Upload UploadConfig `yaml:"upload"`
+	// VideoAnalysis V2T 视频分析服务的选择与故障切换
+	VideoAnalysis VideoAnalysisConfig `yaml:"video_analysis"`
+	// ImageGeneration T2I 生图服务的选择
+	ImageGeneration ImageGenerationConfig `yaml:"image_generation"`
+	// VideoGeneration I2V 图生视频服务的选择
+	VideoGeneration VideoGenerationConfig `yaml:"video_generation"`
+	// Generation T2I / I2V 生成参数的默认值与按 VIP 等级的允许范围
+	Generation GenerationConfig `yaml:"generation"`
+	Gemini     GeminiConfig     `yaml:"gemini"`
+	Ark        ArkConfig        `yaml:"ark"`
+	FFmpeg     FFmpegConfig     `yaml:"ffmpeg"`
+}
+
+// AuthConfig 认证相关配置
+type AuthConfig struct {
+	JWTSecret    string `yaml:"jwt_secret" env:"V2V_JWT_SECRET"`
+	PasswordSalt string `yaml:"password_salt" env:"V2V_PASSWORD_SALT"`
+}
+
+// AdminConfig 运维管理接口（/admin）配置
+type AdminConfig struct {
+	// Token 请求需携带 X-Admin-Token 头；为空时禁用所有管理接口
+	Token string `yaml:"token" env:"V2V_ADMIN_TOKEN"`
+}
+
+// MySQLConfig MySQL 连接配置
+type MySQLConfig struct {
+	Host         string `yaml:"host" env:"V2V_MYSQL_HOST"`
+	Port         int    `yaml:"port" env:"V2V_MYSQL_PORT"`
+	User         string `yaml:"user" env:"V2V_MYSQL_USER"`
+	Password     string `yaml:"password" env:"V2V_MYSQL_PASSWORD"`
+	DB           string `yaml:"dbname" env:"V2V_MYSQL_DB"`
+	MaxOpenConns int    `yaml:"max_open_conns" env:"V2V_MYSQL_MAX_OPEN_CONNS"`
+	MaxIdleConns int    `yaml:"max_idle_conns" env:"V2V_MYSQL_MAX_IDLE_CONNS"`
+}
+
+// DSN 拼接 go-sql-driver 使用的连接串
+func (c MySQLConfig) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=Local", c.User, c.Password, c.Host, c.Port, c.DB)
+}
+
+// RedisConfig Redis 连接配置
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"V2V_REDIS_ADDR"`
+	Password string `yaml:"password" env:"V2V_REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"V2V_REDIS_DB"`
+	PoolSize int    `yaml:"pool_size" env:"V2V_REDIS_POOL_SIZE"`
+}
+
+// 任务队列后端
+const (
+	QueueBackendAMQP   = "amqp"
+	QueueBackendMemory = "memory"
+)
+
+// 延迟投递的实现方式（仅 amqp 后端）
+const (
+	// QueueDelayAuto 启动时探测 delayed-message 插件，可用则使用插件，否则回退到 TTL 队列
+	QueueDelayAuto = "auto"
+	// QueueDelayPlugin 使用 rabbitmq-delayed-message-exchange 插件（x-delayed-message 交换机）
+	QueueDelayPlugin = "plugin"
+	// QueueDelayTTL 为每个延迟时长声明一个带 x-message-ttl 的队列，到期后死信回目标队列（原生 RabbitMQ 即可）
+	QueueDelayTTL = "ttl"
+)
+
+// QueueConfig 任务队列配置
+type QueueConfig struct {
+	// Backend amqp（默认，RabbitMQ）或 memory（进程内实现，
+	// 只能用于 all 角色的本地开发与测试，进程退出后未完成的任务会丢失）
+	Backend string `yaml:"backend" env:"V2V_QUEUE_BACKEND"`
+	// Delay 延迟投递（重试退避、I2V 结果轮询）的实现：auto（默认）/ plugin / ttl
+	Delay string `yaml:"delay" env:"V2V_QUEUE_DELAY"`
+	// Retry 各任务类型的失败重试策略
+	Retry QueueRetryConfig `yaml:"retry"`
+	// Consumers 各队列消费者的并发数与 prefetch
+	Consumers QueueConsumersConfig `yaml:"consumers"`
+	// I2VPoll I2V 子任务结果的轮询策略
+	I2VPoll PollConfig `yaml:"i2v_poll"`
+}
+
+// PollConfig 轮询外部异步任务：首次在 initial_delay 后查询，未到终态时按 multiplier 递增间隔（不超过 max_delay，
+// 叠加 ±jitter 比例的抖动）再次查询，从提交起超过 timeout 仍未完成则标记为超时
+type PollConfig struct {
+	InitialDelay Duration `yaml:"initial_delay"`
+	MaxDelay     Duration `yaml:"max_delay"`
+	Multiplier   float64  `yaml:"multiplier"`
+	Jitter       float64  `yaml:"jitter"`
+	Timeout      Duration `yaml:"timeout"`
+}
+
+// validate 校验轮询配置，name 用于错误信息
+func (p PollConfig) validate(name string, require func(bool, string)) {
+	require(p.InitialDelay.Duration > 0, name+".initial_delay must be positive")
+	require(p.MaxDelay.Duration >= p.InitialDelay.Duration, name+".max_delay must not be less than initial_delay")
+	require(p.Multiplier >= 1, name+".multiplier must be at least 1")
+	require(p.Jitter >= 0 && p.Jitter <= 1, name+".jitter must be in 0-1")
+	require(p.Timeout.Duration > p.InitialDelay.Duration, name+".timeout must be greater than initial_delay")
+}
+
+// QueueConsumersConfig 按队列配置的消费者并发
+type QueueConsumersConfig struct {
+	I2V      ConsumerConfig `yaml:"i2v"`
+	I2VCheck ConsumerConfig `yaml:"i2v_check"`
+}
+
+// ConsumerConfig 消费者并发：Concurrency 为同时处理的消息数，Prefetch 为 broker 预先推送的未确认消息上限，
+// 应不小于 Concurrency，否则部分 worker 会空闲等待
+type ConsumerConfig struct {
+	Concurrency int `yaml:"concurrency"`
+	Prefetch    int `yaml:"prefetch"`
+}
+
+// validate 校验消费者配置，name 用于错误信息
+func (c ConsumerConfig) validate(name string, require func(bool, string)) {
+	require(c.Concurrency >= 1, name+".concurrency must be at least 1")
+	require(c.Prefetch >= c.Concurrency, name+".prefetch must not be less than concurrency")
+}
+
+// QueueRetryConfig 按任务类型配置的重试策略
+type QueueRetryConfig struct {
+	V2T RetryConfig `yaml:"v2t"`
+	T2I RetryConfig `yaml:"t2i"`
+}
+
+// RetryConfig 指数退避重试：第 n 次重试延迟 base_delay*multiplier^(n-1)，不超过 max_delay，
+// 再叠加 ±jitter 比例的随机抖动，避免大量任务在服务恢复瞬间同时重试
+type RetryConfig struct {
+	MaxRetries int      `yaml:"max_retries"`
+	BaseDelay  Duration `yaml:"base_delay"`
+	MaxDelay   Duration `yaml:"max_delay"`
+	Multiplier float64  `yaml:"multiplier"`
+	Jitter     float64  `yaml:"jitter"`
+}
+
+// validate 校验重试配置，name 用于错误信息
+func (r RetryConfig) validate(name string, require func(bool, string)) {
+	require(r.MaxRetries >= 0, name+".max_retries must not be negative")
+	require(r.BaseDelay.Duration >= 0, name+".base_delay must not be negative")
+	require(r.MaxDelay.Duration >= r.BaseDelay.Duration, name+".max_delay must not be less than base_delay")
+	require(r.Multiplier >= 1, name+".multiplier must be at least 1")
+	require(r.Jitter >= 0 && r.Jitter <= 1, name+".jitter must be in 0-1")
+}
+
+// RateLimitConfig 外部服务调用限流配置
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled" env:"V2V_RATE_LIMIT_ENABLED"`
+	// WaitTimeout 单次调用最多等待令牌 / 并发名额的时间，超时后任务按重试策略稍后再试
+	WaitTimeout Duration `yaml:"wait_timeout"`
+	// Limits 键为 provider（gemini / ark）或 provider/model，后者优先
+	Limits map[string]LimitConfig `yaml:"limits"`
+}
+
+// LimitConfig 一个 provider / model 的配额
+type LimitConfig struct {
+	// Rate 每秒补充的令牌数，Burst 为桶容量（允许的瞬时突发）；Rate 为 0 时不限制 QPS
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+	// MaxConcurrent 同时进行的调用数上限（0 为不限制）；LeaseTTL 为单个名额的最长占用时间，
+	// 进程崩溃未释放的名额到期后自动回收
+	MaxConcurrent int      `yaml:"max_concurrent"`
+	LeaseTTL      Duration `yaml:"lease_ttl"`
+}
+
+// CircuitBreakerConfig 外部服务熔断配置，每个 provider（gemini / ark）一个熔断器
+type CircuitBreakerConfig struct {
+	Enabled bool `yaml:"enabled" env:"V2V_CIRCUIT_BREAKER_ENABLED"`
+	// FailureThreshold 连续失败多少次后熔断，暂停消费依赖该 provider 的队列
+	FailureThreshold int `yaml:"failure_threshold"`
+	// OpenTimeout 熔断后等待多久放行一次探测调用（半开）；探测失败时翻倍，最长 MaxOpenTimeout
+	OpenTimeout    Duration `yaml:"open_timeout"`
+	MaxOpenTimeout Duration `yaml:"max_open_timeout"`
+}
+
+// RabbitMQConfig RabbitMQ 连接配置
+type RabbitMQConfig struct {
+	DSN string `yaml:"dsn" env:"V2V_RABBITMQ_DSN"`
+}
+
+// UploadConfig V2T 上传视频的存储与限制
+type UploadConfig struct {
+	// Dir 上传视频的存储目录（不对外公开，上传者通过 /api/v1/V2T/<task_id>/video 读取）；拆分部署时 API 与 worker 需要共享该目录
+	Dir string `yaml:"dir" env:"V2V_UPLOAD_DIR"`
+	// MaxSizeMB 单个视频的大小上限（MB）
+	MaxSizeMB int64 `yaml:"max_size_mb" env:"V2V_UPLOAD_MAX_SIZE_MB"`
+	// AllowedTypes 允许上传的视频类型（按文件内容识别，识别不出时按扩展名）
+	AllowedTypes []string `yaml:"allowed_types" env:"V2V_UPLOAD_ALLOWED_TYPES"`
+}
+
+// 视频分析服务
+const (
+	AnalyzerGemini = "gemini"
+	AnalyzerDoubao = "doubao"
+)
+
+// VideoAnalysisConfig V2T 视频分析服务配置
+type VideoAnalysisConfig struct {
+	// Provider 默认使用的服务（gemini / doubao），任务可以通过 provider 字段单独指定
+	Provider string `yaml:"provider" env:"V2V_VIDEO_ANALYSIS_PROVIDER"`
+	// Fallback 主服务返回临时错误（5xx / 429 / 网络错误）或已熔断时切换到的备用服务，为空则不切换
+	Fallback string `yaml:"fallback" env:"V2V_VIDEO_ANALYSIS_FALLBACK"`
+	// StructuredOutput 要求模型按分镜 JSON Schema 输出；模型不支持 JSON Schema 时关闭，改为解析 Markdown 分镜表
+	StructuredOutput bool `yaml:"structured_output" env:"V2V_VIDEO_ANALYSIS_STRUCTURED_OUTPUT"`
+}
+
+func isAnalyzer(name string) bool {
+	return name == AnalyzerGemini || name == AnalyzerDoubao
+}
+
+// 生图服务
+const (
+	ImageGeneratorArk = "ark"
+)
+
+// ImageGenerationConfig T2I 生图服务配置
+type ImageGenerationConfig struct {
+	// Provider 使用的生图服务，目前只有 ark（方舟 Seedream，模型见 ark.image_model）
+	Provider string `yaml:"provider" env:"V2V_IMAGE_GENERATION_PROVIDER"`
+	// PerShotConcurrency 逐镜头生图（per_shot 模式）时单个任务同时进行的生图调用数
+	PerShotConcurrency int `yaml:"per_shot_concurrency" env:"V2V_IMAGE_GENERATION_PER_SHOT_CONCURRENCY"`
+}
+
+// 图生视频服务
+const (
+	VideoGeneratorArk = "ark"
+)
+
+// VideoGenerationConfig I2V 图生视频服务配置
+type VideoGenerationConfig struct {
+	// Provider 使用的图生视频服务，目前只有 ark（方舟 Seedance，模型见 ark.video_model）
+	Provider string `yaml:"provider" env:"V2V_VIDEO_GENERATION_PROVIDER"`
+}
+
+// GenerationConfig T2I / I2V 请求可以指定的生成参数：未填写时使用默认值，填写时按用户 VIP 等级校验
+type GenerationConfig struct {
+	Image ImageDefaults `yaml:"image"`
+	Video VideoDefaults `yaml:"video"`
+	// Levels 各 VIP 等级允许的范围：用户按 vip_level 不超过自身等级的最高一档校验，必须包含 vip_level 0
+	Levels []GenerationLevel `yaml:"levels"`
+}
+
+// ImageDefaults T2I 参数默认值
+type ImageDefaults struct {
+	// Model 为空时使用 ark.image_model
+	Model string `yaml:"model"`
+	// Size 1K / 2K / 4K
+	Size string `yaml:"size"`
+	// AspectRatio 为空时由模型按提示词决定
+	AspectRatio string `yaml:"aspect_ratio"`
+	// Seed -1 表示随机
+	Seed      int64 `yaml:"seed"`
+	Watermark bool  `yaml:"watermark"`
+	// Count 一次最多生成的图片数
+	Count int `yaml:"count"`
+}
+
+// VideoDefaults I2V 参数默认值；除分辨率外，未设置（空 / 0 / 不填）的参数不会发送给服务，使用服务自身的默认值
+type VideoDefaults struct {
+	// Model 为空时使用 ark.video_model
+	Model string `yaml:"model"`
+	// Resolution 480p / 720p / 1080p
+	Resolution string `yaml:"resolution"`
+	// AspectRatio adaptive 表示跟随参考图
+	AspectRatio string `yaml:"aspect_ratio"`
+	// Seed -1 表示随机
+	Seed      *int64 `yaml:"seed"`
+	Watermark *bool  `yaml:"watermark"`
+	// Duration 每个分镜视频的时长（秒）
+	Duration    int   `yaml:"duration"`
+	CameraFixed *bool `yaml:"camera_fixed"`
+}
+
+// GenerationLevel 一个 VIP 等级允许的参数范围；模型列表为空时只能使用默认模型
+type GenerationLevel struct {
+	VIPLevel    uint8    `yaml:"vip_level"`
+	ImageModels []string `yaml:"image_models"`
+	ImageSizes  []string `yaml:"image_sizes"`
+	MaxImages   int      `yaml:"max_images"`
+	VideoModels []string `yaml:"video_models"`
+	Resolutions []string `yaml:"resolutions"`
+	MaxDuration int      `yaml:"max_duration"`
+	// RemoveWatermark 是否允许关闭水印
+	RemoveWatermark bool `yaml:"remove_watermark"`
+}
+
+// GeminiConfig Gemini（视频分析）配置
+type GeminiConfig struct {
+	APIKey  string `yaml:"api_key" env:"GEMINI_API_KEY"`
+	BaseURL string `yaml:"base_url" env:"V2V_GEMINI_BASE_URL"`
+	Model   string `yaml:"model" env:"V2V_GEMINI_MODEL"`
+	// InlineMaxMB 不超过该大小（MB）的上传视频随请求内联发送，更大的先经 Files API 上传；
+	// 请求体上限为 20MB，内联内容按 base64 编码后约增大 1/3
+	InlineMaxMB int64 `yaml:"inline_max_mb" env:"V2V_GEMINI_INLINE_MAX_MB"`
+}
+
+// ArkConfig 火山方舟（文生图 / 图生视频）配置
+type ArkConfig struct {
+	APIKey     string `yaml:"api_key" env:"ARK_API_KEY"`
+	BaseURL    string `yaml:"base_url" env:"V2V_ARK_BASE_URL"`
+	ImageModel string `yaml:"image_model" env:"V2V_ARK_IMAGE_MODEL"`
+	VideoModel string `yaml:"video_model" env:"V2V_ARK_VIDEO_MODEL"`
+	// VisionModel 豆包视觉理解模型，视频分析服务为 doubao 时使用
+	VisionModel string `yaml:"vision_model" env:"V2V_ARK_VISION_MODEL"`
+}
+
+// FFmpegConfig 视频拼接配置
+type FFmpegConfig struct {
+	AudioPath string `yaml:"audio_path" env:"V2V_FFMPEG_AUDIO_PATH"`
+	OutputDir string `yaml:"output_dir" env:"V2V_FFMPEG_OUTPUT_DIR"`
+}
+
+// Duration 支持在 yaml / 环境变量中使用 "30s"、"5m" 这类写法的时长
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML 实现 yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	d.Duration = v
+	return nil
+}
+
+// defaultConfig 返回内置默认值（不含任何密钥，密钥必须来自配置文件或环境变量）
+func defaultConfig() *AppConfig {
+	return &AppConfig{
+		Name:            "V2V",
+		Mode:            "dev",
+		Port:            8080,
+		HealthPort:      8081,
+		MachineID:       1,
+		ShutdownTimeout: Duration{30 * time.Second},
+		MySQL: MySQLConfig{
+			Port:         3306,
+			DB:           "V2V",
+			MaxOpenConns: 32,
+			MaxIdleConns: 16,
+		},
+		Redis: RedisConfig{
+			PoolSize: 100,
+		},
+		Queue: DefaultQueueConfig(),
+		RateLimit: RateLimitConfig{
+			WaitTimeout: Duration{2 * time.Minute},
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 5,
+			OpenTimeout:      Duration{30 * time.Second},
+			MaxOpenTimeout:   Duration{5 * time.Minute},
+		},
+		Upload: UploadConfig{
+			Dir:          "./public/uploads",
+			MaxSizeMB:    200,
+			AllowedTypes: []string{"video/mp4", "video/quicktime", "video/webm"},
+		},
+		VideoAnalysis: VideoAnalysisConfig{
+			Provider:         AnalyzerGemini,
+			StructuredOutput: true,
+		},
+		ImageGeneration: ImageGenerationConfig{
+			Provider:           ImageGeneratorArk,
+			PerShotConcurrency: 4,
+		},
+		VideoGeneration: VideoGenerationConfig{
+			Provider: VideoGeneratorArk,
+		},
+		Generation: GenerationConfig{
+			Image: ImageDefaults{Size: "1K", Seed: 42, Watermark: true, Count: 15},
+			Video: VideoDefaults{Resolution: "720p"},
+			Levels: []GenerationLevel{
+				{VIPLevel: 0, ImageSizes: []string{"1K"}, MaxImages: 15, Resolutions: []string{"480p", "720p"}, MaxDuration: 5},
+			},
+		},
+		Gemini: GeminiConfig{
+			Model:       "gemini-2.5-flash",
+			InlineMaxMB: 14,
+		},
+		Ark: ArkConfig{
+			BaseURL:     "https://ark.cn-beijing.volces.com/api/v3",
+			ImageModel:  "doubao-seedream-4-0-250828",
+			VideoModel:  "doubao-seedance-1-0-pro-250528",
+			VisionModel: "doubao-seed-1-6-vision-250815",
+		},
+		FFmpeg: FFmpegConfig{
+			AudioPath: "./util/backgroundmusic.mp3",
+			OutputDir: "./public/videos",
+		},
+	}
+}
+
+// DefaultQueueConfig 队列的内置默认配置（队列包在未注入配置时也使用它）
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Backend: QueueBackendAMQP,
+		Delay:   QueueDelayAuto,
+		Retry: QueueRetryConfig{
+			V2T: RetryConfig{
+				MaxRetries: 5,
+				BaseDelay:  Duration{10 * time.Second},
+				MaxDelay:   Duration{5 * time.Minute},
+				Multiplier: 2,
+				Jitter:     0.2,
+			},
+			T2I: RetryConfig{
+				MaxRetries: 5,
+				BaseDelay:  Duration{5 * time.Second},
+				MaxDelay:   Duration{2 * time.Minute},
+				Multiplier: 2,
+				Jitter:     0.2,
+			},
+		},
+		Consumers: QueueConsumersConfig{
+			I2V:      ConsumerConfig{Concurrency: 4, Prefetch: 8},
+			I2VCheck: ConsumerConfig{Concurrency: 4, Prefetch: 8},
+		},
+		I2VPoll: PollConfig{
+			InitialDelay: Duration{60 * time.Second},
+			MaxDelay:     Duration{5 * time.Minute},
+			Multiplier:   1.5,
+			Jitter:       0.1,
+			Timeout:      Duration{30 * time.Minute},
+		},
+	}
+}
+
+// Init 从指定文件加载配置，再用环境变量覆盖，最后校验；成功后写入全局 Conf
+func Init(path string) error {
+	cfg, err := Load(path)
+	if err != nil {
+		return err
+	}
+	Conf = cfg
+	return nil
+}
+
+// Load 加载并校验配置，不修改全局 Conf
+func Load(path string) (*AppConfig, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file %s: %v", path, err)
+		}
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %v", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate 校验启动所需的必填项，一次性返回所有问题，方便部署时排查
+func (c *AppConfig) Validate() error {
+	var problems []string
+	require := func(ok bool, msg string) {
+		if !ok {
+			problems = append(problems, msg)
+		}
+	}
+	require(c.Port > 0 && c.Port < 65536, "port must be in 1-65535")
+	require(c.HealthPort > 0 && c.HealthPort < 65536, "health_port must be in 1-65535")
+	require(c.ShutdownTimeout.Duration > 0, "shutdown_timeout must be positive")
+	require(c.MySQL.Host != "", "mysql.host is required")
+	require(c.MySQL.User != "", "mysql.user is required")
+	require(c.MySQL.DB != "", "mysql.dbname is required")
+	require(c.Redis.Addr != "", "redis.addr is required")
+	require(c.Queue.Backend == QueueBackendAMQP || c.Queue.Backend == QueueBackendMemory, "queue.backend must be amqp or memory")
+	require(c.Queue.Backend != QueueBackendAMQP || c.RabbitMQ.DSN != "", "rabbitmq.dsn is required")
+	require(c.Queue.Delay == QueueDelayAuto || c.Queue.Delay == QueueDelayPlugin || c.Queue.Delay == QueueDelayTTL,
+		"queue.delay must be auto, plugin or ttl")
+	c.Queue.Retry.V2T.validate("queue.retry.v2t", require)
+	c.Queue.Retry.T2I.validate("queue.retry.t2i", require)
+	c.Queue.Consumers.I2V.validate("queue.consumers.i2v", require)
+	c.Queue.Consumers.I2VCheck.validate("queue.consumers.i2v_check", require)
+	c.Queue.I2VPoll.validate("queue.i2v_poll", require)
+	require(c.RateLimit.WaitTimeout.Duration >= 0, "rate_limit.wait_timeout must not be negative")
+	for name, l := range c.RateLimit.Limits {
+		require(l.Rate >= 0, "rate_limit.limits."+name+".rate must not be negative")
+		require(l.Rate == 0 || l.Burst >= 1, "rate_limit.limits."+name+".burst must be at least 1")
+		require(l.MaxConcurrent >= 0, "rate_limit.limits."+name+".max_concurrent must not be negative")
+		require(l.LeaseTTL.Duration >= 0, "rate_limit.limits."+name+".lease_ttl must not be negative")
+	}
+	require(c.CircuitBreaker.FailureThreshold >= 1, "circuit_breaker.failure_threshold must be at least 1")
+	require(c.CircuitBreaker.OpenTimeout.Duration > 0, "circuit_breaker.open_timeout must be positive")
+	require(c.CircuitBreaker.MaxOpenTimeout.Duration >= c.CircuitBreaker.OpenTimeout.Duration,
+		"circuit_breaker.max_open_timeout must not be less than open_timeout")
+	require(c.Auth.JWTSecret != "", "auth.jwt_secret is required")
+	require(c.Auth.PasswordSalt != "", "auth.password_salt is required")
+	require(c.Upload.Dir != "", "upload.dir is required")
+	require(c.Upload.MaxSizeMB > 0, "upload.max_size_mb must be positive")
+	require(len(c.Upload.AllowedTypes) > 0, "upload.allowed_types must not be empty")
+	require(isAnalyzer(c.VideoAnalysis.Provider), "video_analysis.provider must be gemini or doubao")
+	require(c.VideoAnalysis.Fallback == "" || isAnalyzer(c.VideoAnalysis.Fallback),
+		"video_analysis.fallback must be empty, gemini or doubao")
+	require(c.VideoAnalysis.Fallback != c.VideoAnalysis.Provider, "video_analysis.fallback must differ from provider")
+	require(c.ImageGeneration.Provider == ImageGeneratorArk, "image_generation.provider must be ark")
+	require(c.ImageGeneration.PerShotConcurrency >= 1, "image_generation.per_shot_concurrency must be at least 1")
+	require(c.VideoGeneration.Provider == VideoGeneratorArk, "video_generation.provider must be ark")
+	c.Generation.validate(require)
+	require(c.Gemini.Model != "", "gemini.model is required")
+	require(c.Gemini.InlineMaxMB >= 0 && c.Gemini.InlineMaxMB < 20, "gemini.inline_max_mb must be in 0-19")
+	require(c.Ark.VisionModel != "", "ark.vision_model is required")
+	require(c.Ark.BaseURL != "", "ark.base_url is required")
+	require(c.Ark.ImageModel != "", "ark.image_model is required")
+	require(c.Ark.VideoModel != "", "ark.video_model is required")
+	require(c.FFmpeg.AudioPath != "", "ffmpeg.audio_path is required")
+	require(c.FFmpeg.OutputDir != "", "ffmpeg.output_dir is required")
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (g GenerationConfig) validate(require func(bool, string)) {
+	require(g.Image.Size != "", "generation.image.size is required")
+	require(g.Image.Count >= 1, "generation.image.count must be at least 1")
+	require(g.Video.Resolution != "", "generation.video.resolution is required")
+	require(g.Video.Duration >= 0, "generation.video.duration must not be negative")
+	hasBase := false
+	for _, l := range g.Levels {
+		hasBase = hasBase || l.VIPLevel == 0
+		name := "generation.levels[vip_level=" + strconv.Itoa(int(l.VIPLevel)) + "]"
+		require(l.MaxImages >= 1, name+".max_images must be at least 1")
+		// I2V 视频时长最短 2 秒
+		require(l.MaxDuration >= 2, name+".max_duration must be at least 2")
+	}
+	require(hasBase, "generation.levels must include vip_level 0")
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+// ValidateProviders 校验调用外部生成服务所需的密钥，只有运行队列消费者（worker）的进程需要
+func (c *AppConfig) ValidateProviders() error {
+	var problems []string
+	if c.Gemini.APIKey == "" {
+		problems = append(problems, "gemini.api_key is required (or GEMINI_API_KEY)")
+	}
+	if c.Ark.APIKey == "" {
+		problems = append(problems, "ark.api_key is required (or ARK_API_KEY)")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// applyEnv 递归遍历配置结构体，用字段 env tag 指定的环境变量覆盖对应值
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		sf := t.Field(i)
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			if err := applyEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+		name := sf.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", field.Type())
+		}
+		var items []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
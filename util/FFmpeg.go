@@ -2,6 +2,9 @@ package util
 
 import (
 	"V2V/dao/store"
+	"V2V/models"
+	"V2V/pkg/provider"
+	"V2V/settings"
 	"context"
 	"fmt"
 	"io"
@@ -13,11 +16,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime"
-	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
 )
 
+// 拼接视频所需的配置，由 Init 在启动时注入；查询分镜视频经由 pkg/provider
+var ffmpegConf settings.FFmpegConfig
+
+// Init 注入 FFmpeg 配置（背景音乐、输出目录）
+func Init(ffmpeg settings.FFmpegConfig) {
+	ffmpegConf = ffmpeg
+}
+
 // VideoProcessor 视频处理器结构体
 type VideoProcessor struct {
 	tempDir    string
@@ -43,7 +51,7 @@ func (vp *VideoProcessor) Cleanup() {
 }
 
 // DownloadVideo 下载单个视频
-func (vp *VideoProcessor) DownloadVideo(url string, filename string) error {
+func (vp *VideoProcessor) DownloadVideo(ctx context.Context, url string, filename string) error {
 	// 创建输出文件
 	filepath := filepath.Join(vp.tempDir, filename)
 	out, err := os.Create(filepath)
@@ -53,7 +61,11 @@ func (vp *VideoProcessor) DownloadVideo(url string, filename string) error {
 	defer out.Close()
 
 	// 发送HTTP请求
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("创建下载请求失败: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("下载请求失败: %v", err)
 	}
@@ -74,7 +86,7 @@ func (vp *VideoProcessor) DownloadVideo(url string, filename string) error {
 }
 
 // DownloadAllVideos 并发下载所有视频
-func (vp *VideoProcessor) DownloadAllVideos(urls []string) ([]string, error) {
+func (vp *VideoProcessor) DownloadAllVideos(ctx context.Context, urls []string) ([]string, error) {
 	var wg sync.WaitGroup
 	errors := make(chan error, len(urls))
 	downloadedFiles := make([]string, len(urls))
@@ -87,7 +99,7 @@ func (vp *VideoProcessor) DownloadAllVideos(urls []string) ([]string, error) {
 			filename := fmt.Sprintf("video_%d%s", index, vp.getFileExtension(videoURL))
 			log.Printf("正在下载: %s -> %s", videoURL, filename)
 
-			err := vp.DownloadVideo(videoURL, filename)
+			err := vp.DownloadVideo(ctx, videoURL, filename)
 			if err != nil {
 				errors <- fmt.Errorf("下载视频 %d 失败: %v", index, err)
 				return
@@ -152,15 +164,28 @@ func (vp *VideoProcessor) CreateConcatList(files []string) (string, error) {
 	return listFile, nil
 }
 
+// CheckFFmpeg 检查 ffmpeg 是否在 PATH 中且可以执行（用于健康检查）
+func CheckFFmpeg(ctx context.Context) error {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("ffmpeg not found in PATH: %v", err)
+	}
+	if err := exec.CommandContext(ctx, path, "-version").Run(); err != nil {
+		return fmt.Errorf("ffmpeg -version failed: %v", err)
+	}
+	return nil
+}
+
 // ConcatVideos 使用FFmpeg拼接视频
-func (vp *VideoProcessor) ConcatVideos(listFile string) error {
+// ctx 被取消（例如进程优雅关闭超时）时会终止 ffmpeg 子进程，避免遗留孤儿进程
+func (vp *VideoProcessor) ConcatVideos(ctx context.Context, listFile string) error {
 	// 检查FFmpeg是否可用
 	_, err := exec.LookPath("ffmpeg")
 	if err != nil {
 		return fmt.Errorf("ffmpeg未找到，请先安装ffmpeg并添加到PATH: %v", err)
 	}
 
-	audioPath := "/media/xc/my/V2V/util/backgroundmusic.mp3"
+	audioPath := ffmpegConf.AudioPath
 
 	// 检查音频文件是否存在
 	if _, err := os.Stat(audioPath); os.IsNotExist(err) {
@@ -170,7 +195,7 @@ func (vp *VideoProcessor) ConcatVideos(listFile string) error {
 	}
 
 	// 直接使用重新编码方式并添加音频（确保一定有声音）
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-f", "concat",
 		"-safe", "0",
 		"-i", listFile,
@@ -198,7 +223,7 @@ func (vp *VideoProcessor) ConcatVideos(listFile string) error {
 }
 
 // DownloadAndConcatVideos 主函数：下载并拼接视频
-func DownloadAndConcatVideos(urls []string, outputPath string) error {
+func DownloadAndConcatVideos(ctx context.Context, urls []string, outputPath string) error {
 	// 创建视频处理器
 	processor, err := NewVideoProcessor(outputPath)
 	if err != nil {
@@ -209,7 +234,7 @@ func DownloadAndConcatVideos(urls []string, outputPath string) error {
 	log.Printf("开始处理 %d 个视频", len(urls))
 
 	// 1. 下载所有视频
-	downloadedFiles, err := processor.DownloadAllVideos(urls)
+	downloadedFiles, err := processor.DownloadAllVideos(ctx, urls)
 	if err != nil {
 		return err
 	}
@@ -221,7 +246,7 @@ func DownloadAndConcatVideos(urls []string, outputPath string) error {
 	}
 
 	// 3. 拼接视频
-	err = processor.ConcatVideos(listFile)
+	err = processor.ConcatVideos(ctx, listFile)
 	if err != nil {
 		return err
 	}
@@ -230,7 +255,10 @@ func DownloadAndConcatVideos(urls []string, outputPath string) error {
 	return nil
 }
 
-func FFmpeg(userId uint64, taskid string) string {
+// FFmpeg 拉取任务的所有分镜视频并拼接、合成背景音乐，返回最终文件路径
+//
+// ctx 取消时会中止下载并终止 ffmpeg 子进程；出错时返回 error 而不是退出进程。
+func FFmpeg(ctx context.Context, userId uint64, taskid string) (string, error) {
 	// 使用示例
 	redisclient := store.GetRedis()
 	// 测试效果
@@ -238,45 +266,45 @@ func FFmpeg(userId uint64, taskid string) string {
 	keys := "user:" + strconv.FormatUint(userId, 10) + ":i2vtask:" + taskid
 	val, err := redisclient.ZRange(keys, 0, -1).Result()
 	if err != nil {
-		log.Fatalf("无法从Redis获取任务链接: %v", err)
+		return "", fmt.Errorf("无法从Redis获取任务链接: %v", err)
 	}
 	urls := make([]string, 0)
 	for _, v := range val {
-		url, err := GetVideoURL(v, userId)
+		url, err := GetVideoURL(ctx, v, userId)
 		if err != nil {
-			log.Fatalf("获取视频链接失败: %v", err)
+			return "", fmt.Errorf("获取视频链接失败: %v", err)
 		}
 		urls = append(urls, url)
 	}
 	// 确保输出目录存在（public/videos）
-	outDir := "./public/videos"
+	outDir := ffmpegConf.OutputDir
 	if err := os.MkdirAll(outDir, 0755); err != nil {
-		log.Fatalf("无法创建输出目录: %v", err)
+		return "", fmt.Errorf("无法创建输出目录: %v", err)
 	}
 
 	// 临时拼接输出文件（随后会合并音频生成最终文件）
 	concatPath := filepath.Join(outDir, taskid+"_concat.mp4")
 	finalPath := filepath.Join(outDir, taskid+".mp4")
 
-	err = DownloadAndConcatVideos(urls, concatPath)
+	err = DownloadAndConcatVideos(ctx, urls, concatPath)
 	if err != nil {
-		log.Fatalf("处理失败: %v", err)
+		return "", fmt.Errorf("处理失败: %v", err)
 	}
 	// 合并音频到最终输出
-	err = mergeVideoAudio(concatPath, "./util/backgroundmusic.mp3", finalPath)
+	err = mergeVideoAudio(ctx, concatPath, ffmpegConf.AudioPath, finalPath)
 	if err != nil {
-		log.Fatalf("合并音频失败: %v", err)
+		return "", fmt.Errorf("合并音频失败: %v", err)
 	}
 	// 删除临时拼接文件
 	if err := os.Remove(concatPath); err != nil {
 		log.Printf("删除临时文件失败: %v", err)
 	}
 	log.Printf("处理完成，输出文件: %s", finalPath)
-	return finalPath
+	return finalPath, nil
 }
 
-func mergeVideoAudio(videoPath, audioPath, outputPath string) error {
-	cmd := exec.Command("ffmpeg",
+func mergeVideoAudio(ctx context.Context, videoPath, audioPath, outputPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-i", videoPath, // 输入视频文件
 		"-i", audioPath, // 输入音频文件
 		"-c", "copy", // 直接流拷贝，不重新编码
@@ -293,18 +321,15 @@ func mergeVideoAudio(videoPath, audioPath, outputPath string) error {
 	return nil
 }
 
-func GetVideoURL(taskID string, userId uint64) (string, error) {
-	client := arkruntime.NewClientWithApiKey(os.Getenv("ARK_API_KEY"))
-	ctx := context.Background()
-
-	req := model.GetContentGenerationTaskRequest{}
-	req.ID = taskID
-
-	resp, err := client.GetContentGenerationTask(ctx, req)
+func GetVideoURL(ctx context.Context, taskID string, userId uint64) (string, error) {
+	task, err := provider.Videos().GetVideoTask(ctx, taskID)
 	if err != nil {
 		fmt.Printf("get content generation task error: %v\n", err)
 		return "", err
 	}
-	store.I2VTaskVideoURL(taskID, resp.Content.VideoURL, userId)
-	return resp.Content.VideoURL, nil
+	if task.Status != models.I2VSubTaskSucceeded {
+		return "", fmt.Errorf("视频任务 %s 未完成，状态: %s", taskID, task.Status)
+	}
+	store.I2VTaskVideoURL(taskID, task.VideoURL, userId)
+	return task.VideoURL, nil
 }
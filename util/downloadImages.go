@@ -7,6 +7,15 @@ import (
 	"os"
 )
 
+// SaveImage 把服务直接返回的图片内容保存到 public/pic 目录（与 DownloadImages 同名规则），返回文件名
+func SaveImage(data []byte, task_id string, index int) (string, error) {
+	filename := fmt.Sprintf(task_id+"_%d.jpg", index)
+	if err := os.WriteFile("./public/pic/"+filename, data, 0644); err != nil {
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	return filename, nil
+}
+
 func DownloadImages(imageURL, task_id string, index int) error {
 	// 创建输出文件
 	filename := fmt.Sprintf(task_id+"_%d.jpg", index)
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"V2V/pkg/queue"
+	"fmt"
+	"strings"
+)
+
+// 可由 worker 角色消费的队列名（worker --queues 参数的取值）
+const (
+	queueV2T      = "v2t"
+	queueT2I      = "t2i"
+	queueI2V      = "i2v"
+	queueI2VCheck = "i2v_check"
+)
+
+var allQueues = []string{queueV2T, queueT2I, queueI2V, queueI2VCheck}
+
+// parseQueues 解析逗号分隔的队列列表，空字符串或 "all" 表示全部队列
+func parseQueues(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "all" {
+		return allQueues, nil
+	}
+	seen := make(map[string]bool)
+	var queues []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		valid := false
+		for _, q := range allQueues {
+			if q == name {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown queue %q (available: %s)", name, strings.Join(allQueues, ","))
+		}
+		seen[name] = true
+		queues = append(queues, name)
+	}
+	return queues, nil
+}
+
+// startWorker 初始化并启动指定队列的消费者
+func startWorker(a *app, queues []string) error {
+	dsn := a.cfg.RabbitMQ.DSN
+	for _, name := range queues {
+		switch name {
+		case queueV2T:
+			if err := queue.InitRabbitMQ(dsn); err != nil {
+				return fmt.Errorf("init V2T RabbitMQ: %v", err)
+			}
+			rabbitMQ, _ := queue.GetRabbitMQ()
+			a.addQueue(queueV2T, rabbitMQ)
+			if err := rabbitMQ.Consume(); err != nil {
+				return fmt.Errorf("rabbit consume failed: %v", err)
+			}
+		case queueT2I:
+			if err := queue.InitT2IRabbitMQ(dsn); err != nil {
+				return fmt.Errorf("init T2I RabbitMQ: %v", err)
+			}
+			t2iRabbitMQ, _ := queue.GetT2IRabbitMQ()
+			a.addQueue(queueT2I, t2iRabbitMQ)
+			if err := t2iRabbitMQ.ConsumeT2I(); err != nil {
+				return fmt.Errorf("T2I rabbit consume failed: %v", err)
+			}
+		case queueI2V:
+			// I2V 消费者提交子任务后需要向延迟队列发布检查消息
+			if err := initDelayedQueue(a); err != nil {
+				return err
+			}
+			if err := queue.InitI2VRabbitMQ(dsn); err != nil {
+				return fmt.Errorf("init I2V RabbitMQ: %v", err)
+			}
+			i2vRabbitMQ, _ := queue.GetI2VRabbitMQ()
+			a.addQueue(queueI2V, i2vRabbitMQ)
+			if err := i2vRabbitMQ.ConsumeI2V(); err != nil {
+				return fmt.Errorf("I2V rabbit consume failed: %v", err)
+			}
+		case queueI2VCheck:
+			if err := initDelayedQueue(a); err != nil {
+				return err
+			}
+			delayedQueue, _ := queue.GetDelayedI2VQueue()
+			if err := delayedQueue.ConsumeDelayedChecks(); err != nil {
+				return fmt.Errorf("delayed I2V consume failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// initDelayedQueue 初始化延迟检查队列（重复调用只生效一次）
+func initDelayedQueue(a *app) error {
+	if err := queue.InitDelayedI2VQueue(a.cfg.RabbitMQ.DSN); err != nil {
+		return fmt.Errorf("init delayed I2V RabbitMQ: %v", err)
+	}
+	delayedQueue, _ := queue.GetDelayedI2VQueue()
+	a.addQueue(queueI2VCheck, delayedQueue)
+	return nil
+}